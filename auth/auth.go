@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"gameserver/config"
+	"gameserver/utils"
+	"time"
+)
+
+// Game requests start with the credentials of the player
+// |------------------------------------|
+// | credentials length |  credentials  |
+// |------------------------------------|
+// |       2byte        |      ...      |
+// |------------------------------------|
+// credentials are whatever the authenticator of the matcher expects,
+// a token for "token", "playerID:secret" for "file" and an opaque token for "http"
+
+const MaxCredentialsSize int = 1024
+
+var (
+	ErrUnauthorized         error = errors.New("auth: invalid credentials")
+	ErrInvalidCredentials   error = errors.New("auth: malformed credentials")
+	ErrUnknownAuthenticator error = errors.New("auth: unknown authenticator")
+)
+
+// Identity is the authenticated player
+type Identity struct {
+	PlayerID uint64
+	// bit set of the game modes the player may join
+	Modes uint32
+	// zero when the identity does not expire
+	ExpiresAt time.Time
+}
+
+// Allows reports whether the player may join games of mode
+func (i *Identity) Allows(mode uint8) bool {
+	return mode < 32 && i.Modes&(1<<mode) != 0
+}
+
+// Authenticator checks the credentials of a game request and returns the player they belong to
+type Authenticator interface {
+	Authenticate(credentials []byte) (*Identity, error)
+}
+
+// New returns the authenticator selected by config.Authenticator
+func New() (Authenticator, error) {
+	switch config.Authenticator {
+	case "token":
+		tokens, err := utils.ConfigKeyring()
+		if err != nil {
+			return nil, err
+		}
+		return NewTokenAuthenticator(tokens), nil
+	case "file":
+		return LoadFileAuthenticator(config.CredentialsFile)
+	case "http":
+		timeout := time.Duration(config.IntrospectionTimeoutMillisecond) * time.Millisecond
+		return NewHTTPAuthenticator(config.IntrospectionURL, timeout), nil
+	}
+	return nil, ErrUnknownAuthenticator
+}
+
+// AppendCredentials appends length prefixed credentials to a game request
+func AppendCredentials(dst, credentials []byte) []byte {
+	dst = utils.AppendLE(dst, uint16(len(credentials)))
+	return append(dst, credentials...)
+}
+
+// ReadCredentials reads the credentials of a game request
+func ReadCredentials(r *bufio.Reader) ([]byte, error) {
+	length, err := utils.ReadNBytes(r, 2)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := utils.ReadLE[uint16](length)
+	if n == 0 || int(n) > MaxCredentialsSize {
+		return nil, ErrInvalidCredentials
+	}
+	return utils.ReadNBytes(r, int(n))
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Credentials file has a player per line
+//	<player ID> <bcrypt hash of the secret> <modes>
+// modes is a bit set like in tokens, empty lines and lines starting with # are skipped.
+// players send "playerID:secret" as credentials
+
+// unknown players are checked against this hash, so they take as long as known ones
+var unknownPlayerHash []byte = []byte("$2a$10$CQmSA9S6/Y8KxFwKYDL89Ok.KcfFPppPVG26U47y.tq6Wh6V0bXuu")
+
+// FileAuthenticator accepts the players of a static credentials file
+type FileAuthenticator struct {
+	// secret hashes by player ID
+	secrets map[uint64][]byte
+	modes   map[uint64]uint32
+}
+
+func LoadFileAuthenticator(path string) (*FileAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return NewFileAuthenticator(file)
+}
+
+// NewFileAuthenticator reads a credentials file
+func NewFileAuthenticator(r io.Reader) (*FileAuthenticator, error) {
+	a := &FileAuthenticator{
+		secrets: make(map[uint64][]byte),
+		modes:   make(map[uint64]uint32),
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("auth: credentials file line %v: expected player ID, secret hash and modes", line)
+		}
+		playerID, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("auth: credentials file line %v: %w", line, err)
+		}
+		hash := []byte(fields[1])
+		if _, err = bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("auth: credentials file line %v: invalid secret hash", line)
+		}
+		modes, err := strconv.ParseUint(fields[2], 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("auth: credentials file line %v: %w", line, err)
+		}
+		a.secrets[playerID] = hash
+		a.modes[playerID] = uint32(modes)
+	}
+	return a, scanner.Err()
+}
+
+func (a *FileAuthenticator) Authenticate(credentials []byte) (*Identity, error) {
+	id, secret, found := bytes.Cut(credentials, []byte{':'})
+	if !found {
+		return nil, ErrInvalidCredentials
+	}
+	playerID, err := strconv.ParseUint(string(id), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	hash, exists := a.secrets[playerID]
+	if !exists {
+		bcrypt.CompareHashAndPassword(unknownPlayerHash, secret)
+		return nil, ErrUnauthorized
+	}
+	if bcrypt.CompareHashAndPassword(hash, secret) != nil {
+		return nil, ErrUnauthorized
+	}
+	return &Identity{PlayerID: playerID, Modes: a.modes[playerID]}, nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPAuthenticator delegates credentials to an introspection endpoint.
+// credentials are posted as the token form value and the endpoint answers
+//	{"active": true, "player_id": 7, "modes": 1, "exp": 1700000000}
+// exp is unix seconds and optional, inactive answers are rejected
+
+const maxIntrospectionResponse int64 = 1 << 16
+
+var ErrIntrospection error = errors.New("auth: introspection failed")
+
+type HTTPAuthenticator struct {
+	endpoint string
+	client   *http.Client
+}
+
+type introspection struct {
+	Active   bool   `json:"active"`
+	PlayerID uint64 `json:"player_id"`
+	Modes    uint32 `json:"modes"`
+	Exp      int64  `json:"exp"`
+}
+
+// NewHTTPAuthenticator returns an authenticator of the endpoint.
+// matcher waits for the endpoint, timeout bounds a single request
+func NewHTTPAuthenticator(endpoint string, timeout time.Duration) *HTTPAuthenticator {
+	return &HTTPAuthenticator{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (a *HTTPAuthenticator) Authenticate(credentials []byte) (*Identity, error) {
+	response, err := a.client.PostForm(a.endpoint, url.Values{"token": {string(credentials)}})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospection, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospection, response.Status)
+	}
+	var answer introspection
+	err = json.NewDecoder(io.LimitReader(response.Body, maxIntrospectionResponse)).Decode(&answer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospection, err)
+	}
+	if !answer.Active {
+		return nil, ErrUnauthorized
+	}
+	identity := &Identity{PlayerID: answer.PlayerID, Modes: answer.Modes}
+	if answer.Exp != 0 {
+		identity.ExpiresAt = time.Unix(answer.Exp, 0)
+		if !identity.ExpiresAt.After(time.Now()) {
+			return nil, ErrUnauthorized
+		}
+	}
+	return identity, nil
+}
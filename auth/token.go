@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"gameserver/utils"
+	"time"
+)
+
+// TokenAuthenticator accepts tokens signed by a key of its keyring
+type TokenAuthenticator struct {
+	tokens *utils.Keyring
+}
+
+func NewTokenAuthenticator(tokens *utils.Keyring) *TokenAuthenticator {
+	return &TokenAuthenticator{tokens: tokens}
+}
+
+func (a *TokenAuthenticator) Authenticate(credentials []byte) (*Identity, error) {
+	claims, err := a.tokens.Verify(credentials, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{PlayerID: claims.PlayerID, Modes: claims.Modes, ExpiresAt: claims.ExpiresAt}, nil
+}
@@ -1,6 +1,9 @@
 package client
 
-import "net"
+import (
+	"net"
+	"time"
+)
 
 var (
 	// possible client states
@@ -16,11 +19,22 @@ var (
 )
 
 type Client struct {
-	ClientID      uint16
+	ClientID uint16
+	// player ID of the authenticated credentials
+	PlayerID      uint64
 	TCPconn       net.Conn
 	Addr          string
 	State         string
 	UDPRegistered bool
+	// frame protocol version of the client, server answers with the same version
+	Version uint8
+	// key exchange public key sent with the game request, empty when frames are not encrypted
+	PublicKey []byte
+	// frame compressor negotiated by the matcher
+	Compression uint8
+	// client asked for compact frames, their time stamps are relative to the session epoch
+	Compact bool
+	Epoch   time.Time
 }
 
 func NewClient(clientID uint16, conn net.Conn) *Client {
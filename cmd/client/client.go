@@ -2,9 +2,17 @@ package main
 
 import (
 	"gameserver/config"
+	"gameserver/events"
+	"gameserver/frame"
 	"gameserver/simulator"
+	"log"
 )
 
 func main() {
+	err := events.Register(frame.DefaultRegistry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	events.RegisterCompression()
 	simulator.ClientSimulation(config.ClientRequestAddress, config.TCPPort, config.UDPPort)
 }
@@ -0,0 +1,395 @@
+// eventgen generates typed event structs from an event schema file.
+//
+//	//go:generate go run ../cmd/eventgen -in events.json -out events_gen.go
+//
+// every event becomes a struct with Encode/Decode methods on frame.Packet
+// and a Register function adds all of them into an event registry
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Schema is the event schema file
+type Schema struct {
+	Package string         `json:"package"`
+	Events  []*EventSchema `json:"events"`
+}
+
+type EventSchema struct {
+	ID          uint8  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// client_to_server, server_to_client or bidirectional (default)
+	Direction string `json:"direction"`
+	// unreliable (default), reliable or ordered
+	Delivery string         `json:"delivery"`
+	Fields   []*FieldSchema `json:"fields"`
+
+	// filled by the generator
+	TypeName string `json:"-"`
+	Payload  string `json:"-"`
+	Packed   bool   `json:"-"`
+	PackSize int    `json:"-"`
+}
+
+type FieldSchema struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// MaxLength limits string, bytes and vector fields, zero is unlimited
+	MaxLength int `json:"max_length"`
+
+	// filled by the generator
+	GoName string `json:"-"`
+	GoType string `json:"-"`
+	Offset int    `json:"-"`
+}
+
+type fieldType struct {
+	goType  string
+	payload string
+	// size of fixed width types, zero for variable ones
+	size int
+}
+
+var (
+	fieldTypes map[string]fieldType = map[string]fieldType{
+		"int32":   {"int32", "PayloadInt32", 4},
+		"int64":   {"int64", "PayloadInt64", 8},
+		"float32": {"float32", "PayloadFloat32", 4},
+		"float64": {"float64", "PayloadFloat64", 8},
+		"bool":    {"bool", "PayloadBool", 1},
+		"bytes":   {"[]byte", "PayloadBytes", 0},
+		"string":  {"string", "PayloadString", 0},
+		"vector":  {"[]float32", "PayloadVector", 0},
+	}
+
+	directions map[string]string = map[string]string{
+		"":                 "Bidirectional",
+		"bidirectional":    "Bidirectional",
+		"client_to_server": "ClientToServer",
+		"server_to_client": "ServerToClient",
+	}
+
+	deliveries map[string]string = map[string]string{
+		"":           "Unreliable",
+		"unreliable": "Unreliable",
+		"reliable":   "ReliableUnordered",
+		"ordered":    "ReliableOrdered",
+	}
+)
+
+func main() {
+	in := flag.String("in", "events.json", "event schema file")
+	out := flag.String("out", "events_gen.go", "generated go file")
+	pkg := flag.String("package", "", "package name, overrides the schema")
+	flag.Parse()
+
+	err := run(*in, *out, *pkg)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, pkg string) error {
+	raw, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	schema := &Schema{}
+	err = json.Unmarshal(raw, schema)
+	if err != nil {
+		return err
+	}
+	if pkg != "" {
+		schema.Package = pkg
+	}
+	err = prepare(schema)
+	if err != nil {
+		return err
+	}
+	src, err := generate(schema, in)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
+
+// prepare validates the schema and resolves go names and types
+func prepare(schema *Schema) error {
+	if schema.Package == "" {
+		return errors.New("eventgen: package name is missing")
+	}
+	ids := make(map[uint8]string)
+	for _, e := range schema.Events {
+		if e.ID < 16 || e.ID > 239 {
+			return fmt.Errorf("eventgen: %v: event ID %v is reserved", e.Name, e.ID)
+		}
+		if other, exists := ids[e.ID]; exists {
+			return fmt.Errorf("eventgen: %v: event ID %v is used by %v", e.Name, e.ID, other)
+		}
+		ids[e.ID] = e.Name
+		direction, exists := directions[e.Direction]
+		if !exists {
+			return fmt.Errorf("eventgen: %v: unknown direction %q", e.Name, e.Direction)
+		}
+		e.Direction = direction
+		delivery, exists := deliveries[e.Delivery]
+		if !exists {
+			return fmt.Errorf("eventgen: %v: unknown delivery %q", e.Name, e.Delivery)
+		}
+		e.Delivery = delivery
+		e.TypeName = goName(e.Name)
+		if len(e.Fields) == 0 {
+			return fmt.Errorf("eventgen: %v: event has no field", e.Name)
+		}
+		// events with more than one field are packed into a bytes payload
+		e.Packed = len(e.Fields) > 1
+		for _, f := range e.Fields {
+			t, exists := fieldTypes[f.Type]
+			if !exists {
+				return fmt.Errorf("eventgen: %v.%v: unknown type %q", e.Name, f.Name, f.Type)
+			}
+			if e.Packed && t.size == 0 {
+				return fmt.Errorf("eventgen: %v.%v: only fixed width fields can be packed", e.Name, f.Name)
+			}
+			f.GoName = goName(f.Name)
+			f.GoType = t.goType
+			f.Offset = e.PackSize
+			e.PackSize += t.size
+			e.Payload = t.payload
+		}
+		if e.Packed {
+			e.Payload = "PayloadBytes"
+		}
+	}
+	return nil
+}
+
+func generate(schema *Schema, source string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	err := eventTemplate.Execute(buffer, map[string]interface{}{
+		"Schema": schema,
+		"Source": source,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+// goName converts snake case schema names to exported go names
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' '
+	})
+	for i, p := range parts {
+		parts[i] = strings.ToUpper(p[:1]) + p[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func hasPacked(schema *Schema) bool {
+	for _, e := range schema.Events {
+		if e.Packed {
+			return true
+		}
+	}
+	return false
+}
+
+var eventTemplate = template.Must(template.New("events").Funcs(template.FuncMap{
+	"hasPacked": hasPacked,
+}).Parse(`// Code generated by eventgen from {{.Source}}. DO NOT EDIT.
+
+package {{.Schema.Package}}
+
+import (
+{{- if hasPacked .Schema}}
+	"encoding/binary"
+	"math"
+{{- end}}
+	"fmt"
+	"gameserver/frame"
+)
+
+const (
+{{- range .Schema.Events}}
+	{{.TypeName}}ID uint8 = {{.ID}}
+{{- end}}
+)
+
+// Register adds all events of this package into the registry
+func Register(r *frame.Registry) error {
+	specs := []frame.EventSpec{
+{{- range .Schema.Events}}
+		{
+			ID:        {{.TypeName}}ID,
+			Name:      "{{.Name}}",
+			Payload:   frame.{{.Payload}},
+			Direction: frame.{{.Direction}},
+			Delivery:  frame.{{.Delivery}},
+			Validate: func(ev *frame.Event) error {
+				return (&{{.TypeName}}{}).DecodeEvent(ev)
+			},
+		},
+{{- end}}
+	}
+	for _, spec := range specs {
+		err := r.Register(spec)
+		if err != nil {
+			return fmt.Errorf("%v: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+{{range $e := .Schema.Events}}
+{{- if $e.Description}}
+// {{$e.TypeName}} {{$e.Description}}
+{{- else}}
+// {{$e.TypeName}} is the {{$e.Name}} event
+{{- end}}
+type {{$e.TypeName}} struct {
+{{- range $e.Fields}}
+	{{.GoName}} {{.GoType}}
+{{- end}}
+}
+
+// Event converts {{$e.TypeName}} into a frame event
+func (e *{{$e.TypeName}}) Event() *frame.Event {
+{{- if $e.Packed}}
+	value := make([]byte, {{$e.PackSize}})
+{{- range $e.Fields}}
+{{- if eq .Type "int32"}}
+	binary.LittleEndian.PutUint32(value[{{.Offset}}:], uint32(e.{{.GoName}}))
+{{- else if eq .Type "int64"}}
+	binary.LittleEndian.PutUint64(value[{{.Offset}}:], uint64(e.{{.GoName}}))
+{{- else if eq .Type "float32"}}
+	binary.LittleEndian.PutUint32(value[{{.Offset}}:], math.Float32bits(e.{{.GoName}}))
+{{- else if eq .Type "float64"}}
+	binary.LittleEndian.PutUint64(value[{{.Offset}}:], math.Float64bits(e.{{.GoName}}))
+{{- else if eq .Type "bool"}}
+	if e.{{.GoName}} {
+		value[{{.Offset}}] = 1
+	}
+{{- end}}
+{{- end}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: &frame.Payload{Type: frame.PayloadBytes, Value: value}}
+{{- else}}
+{{- with index $e.Fields 0}}
+{{- if eq .Type "int32"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Data: e.{{.GoName}}}
+{{- else if eq .Type "int64"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: frame.Int64Payload(e.{{.GoName}})}
+{{- else if eq .Type "float32"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: frame.Float32Payload(e.{{.GoName}})}
+{{- else if eq .Type "float64"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: frame.Float64Payload(e.{{.GoName}})}
+{{- else if eq .Type "bool"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: frame.BoolPayload(e.{{.GoName}})}
+{{- else if eq .Type "bytes"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: frame.BytesPayload(e.{{.GoName}})}
+{{- else if eq .Type "string"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: frame.StringPayload(e.{{.GoName}})}
+{{- else if eq .Type "vector"}}
+	return &frame.Event{ID: {{$e.TypeName}}ID, Payload: frame.VectorPayload(e.{{.GoName}}...)}
+{{- end}}
+{{- end}}
+{{- end}}
+}
+
+// Encode appends {{$e.TypeName}} to the packet events
+func (e *{{$e.TypeName}}) Encode(p *frame.Packet) {
+	p.Events = append(p.Events, e.Event())
+}
+
+// DecodeEvent fills {{$e.TypeName}} from a frame event
+func (e *{{$e.TypeName}}) DecodeEvent(ev *frame.Event) error {
+	if ev.ID != {{$e.TypeName}}ID {
+		return frame.ErrEventSchema
+	}
+{{- if $e.Packed}}
+	if !ev.IsTyped() {
+		return frame.ErrEventSchema
+	}
+	value, err := ev.Payload.Bytes()
+	if err != nil || len(value) != {{$e.PackSize}} {
+		return frame.ErrEventSchema
+	}
+{{- range $e.Fields}}
+{{- if eq .Type "int32"}}
+	e.{{.GoName}} = int32(binary.LittleEndian.Uint32(value[{{.Offset}}:]))
+{{- else if eq .Type "int64"}}
+	e.{{.GoName}} = int64(binary.LittleEndian.Uint64(value[{{.Offset}}:]))
+{{- else if eq .Type "float32"}}
+	e.{{.GoName}} = math.Float32frombits(binary.LittleEndian.Uint32(value[{{.Offset}}:]))
+{{- else if eq .Type "float64"}}
+	e.{{.GoName}} = math.Float64frombits(binary.LittleEndian.Uint64(value[{{.Offset}}:]))
+{{- else if eq .Type "bool"}}
+	e.{{.GoName}} = value[{{.Offset}}] == 1
+{{- end}}
+{{- end}}
+	return nil
+{{- else}}
+{{- with index $e.Fields 0}}
+{{- if eq .Type "int32"}}
+	if ev.IsTyped() {
+		return frame.ErrEventSchema
+	}
+	e.{{.GoName}} = ev.Data
+	return nil
+{{- else}}
+	if !ev.IsTyped() {
+		return frame.ErrEventSchema
+	}
+{{- if eq .Type "int64"}}
+	value, err := ev.Payload.Int64()
+{{- else if eq .Type "float32"}}
+	value, err := ev.Payload.Float32()
+{{- else if eq .Type "float64"}}
+	value, err := ev.Payload.Float64()
+{{- else if eq .Type "bool"}}
+	value, err := ev.Payload.Bool()
+{{- else if eq .Type "bytes"}}
+	value, err := ev.Payload.Bytes()
+{{- else if eq .Type "string"}}
+	value, err := ev.Payload.Text()
+{{- else if eq .Type "vector"}}
+	value, err := ev.Payload.Vector()
+{{- end}}
+	if err != nil {
+		return frame.ErrEventSchema
+	}
+{{- if .MaxLength}}
+	if len(value) > {{.MaxLength}} {
+		return fmt.Errorf("{{.Name}} is longer than {{.MaxLength}}")
+	}
+{{- end}}
+	e.{{.GoName}} = value
+	return nil
+{{- end}}
+{{- end}}
+{{- end}}
+}
+
+// Decode fills {{$e.TypeName}} from the first {{$e.Name}} event of the packet
+func (e *{{$e.TypeName}}) Decode(p *frame.Packet) error {
+	for _, ev := range p.Events {
+		if ev.ID == {{$e.TypeName}}ID {
+			return e.DecodeEvent(ev)
+		}
+	}
+	return frame.ErrEventNotFound
+}
+{{end}}`))
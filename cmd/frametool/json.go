@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gameserver/frame"
+	"gameserver/utils"
+	"time"
+)
+
+// jsonPacket is the readable form of a frame.Packet.
+// sections are only written when their flag is set
+type jsonPacket struct {
+	Version     uint8         `json:"version"`
+	Flags       []string      `json:"flags,omitempty"`
+	Seq         *uint16       `json:"seq,omitempty"`
+	Ack         *uint16       `json:"ack,omitempty"`
+	AckBits     *uint32       `json:"ack_bits,omitempty"`
+	Delivery    string        `json:"delivery,omitempty"`
+	MessageID   *uint16       `json:"message_id,omitempty"`
+	Fragment    *jsonFragment `json:"fragment,omitempty"`
+	Compression string        `json:"compression,omitempty"`
+	ClientID    uint16        `json:"client_id"`
+	GameID      uint16        `json:"game_id"`
+	Events      []*jsonEvent  `json:"events"`
+	TimeStamp   time.Time     `json:"time_stamp"`
+	// session epoch of compact frames
+	Epoch *time.Time `json:"epoch,omitempty"`
+	// set when the frame is read from a capture file
+	Capture *jsonCapture `json:"capture,omitempty"`
+}
+
+type jsonCapture struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Peer      string    `json:"peer"`
+	GameID    uint16    `json:"game_id"`
+	ClientID  uint16    `json:"client_id"`
+}
+
+type jsonFragment struct {
+	ID    uint16 `json:"id"`
+	Index uint8  `json:"index"`
+	Count uint8  `json:"count"`
+	// hex encoded chunk
+	Data string `json:"data"`
+}
+
+// jsonEvent is a legacy event with data or a typed event with type and value.
+// either ID or name is enough to encode an event
+type jsonEvent struct {
+	ID    *uint8          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Data  int32           `json:"data"`
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+var (
+	flagNames = []struct {
+		flag uint8
+		name string
+	}{
+		{frame.FlagTypedEvents, "typed_events"},
+		{frame.FlagSequenced, "sequenced"},
+		{frame.FlagReliable, "reliable"},
+		{frame.FlagFragment, "fragment"},
+		{frame.FlagChecksum, "checksum"},
+		{frame.FlagEncrypted, "encrypted"},
+		{frame.FlagCompressed, "compressed"},
+		{frame.FlagCompact, "compact"},
+	}
+
+	compressionNames map[uint8]string = map[uint8]string{
+		frame.CompressionNone:       "none",
+		frame.CompressionFlate:      "flate",
+		frame.CompressionDictionary: "dictionary",
+	}
+
+	errUnknownName      error = errors.New("unknown name")
+	errMissingTimeStamp error = errors.New("time_stamp is missing")
+)
+
+func toJSON(p *frame.Packet) *jsonPacket {
+	j := &jsonPacket{
+		Version:   p.Version,
+		ClientID:  p.ClientID,
+		GameID:    p.GameID,
+		Events:    make([]*jsonEvent, 0, len(p.Events)),
+		TimeStamp: p.TimeStamp,
+	}
+	for _, f := range flagNames {
+		if p.Flags&f.flag != 0 {
+			j.Flags = append(j.Flags, f.name)
+		}
+	}
+	if p.Flags&frame.FlagSequenced != 0 {
+		j.Seq, j.Ack, j.AckBits = &p.Seq, &p.Ack, &p.AckBits
+	}
+	if p.Flags&frame.FlagReliable != 0 {
+		j.Delivery = p.Delivery.String()
+		j.MessageID = &p.MessageID
+	}
+	if p.Fragment != nil {
+		j.Fragment = &jsonFragment{
+			ID:    p.Fragment.ID,
+			Index: p.Fragment.Index,
+			Count: p.Fragment.Count,
+			Data:  hex.EncodeToString(p.Fragment.Data),
+		}
+	}
+	if p.Flags&frame.FlagCompressed != 0 {
+		j.Compression = nameOf(compressionNames, p.Compression)
+	}
+	if p.Flags&frame.FlagCompact != 0 {
+		j.Epoch = &p.Epoch
+	}
+	for _, e := range p.Events {
+		id := e.ID
+		je := &jsonEvent{ID: &id, Name: eventName(e.ID), Data: e.Data}
+		if e.Payload != nil {
+			je.Type = e.Payload.Type.String()
+			je.Value, _ = json.Marshal(payloadValue(e.Payload))
+		}
+		j.Events = append(j.Events, je)
+	}
+	return j
+}
+
+func toJSONCapture(r *frame.CaptureRecord) *jsonCapture {
+	return &jsonCapture{
+		Time:      r.Time,
+		Direction: directionName(r.Direction),
+		Peer:      r.Peer,
+		GameID:    r.GameID,
+		ClientID:  r.ClientID,
+	}
+}
+
+func directionName(d frame.Direction) string {
+	switch d {
+	case frame.ClientToServer:
+		return "client_to_server"
+	case frame.ServerToClient:
+		return "server_to_client"
+	}
+	return fmt.Sprint(d)
+}
+
+// eventName names protocol events with frame.EventName and game events with their registered name
+func eventName(id uint8) string {
+	if name, exists := frame.EventName[id]; exists {
+		return name
+	}
+	return frame.DefaultRegistry.Name(id)
+}
+
+func payloadValue(payload *frame.Payload) interface{} {
+	var v interface{}
+	var err error
+	switch payload.Type {
+	case frame.PayloadInt32:
+		v, err = payload.Int32()
+	case frame.PayloadInt64:
+		v, err = payload.Int64()
+	case frame.PayloadFloat32:
+		v, err = payload.Float32()
+	case frame.PayloadFloat64:
+		v, err = payload.Float64()
+	case frame.PayloadBool:
+		v, err = payload.Bool()
+	case frame.PayloadString:
+		v, err = payload.Text()
+	case frame.PayloadVector:
+		v, err = payload.Vector()
+	default:
+		return hex.EncodeToString(payload.Value)
+	}
+	if err != nil {
+		return hex.EncodeToString(payload.Value)
+	}
+	return v
+}
+
+func fromJSON(j *jsonPacket) (*frame.Packet, error) {
+	p := &frame.Packet{
+		Version:   j.Version,
+		ClientID:  j.ClientID,
+		GameID:    j.GameID,
+		TimeStamp: j.TimeStamp,
+	}
+	if p.TimeStamp.IsZero() {
+		return nil, errMissingTimeStamp
+	}
+	for _, name := range j.Flags {
+		flag, err := flagOf(name)
+		if err != nil {
+			return nil, err
+		}
+		p.Flags |= flag
+	}
+	if j.Seq != nil || j.Ack != nil || j.AckBits != nil {
+		p.Flags |= frame.FlagSequenced
+		p.Seq, p.Ack, p.AckBits = valueOf(j.Seq), valueOf(j.Ack), valueOf(j.AckBits)
+	}
+	if j.Delivery != "" {
+		delivery, err := idOf(frame.DeliveryName, j.Delivery)
+		if err != nil {
+			return nil, fmt.Errorf("delivery %q: %w", j.Delivery, err)
+		}
+		p.Delivery = delivery
+		p.MessageID = valueOf(j.MessageID)
+		if p.Delivery != frame.Unreliable {
+			p.Flags |= frame.FlagReliable
+		}
+	}
+	if j.Fragment != nil {
+		data, err := hex.DecodeString(j.Fragment.Data)
+		if err != nil {
+			return nil, fmt.Errorf("fragment data: %w", err)
+		}
+		p.Flags |= frame.FlagFragment
+		p.Fragment = &frame.Fragment{ID: j.Fragment.ID, Index: j.Fragment.Index, Count: j.Fragment.Count, Data: data}
+	}
+	if j.Compression != "" {
+		compression, err := idOf(compressionNames, j.Compression)
+		if err != nil {
+			return nil, fmt.Errorf("compression %q: %w", j.Compression, err)
+		}
+		p.Compression = compression
+	}
+	if j.Epoch != nil {
+		p.Epoch = *j.Epoch
+	}
+	for i, je := range j.Events {
+		e, err := eventOf(je)
+		if err != nil {
+			return nil, fmt.Errorf("events[%v]: %w", i, err)
+		}
+		p.Events = append(p.Events, e)
+	}
+	return p, nil
+}
+
+func eventOf(je *jsonEvent) (*frame.Event, error) {
+	e := &frame.Event{Data: je.Data}
+	switch {
+	case je.ID != nil:
+		e.ID = *je.ID
+		if je.Name != "" && je.Name != eventName(e.ID) {
+			return nil, fmt.Errorf("name %q does not match id %v", je.Name, e.ID)
+		}
+	case je.Name != "":
+		id, err := eventID(je.Name)
+		if err != nil {
+			return nil, err
+		}
+		e.ID = id
+	default:
+		return nil, errors.New("id or name is missing")
+	}
+	if je.Type == "" {
+		return e, nil
+	}
+	payload, err := payloadOf(je.Type, je.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%v value: %w", je.Type, err)
+	}
+	e.Payload = payload
+	return e, nil
+}
+
+func eventID(name string) (uint8, error) {
+	for id := 0; id <= 255; id++ {
+		if eventName(uint8(id)) == name {
+			return uint8(id), nil
+		}
+	}
+	return 0, fmt.Errorf("event %q: %w", name, errUnknownName)
+}
+
+func payloadOf(typeName string, value json.RawMessage) (*frame.Payload, error) {
+	t, err := idOf(frame.PayloadTypeName, typeName)
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case frame.PayloadInt32:
+		var v int32
+		err = json.Unmarshal(value, &v)
+		return &frame.Payload{Type: t, Value: utils.AppendLE(nil, v)}, err
+	case frame.PayloadInt64:
+		var v int64
+		err = json.Unmarshal(value, &v)
+		return frame.Int64Payload(v), err
+	case frame.PayloadFloat32:
+		var v float32
+		err = json.Unmarshal(value, &v)
+		return frame.Float32Payload(v), err
+	case frame.PayloadFloat64:
+		var v float64
+		err = json.Unmarshal(value, &v)
+		return frame.Float64Payload(v), err
+	case frame.PayloadBool:
+		var v bool
+		err = json.Unmarshal(value, &v)
+		return frame.BoolPayload(v), err
+	case frame.PayloadString:
+		var v string
+		err = json.Unmarshal(value, &v)
+		return frame.StringPayload(v), err
+	case frame.PayloadVector:
+		var v []float32
+		err = json.Unmarshal(value, &v)
+		return frame.VectorPayload(v...), err
+	}
+	// bytes are hex encoded
+	var v string
+	err = json.Unmarshal(value, &v)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(v)
+	return frame.BytesPayload(data), err
+}
+
+func flagOf(name string) (uint8, error) {
+	for _, f := range flagNames {
+		if f.name == name {
+			return f.flag, nil
+		}
+	}
+	return 0, fmt.Errorf("flag %q: %w", name, errUnknownName)
+}
+
+func nameOf(names map[uint8]string, id uint8) string {
+	if name, exists := names[id]; exists {
+		return name
+	}
+	return fmt.Sprint(id)
+}
+
+func idOf[K comparable](names map[K]string, name string) (K, error) {
+	for id, n := range names {
+		if n == name {
+			return id, nil
+		}
+	}
+	var zero K
+	return zero, errUnknownName
+}
+
+func valueOf[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
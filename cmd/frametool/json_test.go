@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"gameserver/frame"
+	"strings"
+	"testing"
+)
+
+func TestEncodeStrict(t *testing.T) {
+	var out bytes.Buffer
+	valid := `{"version": 1, "client_id": 2, "game_id": 3, "time_stamp": "2024-01-02T03:04:05Z",
+		"events": [{"name": "data", "data": 7}, {"id": 40, "type": "string", "value": "hi"}]}`
+	if err := encode(strings.NewReader(valid), "hex", &out); err != nil {
+		t.Fatal("ERROR: valid packet is not encoded", err)
+	}
+	packet, _ := hex.DecodeString(strings.TrimSpace(out.String()))
+	p, err := frame.Decode(packet)
+	if err != nil || p.ClientID != 2 || len(p.Events) != 2 || p.Events[0].Data != 7 || p.TimeStamp.Year() != 2024 {
+		t.Fatal("ERROR: encoded packet mismatch", p, err)
+	}
+
+	cases := []struct {
+		name string
+		json string
+	}{
+		{"misspelled field", `{"version": 1, "clientID": 2, "game_id": 3, "time_stamp": "2024-01-02T03:04:05Z", "events": []}`},
+		{"payload in wrong shape", `[{"version": 1, "client_id": 2, "game_id": 3, "time_stamp": "2024-01-02T03:04:05Z",
+			"events": [{"name": "data", "payload": {"type": "int64", "value": 5}}]}]`},
+		{"trailing packet", `{"version": 1, "client_id": 2, "game_id": 3, "time_stamp": "2024-01-02T03:04:05Z", "events": []} {}`},
+	}
+	for _, c := range cases {
+		if err := encode(strings.NewReader(c.json), "hex", &out); err == nil {
+			t.Log("ERROR: malformed JSON is encoded.", c.name)
+			t.Fail()
+		}
+	}
+
+	missing := `{"version": 1, "client_id": 2, "game_id": 3, "events": [{"name": "data"}]}`
+	if err := encode(strings.NewReader(missing), "hex", &out); !errors.Is(err, errMissingTimeStamp) {
+		t.Log("ERROR: packet without time stamp is encoded", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,334 @@
+// frametool decodes, encodes and validates frames.
+//
+//	frametool decode   [-in hex|base64|raw|stream|capture] [-game IDs] [-client IDs] [-epoch unix nano] [file]
+//	frametool encode   [-out hex|base64|raw|stream] [file]
+//	frametool validate [-in hex|base64|raw|stream|capture] [-game IDs] [-client IDs] [file]
+//
+// hex and base64 inputs have one frame per line, raw input is a single frame,
+// stream input is length prefixed frames (frame.StreamWriter) and capture input
+// is a capture file of the game router (config.CaptureFile).
+// frames are read from stdin when file is not given, bundles are split into their frames.
+// -game and -client take comma separated IDs and select the frames of those games and clients
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gameserver/events"
+	"gameserver/frame"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errUsage        error = errors.New("frametool: usage: frametool decode|encode|validate [flags] [file]")
+	errFormat       error = errors.New("frametool: unknown format, use hex, base64, raw, stream or capture")
+	errInvalidAny   error = errors.New("frametool: some frames are invalid")
+	errTrailingJSON error = errors.New("frametool: trailing data after the JSON packets")
+)
+
+func main() {
+	log.SetFlags(0)
+	err := events.Register(frame.DefaultRegistry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	events.RegisterCompression()
+
+	err = run(os.Args[1:], os.Stdout)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	command := flag.NewFlagSet(args[0], flag.ExitOnError)
+	in := command.String("in", "hex", "input format of frames: hex, base64, raw, stream or capture")
+	format := command.String("out", "hex", "output format of encoded frames: hex, base64, raw or stream")
+	epoch := command.Int64("epoch", 0, "session epoch of compact frames in unix nano")
+	games := command.String("game", "", "comma separated game IDs to select")
+	clients := command.String("client", "", "comma separated client IDs to select")
+	command.Parse(args[1:])
+
+	var filter frame.CaptureFilter
+	var err error
+	filter.GameIDs, err = parseIDs(*games)
+	if err != nil {
+		return err
+	}
+	filter.ClientIDs, err = parseIDs(*clients)
+	if err != nil {
+		return err
+	}
+
+	input := io.Reader(os.Stdin)
+	if command.NArg() > 0 {
+		file, err := os.Open(command.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	switch args[0] {
+	case "decode":
+		frames, err := readFrames(*in, input, filter)
+		if err != nil {
+			return err
+		}
+		return decode(frames, *epoch, out)
+	case "encode":
+		return encode(input, *format, out)
+	case "validate":
+		frames, err := readFrames(*in, input, filter)
+		if err != nil {
+			return err
+		}
+		return validate(frames, out)
+	}
+	return errUsage
+}
+
+func parseIDs(list string) ([]uint16, error) {
+	var ids []uint16
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("frametool: invalid ID %q", field)
+		}
+		ids = append(ids, uint16(id))
+	}
+	return ids, nil
+}
+
+// input is a frame and the capture record it was read from, record is nil for other formats
+type input struct {
+	packet []byte
+	record *frame.CaptureRecord
+}
+
+// readFrames reads the frames of the input that match the filter, bundles are split into their frames.
+// frames of capture records are selected by the record IDs, others by their own IDs
+func readFrames(format string, r io.Reader, filter frame.CaptureFilter) ([]*input, error) {
+	if format == "capture" {
+		records, err := frame.ReadCapture(r, filter)
+		if err != nil {
+			return nil, err
+		}
+		var inputs []*input
+		for _, record := range records {
+			frames, err := unbundle([][]byte{record.Frame})
+			if err != nil {
+				return nil, err
+			}
+			for _, packet := range frames {
+				inputs = append(inputs, &input{packet: packet, record: record})
+			}
+		}
+		return inputs, nil
+	}
+
+	var frames [][]byte
+	switch format {
+	case "hex", "base64":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 4*frame.MaxFrameSize)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			packet, err := parseLine(format, text)
+			if err != nil {
+				return nil, fmt.Errorf("frametool: line %v: %w", line, err)
+			}
+			frames = append(frames, packet)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case "raw":
+		packet, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, packet)
+	case "stream":
+		stream := frame.NewStreamReader(r)
+		for {
+			packet, err := stream.ReadFrame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			frames = append(frames, append([]byte(nil), packet...))
+		}
+	default:
+		return nil, errFormat
+	}
+	frames, err := unbundle(frames)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]*input, 0, len(frames))
+	for _, packet := range frames {
+		if len(filter.GameIDs) != 0 || len(filter.ClientIDs) != 0 {
+			gameID, clientID, _ := frame.PeekIDs(packet)
+			if !filter.Match(&frame.CaptureRecord{GameID: gameID, ClientID: clientID}) {
+				continue
+			}
+		}
+		inputs = append(inputs, &input{packet: packet})
+	}
+	return inputs, nil
+}
+
+// parseLine decodes a hex or base64 line, hex bytes may be separated by spaces or colons
+func parseLine(format, text string) ([]byte, error) {
+	if format == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	text = strings.NewReplacer(" ", "", "\t", "", ":", "").Replace(text)
+	return hex.DecodeString(strings.TrimPrefix(text, "0x"))
+}
+
+func unbundle(frames [][]byte) ([][]byte, error) {
+	unbundled := make([][]byte, 0, len(frames))
+	for i, packet := range frames {
+		if !frame.IsBundle(packet) {
+			unbundled = append(unbundled, packet)
+			continue
+		}
+		bundled, err := frame.Unbundle(packet)
+		if err != nil {
+			return nil, fmt.Errorf("frametool: frame %v: %w", i, err)
+		}
+		unbundled = append(unbundled, bundled...)
+	}
+	return unbundled, nil
+}
+
+// decode writes the frames as a JSON array, frames that can not be decoded are reported to stderr
+func decode(frames []*input, epoch int64, out io.Writer) error {
+	packets := make([]*jsonPacket, 0, len(frames))
+	var failed error
+	for i, f := range frames {
+		p, err := frame.Decode(f.packet)
+		if err != nil {
+			log.Printf("frame %v%v: %v\n", i, describe(f.record), frame.Inspect(f.packet))
+			failed = errInvalidAny
+			continue
+		}
+		if epoch != 0 {
+			p.Rebase(time.Unix(0, epoch))
+		}
+		j := toJSON(p)
+		if f.record != nil {
+			j.Capture = toJSONCapture(f.record)
+		}
+		packets = append(packets, j)
+	}
+	encoded, err := json.MarshalIndent(packets, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(encoded))
+	if err != nil {
+		return err
+	}
+	return failed
+}
+
+// encode reads a JSON packet or an array of them and writes their frames
+func encode(r io.Reader, format string, out io.Writer) error {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var packets []*jsonPacket
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '{' {
+		raw = append(append([]byte{'['}, raw...), ']')
+	}
+	// misspelled fields would silently encode zero values
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&packets)
+	if err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errTrailingJSON
+	}
+	stream := frame.NewStreamWriter(out)
+	for i, j := range packets {
+		p, err := fromJSON(j)
+		if err != nil {
+			return fmt.Errorf("frametool: packet %v: %w", i, err)
+		}
+		packet, err := frame.Encode(p)
+		if err != nil {
+			return fmt.Errorf("frametool: packet %v: %w", i, err)
+		}
+		switch format {
+		case "hex":
+			_, err = fmt.Fprintln(out, hex.EncodeToString(packet))
+		case "base64":
+			_, err = fmt.Fprintln(out, base64.StdEncoding.EncodeToString(packet))
+		case "raw":
+			_, err = out.Write(packet)
+		case "stream":
+			err = stream.WriteFrame(packet)
+		default:
+			return errFormat
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate reports every frame, malformed ones with the field that is malformed
+func validate(frames []*input, out io.Writer) error {
+	var failed error
+	for i, f := range frames {
+		err := frame.Inspect(f.packet)
+		if err != nil {
+			failed = errInvalidAny
+			fmt.Fprintf(out, "frame %v%v: %v\n", i, describe(f.record), err)
+			continue
+		}
+		fmt.Fprintf(out, "frame %v%v: ok\n", i, describe(f.record))
+	}
+	return failed
+}
+
+// describe is the time, direction and peer of a captured frame
+func describe(record *frame.CaptureRecord) string {
+	if record == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (%v %v %v)", record.Time.Format(time.RFC3339Nano), directionName(record.Direction), record.Peer)
+}
@@ -3,12 +3,22 @@ package main
 import (
 	"fmt"
 	"gameserver/config"
+	"gameserver/events"
+	"gameserver/frame"
 	"gameserver/server"
 	"gameserver/utils"
+	"log"
 )
 
 func main() {
 
+	// game events are shared with clients, see /events
+	err := events.Register(frame.DefaultRegistry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	events.RegisterCompression()
+
 	s := server.NewServer()
 
 	// to catch SIGINT SIGTERM SIGQUIT
@@ -25,6 +35,11 @@ func main() {
 	go s.GameRouter(config.ServerListenAddress, config.UDPPort)
 
 	fmt.Println("Game router is on!")
+	if config.StreamFrames {
+		// tcp stream server for clients that can not use udp
+		go s.StreamRouter(config.ServerListenAddress, config.StreamPort)
+		fmt.Println("Stream router is on!")
+	}
 	// to block main thread
 	utils.Halt()
 }
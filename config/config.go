@@ -17,7 +17,121 @@ const (
 	// client simulation must change its udp listen port to avoid port collision
 	Simulation bool = true
 
+	// legacy clients sends frames without version header.
+	// when false those frames are rejected by the game router
+	AcceptLegacyFrames bool = true
+
+	// game events that are not registered into the event registry
+	// are relayed as data events unless this flag is set
+	RejectUnknownEvents bool = false
+
+	// reliable packets are checked for retransmission every tick,
+	// the connection is given up when one is not acked after max attempts
+	ResendTickMillisecond int = 50
+	MaxResendAttempt      int = 10
+
+	// frames larger than MTU are fragmented. incomplete fragmented frames
+	// are dropped after timeout, buffered fragments are limited per receiver
+	MTU                        int = 1200
+	FragmentTimeoutMillisecond int = 1000
+	ReassemblyBufferSize       int = 4 << 20
+
+	// versioned frames are sent with a CRC32C trailer,
+	// inbound frames with a trailer are always verified.
+	// encrypted frames are already authenticated and are sent without it
+	FrameChecksum bool = true
+
+	// UDP frames are encrypted with a session key exchanged by the matcher.
+	// when set, clients must send a public key after the auth token
+	// and unencrypted frames are rejected by the game router
+	EncryptFrames bool = true
+
+	// frame compression is negotiated by the matcher when set,
+	// clients offer compressors after the public key and the server picks one
+	CompressFrames bool = true
+
+	// clients ask for compact frames after the compression offer,
+	// the matcher answers with the session epoch that compact time stamps are relative to
+	CompactFrames bool = true
+
+	// world state of a game is sent every snapshot tick as a delta
+	// against the last snapshot acked by the client. sent and received snapshots
+	// are kept as baselines for the last history size ticks
+	SnapshotTickMillisecond int = 100
+	SnapshotHistorySize     int = 32
+
+	// versioned frames sent to a peer are coalesced into datagrams up to the MTU,
+	// pending frames are flushed every coalesce tick or when the next one does not fit
+	CoalesceFrames          bool = true
+	CoalesceTickMillisecond int  = 10
+
+	// game router also accepts frames over TCP streams on the stream port for clients
+	// that can not use UDP. a client registered over a stream receives its frames on it
+	StreamFrames bool   = true
+	StreamPort   string = "9080"
+
+	// traffic of the game router is recorded into this capture file when it is set
+	CaptureFile string = ""
+
+	// matcher authenticates game requests with "token", "file" or "http" authenticator
+	// and accepts players that are allowed to join GameMode.
+	// requests are read and authenticated concurrently, a request that is not read
+	// within the match timeout is dropped
+	Authenticator           string = "token"
+	GameMode                uint8  = 0
+	MatchTimeoutMillisecond int    = 5000
+
+	// token authenticator accepts tokens signed by a key of TokenKeys.
+	// new tokens are signed with the signing key, tokens of the other keys are still accepted
+	// so keys can be rotated
+	TokenSigningKeyID   uint8 = 1
+	TokenLifetimeSecond int   = 3600
+
+	// file authenticator reads the players from a credentials file
+	CredentialsFile string = "credentials.txt"
+
+	// http authenticator posts credentials to a local introspection endpoint
+	IntrospectionURL                string = "http://127.0.0.1:8081/introspect"
+	IntrospectionTimeoutMillisecond int    = 500
+
+	// simulated clients send these credentials instead of a token when they are set
+	ClientCredentials string = ""
+
+	// matcher answers a random session ticket after game and client IDs and
+	// register events must present it, a ticket registers a client only once.
+	// legacy frames can not carry a ticket, legacy clients can not register when it is set
+	SessionTickets bool = true
+
+	// game router pins a client to the address it registered from. packets whose client ID
+	// does not belong to the sender address are dropped, or relayed as the client
+	// of the address when SpoofPolicy is "flag"
+	PinClientAddress bool   = true
+	SpoofPolicy      string = "drop"
+
+	// token bucket limits, rate is the refill per second and burst is the bucket size.
+	// game requests are limited per IP and UDP datagrams per address before they are decoded.
+	// decoded frames are limited per client and per game, a frame costs a token and a token per event.
+	// frames over the limit are dropped, the client is also disconnected
+	// when RateLimitPolicy is "disconnect". zero rate disables a limit
+	RequestsPerSecond     float64 = 1
+	RequestBurst          int     = 10
+	DatagramsPerSecond    float64 = 100
+	DatagramBurst         int     = 200
+	ClientEventsPerSecond float64 = 50
+	ClientEventBurst      int     = 100
+	GameEventsPerSecond   float64 = 200
+	GameEventBurst        int     = 400
+	RateLimitPolicy       string  = "drop"
+
 	MinGameOverTime int   = 10000
 	MaxGameOverTime int   = 15000
 	NullData        int32 = 0
 )
+
+var (
+	// token keys by key ID, they are shared with the token issuer.
+	// those are demonstration keys and must be replaced
+	TokenKeys map[uint8]string = map[uint8]string{
+		1: "demonstration token key 1",
+	}
+)
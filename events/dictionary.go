@@ -0,0 +1,46 @@
+package events
+
+import (
+	"gameserver/frame"
+	"time"
+)
+
+// DictionarySize is the size of the preset dictionary of frame compression
+const DictionarySize int = 512
+
+// RegisterCompression registers the dictionary compressor of game events.
+// dictionary is trained on fixed sample frames so every peer builds the same one
+func RegisterCompression() {
+	frame.RegisterCompressor(frame.NewFlateCompressor(frame.CompressionDictionary, Dictionary()))
+}
+
+// Dictionary trains a compression dictionary on sample frames of game events
+func Dictionary() []byte {
+	epoch := time.Unix(0, 1<<60)
+	samples := make([][]byte, 0, 64)
+	for i := 0; i < 64; i++ {
+		p := &frame.Packet{
+			Version:   frame.CurrentVersion,
+			ClientID:  uint16(i%4 + 1),
+			GameID:    uint16(i%8 + 1),
+			TimeStamp: epoch.Add(time.Duration(i) * time.Millisecond),
+		}
+		move := &Move{Position: []float32{float32(i), float32(64 - i), 0}}
+		move.Encode(p)
+		if i%2 == 0 {
+			hit := &Hit{Target: int32(i%4 + 1), Damage: float32(i % 10), Critical: i%10 == 0}
+			hit.Encode(p)
+		}
+		if i%3 == 0 {
+			chat := &Chat{Message: "gg"}
+			chat.Encode(p)
+		}
+		score := &Score{Score: int32(i)}
+		score.Encode(p)
+		sample, err := frame.Encode(p)
+		if err == nil {
+			samples = append(samples, sample)
+		}
+	}
+	return frame.TrainDictionary(samples, DictionarySize)
+}
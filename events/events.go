@@ -0,0 +1,5 @@
+// Package events holds the game events shared by server and clients.
+// events are defined in events.json, run go generate after changing it
+package events
+
+//go:generate go run ../cmd/eventgen -in events.json -out events_gen.go
@@ -0,0 +1,246 @@
+// Code generated by eventgen from events.json. DO NOT EDIT.
+
+package events
+
+import (
+	"encoding/binary"
+	"fmt"
+	"gameserver/frame"
+	"math"
+)
+
+const (
+	MoveID  uint8 = 16
+	HitID   uint8 = 17
+	ChatID  uint8 = 18
+	ScoreID uint8 = 19
+)
+
+// Register adds all events of this package into the registry
+func Register(r *frame.Registry) error {
+	specs := []frame.EventSpec{
+		{
+			ID:        MoveID,
+			Name:      "move",
+			Payload:   frame.PayloadVector,
+			Direction: frame.ClientToServer,
+			Delivery:  frame.Unreliable,
+			Validate: func(ev *frame.Event) error {
+				return (&Move{}).DecodeEvent(ev)
+			},
+		},
+		{
+			ID:        HitID,
+			Name:      "hit",
+			Payload:   frame.PayloadBytes,
+			Direction: frame.ClientToServer,
+			Delivery:  frame.ReliableUnordered,
+			Validate: func(ev *frame.Event) error {
+				return (&Hit{}).DecodeEvent(ev)
+			},
+		},
+		{
+			ID:        ChatID,
+			Name:      "chat",
+			Payload:   frame.PayloadString,
+			Direction: frame.Bidirectional,
+			Delivery:  frame.ReliableOrdered,
+			Validate: func(ev *frame.Event) error {
+				return (&Chat{}).DecodeEvent(ev)
+			},
+		},
+		{
+			ID:        ScoreID,
+			Name:      "score",
+			Payload:   frame.PayloadInt32,
+			Direction: frame.ServerToClient,
+			Delivery:  frame.Unreliable,
+			Validate: func(ev *frame.Event) error {
+				return (&Score{}).DecodeEvent(ev)
+			},
+		},
+	}
+	for _, spec := range specs {
+		err := r.Register(spec)
+		if err != nil {
+			return fmt.Errorf("%v: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// Move is the new position of the player
+type Move struct {
+	Position []float32
+}
+
+// Event converts Move into a frame event
+func (e *Move) Event() *frame.Event {
+	return &frame.Event{ID: MoveID, Payload: frame.VectorPayload(e.Position...)}
+}
+
+// Encode appends Move to the packet events
+func (e *Move) Encode(p *frame.Packet) {
+	p.Events = append(p.Events, e.Event())
+}
+
+// DecodeEvent fills Move from a frame event
+func (e *Move) DecodeEvent(ev *frame.Event) error {
+	if ev.ID != MoveID {
+		return frame.ErrEventSchema
+	}
+	if !ev.IsTyped() {
+		return frame.ErrEventSchema
+	}
+	value, err := ev.Payload.Vector()
+	if err != nil {
+		return frame.ErrEventSchema
+	}
+	if len(value) > 3 {
+		return fmt.Errorf("position is longer than 3")
+	}
+	e.Position = value
+	return nil
+}
+
+// Decode fills Move from the first move event of the packet
+func (e *Move) Decode(p *frame.Packet) error {
+	for _, ev := range p.Events {
+		if ev.ID == MoveID {
+			return e.DecodeEvent(ev)
+		}
+	}
+	return frame.ErrEventNotFound
+}
+
+// Hit is a damage dealt to an other player
+type Hit struct {
+	Target   int32
+	Damage   float32
+	Critical bool
+}
+
+// Event converts Hit into a frame event
+func (e *Hit) Event() *frame.Event {
+	value := make([]byte, 9)
+	binary.LittleEndian.PutUint32(value[0:], uint32(e.Target))
+	binary.LittleEndian.PutUint32(value[4:], math.Float32bits(e.Damage))
+	if e.Critical {
+		value[8] = 1
+	}
+	return &frame.Event{ID: HitID, Payload: &frame.Payload{Type: frame.PayloadBytes, Value: value}}
+}
+
+// Encode appends Hit to the packet events
+func (e *Hit) Encode(p *frame.Packet) {
+	p.Events = append(p.Events, e.Event())
+}
+
+// DecodeEvent fills Hit from a frame event
+func (e *Hit) DecodeEvent(ev *frame.Event) error {
+	if ev.ID != HitID {
+		return frame.ErrEventSchema
+	}
+	if !ev.IsTyped() {
+		return frame.ErrEventSchema
+	}
+	value, err := ev.Payload.Bytes()
+	if err != nil || len(value) != 9 {
+		return frame.ErrEventSchema
+	}
+	e.Target = int32(binary.LittleEndian.Uint32(value[0:]))
+	e.Damage = math.Float32frombits(binary.LittleEndian.Uint32(value[4:]))
+	e.Critical = value[8] == 1
+	return nil
+}
+
+// Decode fills Hit from the first hit event of the packet
+func (e *Hit) Decode(p *frame.Packet) error {
+	for _, ev := range p.Events {
+		if ev.ID == HitID {
+			return e.DecodeEvent(ev)
+		}
+	}
+	return frame.ErrEventNotFound
+}
+
+// Chat is a chat message
+type Chat struct {
+	Message string
+}
+
+// Event converts Chat into a frame event
+func (e *Chat) Event() *frame.Event {
+	return &frame.Event{ID: ChatID, Payload: frame.StringPayload(e.Message)}
+}
+
+// Encode appends Chat to the packet events
+func (e *Chat) Encode(p *frame.Packet) {
+	p.Events = append(p.Events, e.Event())
+}
+
+// DecodeEvent fills Chat from a frame event
+func (e *Chat) DecodeEvent(ev *frame.Event) error {
+	if ev.ID != ChatID {
+		return frame.ErrEventSchema
+	}
+	if !ev.IsTyped() {
+		return frame.ErrEventSchema
+	}
+	value, err := ev.Payload.Text()
+	if err != nil {
+		return frame.ErrEventSchema
+	}
+	if len(value) > 256 {
+		return fmt.Errorf("message is longer than 256")
+	}
+	e.Message = value
+	return nil
+}
+
+// Decode fills Chat from the first chat event of the packet
+func (e *Chat) Decode(p *frame.Packet) error {
+	for _, ev := range p.Events {
+		if ev.ID == ChatID {
+			return e.DecodeEvent(ev)
+		}
+	}
+	return frame.ErrEventNotFound
+}
+
+// Score is the score of the player
+type Score struct {
+	Score int32
+}
+
+// Event converts Score into a frame event
+func (e *Score) Event() *frame.Event {
+	return &frame.Event{ID: ScoreID, Data: e.Score}
+}
+
+// Encode appends Score to the packet events
+func (e *Score) Encode(p *frame.Packet) {
+	p.Events = append(p.Events, e.Event())
+}
+
+// DecodeEvent fills Score from a frame event
+func (e *Score) DecodeEvent(ev *frame.Event) error {
+	if ev.ID != ScoreID {
+		return frame.ErrEventSchema
+	}
+	if ev.IsTyped() {
+		return frame.ErrEventSchema
+	}
+	e.Score = ev.Data
+	return nil
+}
+
+// Decode fills Score from the first score event of the packet
+func (e *Score) Decode(p *frame.Packet) error {
+	for _, ev := range p.Events {
+		if ev.ID == ScoreID {
+			return e.DecodeEvent(ev)
+		}
+	}
+	return frame.ErrEventNotFound
+}
@@ -0,0 +1,130 @@
+package frame
+
+import (
+	"errors"
+	"gameserver/utils"
+	"sync"
+)
+
+// Bundles coalesce several encoded frames into a single datagram
+// |-------------------------------------|-----------------|-----------------|
+// |           bundle header             |     frame       |     frame   ... |
+// |-------------------------------------|-----------------|-----------------|
+// |  magic  | bundle version | count    | length | bytes  | length | bytes  |
+// |-------------------------------------|-----------------|-----------------|
+// |  2byte  |     1byte      | 1byte    | 2byte  |  ...   | 2byte  |  ...   |
+// |-------------------------------------|-----------------|-----------------|
+// bundle version is reserved, no codec is registered for it.
+// frames are versioned frames or fragments, bundles are not nested
+
+const (
+	BundleVersion uint8 = 0xff
+
+	BundleHeaderSize int = 4
+	MaxBundleCount   int = 255
+
+	// length in front of every bundled frame
+	bundleLengthSize int = 2
+)
+
+var (
+	ErrInvalidBundle error = errors.New("frame: invalid bundle")
+	ErrNestedBundle  error = errors.New("frame: bundle inside a bundle")
+)
+
+// IsBundle reports datagrams that carry a bundle instead of a single frame
+func IsBundle(datagram []byte) bool {
+	return hasMagic(datagram) && len(datagram) >= VersionHeaderSize && datagram[2] == BundleVersion
+}
+
+// Unbundle returns the frames of a bundle, they refer to the datagram
+func Unbundle(datagram []byte) ([][]byte, error) {
+	if !IsBundle(datagram) || datagram[3] == 0 {
+		return nil, ErrInvalidBundle
+	}
+	frames := make([][]byte, 0, datagram[3])
+	rest := datagram[BundleHeaderSize:]
+	for i := 0; i < int(datagram[3]); i++ {
+		length, err := utils.ReadLE[uint16](rest)
+		if err != nil || length == 0 || len(rest) < bundleLengthSize+int(length) {
+			return nil, ErrInvalidBundle
+		}
+		packet := rest[bundleLengthSize : bundleLengthSize+int(length)]
+		if IsBundle(packet) {
+			return nil, ErrNestedBundle
+		}
+		frames = append(frames, packet)
+		rest = rest[bundleLengthSize+int(length):]
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidBundle
+	}
+	return frames, nil
+}
+
+// Bundler coalesces frames sent to a single peer into bundles that fit the MTU.
+// frames are copied and kept until Flush or until the next frame does not fit,
+// a bundle of a single frame is sent as the frame itself.
+// it is safe for concurrent use
+type Bundler struct {
+	mu      sync.Mutex
+	mtu     int
+	pending []byte
+	count   int
+}
+
+func NewBundler(mtu int) *Bundler {
+	return &Bundler{mtu: mtu}
+}
+
+// Add coalesces a frame and returns the datagrams that are ready to be sent.
+// frames that can not share a datagram are returned right away, they refer to packet
+func (b *Bundler) Add(packet []byte) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ready [][]byte
+	if BundleHeaderSize+bundleLengthSize+len(packet) > b.mtu {
+		// pending frames are sent first to keep the order
+		ready = appendDatagram(ready, b.flush())
+		return append(ready, packet)
+	}
+	if b.count == MaxBundleCount || len(b.pending)+bundleLengthSize+len(packet) > b.mtu {
+		ready = appendDatagram(ready, b.flush())
+	}
+	if b.count == 0 {
+		b.pending = append(make([]byte, 0, b.mtu), Magic[0], Magic[1], BundleVersion, 0)
+	}
+	b.pending = utils.AppendLE(b.pending, uint16(len(packet)))
+	b.pending = append(b.pending, packet...)
+	b.count++
+	return ready
+}
+
+// Flush returns the pending frames as a single datagram, nil when there is none
+func (b *Bundler) Flush() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush()
+}
+
+func (b *Bundler) flush() []byte {
+	bundle := b.pending
+	count := b.count
+	b.pending = nil
+	b.count = 0
+	switch count {
+	case 0:
+		return nil
+	case 1:
+		return bundle[BundleHeaderSize+bundleLengthSize:]
+	}
+	bundle[3] = uint8(count)
+	return bundle
+}
+
+func appendDatagram(datagrams [][]byte, datagram []byte) [][]byte {
+	if datagram == nil {
+		return datagrams
+	}
+	return append(datagrams, datagram)
+}
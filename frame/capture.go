@@ -0,0 +1,220 @@
+package frame
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"gameserver/utils"
+	"io"
+	"sync"
+	"time"
+)
+
+// Capture files record the frames of a peer as they are sent and received.
+// file starts with a header and continues with records until the end of file
+// |-----------------------------|
+// |  magic  | capture version   |
+// |-----------------------------|
+// |  4byte  |     1byte         |
+// |-----------------------------|
+// |---------------------------------------------------------------------------------------------|
+// |  time  | direction | gameID | clientID | peer length | peer   | frame length |    frame     |
+// |---------------------------------------------------------------------------------------------|
+// | 8byte  |   1byte   | 2byte  |  2byte   |    1byte    |  ...   |    4byte     |     ...      |
+// |---------------------------------------------------------------------------------------------|
+// time is unix nano, peer is the UDP address of the other side.
+// frames are recorded as they are before sealing, they may be bundles or fragments
+
+const (
+	CaptureVersion uint8 = 1
+
+	CaptureHeaderSize int = 5
+	// fixed part of a record in front of the peer
+	captureRecordSize int = 14
+	maxCapturePeer    int = 255
+)
+
+var (
+	CaptureMagic = [4]byte{'G', 'S', 'C', 'P'}
+
+	ErrCaptureHeader error = errors.New("frame: not a capture file")
+	ErrCaptureRecord error = errors.New("frame: invalid capture record")
+)
+
+// CaptureRecord is a single frame of a capture
+type CaptureRecord struct {
+	Time      time.Time
+	Direction Direction
+	// game and client on the other side, zero when they are not known
+	GameID   uint16
+	ClientID uint16
+	Peer     string
+	Frame    []byte
+}
+
+// CaptureFilter selects records by game and client IDs, empty lists select all
+type CaptureFilter struct {
+	GameIDs   []uint16
+	ClientIDs []uint16
+}
+
+func (f CaptureFilter) Match(r *CaptureRecord) bool {
+	return matchID(f.GameIDs, r.GameID) && matchID(f.ClientIDs, r.ClientID)
+}
+
+func matchID(ids []uint16, id uint16) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, selected := range ids {
+		if selected == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CaptureWriter writes capture records, every record is written with a single write call.
+// it is safe for concurrent use
+type CaptureWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	buffer []byte
+}
+
+// NewCaptureWriter writes the capture header
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	_, err := w.Write(append(CaptureMagic[:], CaptureVersion))
+	if err != nil {
+		return nil, err
+	}
+	return &CaptureWriter{w: w}, nil
+}
+
+func (w *CaptureWriter) Write(r *CaptureRecord) error {
+	if len(r.Peer) > maxCapturePeer || len(r.Frame) > MaxFrameSize {
+		return ErrCaptureRecord
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	buffer := utils.AppendLE(w.buffer[:0], r.Time.UnixNano())
+	buffer = append(buffer, uint8(r.Direction))
+	buffer = utils.AppendLE(buffer, r.GameID)
+	buffer = utils.AppendLE(buffer, r.ClientID)
+	buffer = append(buffer, uint8(len(r.Peer)))
+	buffer = append(buffer, r.Peer...)
+	buffer = utils.AppendLE(buffer, uint32(len(r.Frame)))
+	buffer = append(buffer, r.Frame...)
+	w.buffer = buffer
+	_, err := w.w.Write(buffer)
+	return err
+}
+
+// CaptureReader reads the records of a capture in order
+type CaptureReader struct {
+	r      *bufio.Reader
+	filter CaptureFilter
+}
+
+// NewCaptureReader checks the capture header, filter selects the records that are returned
+func NewCaptureReader(r io.Reader, filter CaptureFilter) (*CaptureReader, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, CaptureHeaderSize)
+	_, err := io.ReadFull(reader, header)
+	if err != nil || !bytes.Equal(header[:len(CaptureMagic)], CaptureMagic[:]) || header[4] != CaptureVersion {
+		return nil, ErrCaptureHeader
+	}
+	return &CaptureReader{r: reader, filter: filter}, nil
+}
+
+// Next returns the next record that matches the filter, io.EOF after the last one.
+// a capture that ends inside a record fails with io.ErrUnexpectedEOF
+func (r *CaptureReader) Next() (*CaptureRecord, error) {
+	for {
+		record, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		if r.filter.Match(record) {
+			return record, nil
+		}
+	}
+}
+
+func (r *CaptureReader) read() (*CaptureRecord, error) {
+	fixed := make([]byte, captureRecordSize)
+	_, err := io.ReadFull(r.r, fixed)
+	if err != nil {
+		return nil, err
+	}
+	unixNano, _ := utils.ReadLE[int64](fixed)
+	record := &CaptureRecord{
+		Time:      time.Unix(0, unixNano),
+		Direction: Direction(fixed[8]),
+	}
+	record.GameID, _ = utils.ReadLE[uint16](fixed[9:])
+	record.ClientID, _ = utils.ReadLE[uint16](fixed[11:])
+	peer := make([]byte, fixed[13])
+	_, err = io.ReadFull(r.r, peer)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	record.Peer = string(peer)
+	var length [4]byte
+	_, err = io.ReadFull(r.r, length[:])
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	size, _ := utils.ReadLE[uint32](length[:])
+	if size > uint32(MaxFrameSize) {
+		return nil, ErrCaptureRecord
+	}
+	record.Frame = make([]byte, size)
+	_, err = io.ReadFull(r.r, record.Frame)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return record, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadCapture reads every record of a capture that matches the filter
+func ReadCapture(r io.Reader, filter CaptureFilter) ([]*CaptureRecord, error) {
+	reader, err := NewCaptureReader(r, filter)
+	if err != nil {
+		return nil, err
+	}
+	var records []*CaptureRecord
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// PeekIDs returns game and client IDs of a datagram, of its first frame when it is a bundle
+func PeekIDs(datagram []byte) (gameID, clientID uint16, err error) {
+	if IsBundle(datagram) {
+		frames, err := Unbundle(datagram)
+		if err != nil {
+			return 0, 0, err
+		}
+		datagram = frames[0]
+	}
+	p, err := Decode(datagram)
+	if err != nil {
+		return 0, 0, err
+	}
+	return p.GameID, p.ClientID, nil
+}
@@ -0,0 +1,45 @@
+package frame
+
+import (
+	"errors"
+	"gameserver/utils"
+	"hash/crc32"
+)
+
+// Frames with the checksum flag ends with a CRC32C trailer
+// |----------------------------------|-----------|
+// | version header | sections | body | checksum  |
+// |----------------------------------|-----------|
+// |                ...               |   4byte   |
+// |----------------------------------|-----------|
+// checksum covers every byte before the trailer and is checked before anything is read
+
+const (
+	FlagChecksum uint8 = 1 << 4
+
+	ChecksumSize int = 4
+)
+
+var (
+	ErrChecksum error = errors.New("frame: checksum mismatch")
+
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// appendChecksum appends the checksum of the frame that starts at start of dst
+func appendChecksum(dst []byte, start int) []byte {
+	return utils.AppendLE(dst, crc32.Checksum(dst[start:], castagnoli))
+}
+
+// verifyChecksum returns the frame without its trailer
+func verifyChecksum(packet []byte) ([]byte, error) {
+	if len(packet) < VersionHeaderSize+ChecksumSize {
+		return nil, ErrShortHeader
+	}
+	end := len(packet) - ChecksumSize
+	sum, _ := utils.ReadLE[uint32](packet[end:])
+	if sum != crc32.Checksum(packet[:end], castagnoli) {
+		return nil, ErrChecksum
+	}
+	return packet[:end], nil
+}
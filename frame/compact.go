@@ -0,0 +1,284 @@
+package frame
+
+import (
+	"errors"
+	"gameserver/utils"
+	"math"
+	"time"
+)
+
+// Compact frames has FlagCompact set and a bit packed body
+// |-------------------------------------------------------------------------|
+// | clientID | gameID  | time delta | number of event |  events...          |
+// |-------------------------------------------------------------------------|
+// | uvarint  | uvarint | varint     |    uvarint      | id (8bit) | type (4bit) | value |
+// |-------------------------------------------------------------------------|
+// varints are 7 bit groups with a continuation bit, signed ones are zig-zag encoded.
+// time is sent in milliseconds relative to the session epoch (Packet.Epoch).
+// values are packed by type:
+//   int32, int64   varint
+//   float32        flag bit, then quantized varint or raw 32 bits when it does not fit
+//   float64        raw 64 bits
+//   bool           1 bit
+//   bytes, string  uvarint length and bytes
+//   vector         uvarint count and float32 components
+// float32 values are quantized to 1/256, compact mode is lossy for them
+
+const (
+	FlagCompact uint8 = 1 << 7
+
+	compactTypeBits int = 4
+	// quantization step of float32 values is 1/compactFloatScale
+	compactFloatScale float64 = 256
+	// floats larger than this are sent raw
+	compactFloatLimit float64 = 1 << 24
+	maxCompactEvents  uint64  = 255
+)
+
+var (
+	ErrCompactBody error = errors.New("frame: invalid compact body")
+
+	// epoch of decoded compact packets until they are rebased to the session epoch
+	zeroEpoch time.Time = time.Unix(0, 0)
+)
+
+// Rebase moves the time stamp of a compact packet to the session epoch keeping its offset.
+// decoded compact packets are relative to unix zero time until they are rebased,
+// time stamps of other packets are absolute and they are not changed
+func (p *Packet) Rebase(epoch time.Time) {
+	if p.Flags&FlagCompact != 0 {
+		if p.Epoch.IsZero() {
+			p.Epoch = zeroEpoch
+		}
+		p.TimeStamp = epoch.Add(p.TimeStamp.Sub(p.Epoch))
+	}
+	p.Epoch = epoch
+}
+
+func writeCompactFloat(w *utils.BitWriter, v float32) {
+	scaled := math.Round(float64(v) * compactFloatScale)
+	if math.IsNaN(scaled) || math.Abs(scaled) > compactFloatLimit*compactFloatScale {
+		w.WriteBool(true)
+		w.WriteBits(uint64(math.Float32bits(v)), 32)
+		return
+	}
+	w.WriteBool(false)
+	w.WriteVarint(int64(scaled))
+}
+
+func readCompactFloat(r *utils.BitReader) (float32, error) {
+	raw, err := r.ReadBool()
+	if err != nil {
+		return 0, err
+	}
+	if raw {
+		bits, err := r.ReadBits(32)
+		return math.Float32frombits(uint32(bits)), err
+	}
+	scaled, err := r.ReadVarint()
+	if err != nil {
+		return 0, err
+	}
+	if math.Abs(float64(scaled)) > compactFloatLimit*compactFloatScale {
+		return 0, ErrCompactBody
+	}
+	return float32(float64(scaled) / compactFloatScale), nil
+}
+
+func appendCompact(dst []byte, p *Packet) ([]byte, error) {
+	w := utils.NewBitWriterTo(dst)
+	w.WriteUvarint(uint64(p.ClientID))
+	w.WriteUvarint(uint64(p.GameID))
+	epoch := p.Epoch
+	if epoch.IsZero() {
+		epoch = zeroEpoch
+	}
+	w.WriteVarint(int64(p.TimeStamp.Sub(epoch) / time.Millisecond))
+	if uint64(len(p.Events)) > maxCompactEvents {
+		return dst, ErrEventCountMismatch
+	}
+	w.WriteUvarint(uint64(len(p.Events)))
+	for _, e := range p.Events {
+		w.WriteBits(uint64(e.ID), 8)
+		if !e.IsTyped() {
+			w.WriteBits(uint64(PayloadInt32), compactTypeBits)
+			w.WriteVarint(int64(e.Data))
+			continue
+		}
+		err := e.Payload.Validate()
+		if err != nil {
+			return dst, err
+		}
+		w.WriteBits(uint64(e.Payload.Type), compactTypeBits)
+		err = writeCompactPayload(w, e.Payload)
+		if err != nil {
+			return dst, err
+		}
+	}
+	return w.Bytes(), nil
+}
+
+func writeCompactPayload(w *utils.BitWriter, p *Payload) error {
+	switch p.Type {
+	case PayloadInt32:
+		v, _ := p.Int32()
+		w.WriteVarint(int64(v))
+	case PayloadInt64:
+		v, _ := p.Int64()
+		w.WriteVarint(v)
+	case PayloadFloat32:
+		v, _ := p.Float32()
+		writeCompactFloat(w, v)
+	case PayloadFloat64:
+		v, _ := p.Float64()
+		w.WriteBits(math.Float64bits(v), 64)
+	case PayloadBool:
+		v, _ := p.Bool()
+		w.WriteBool(v)
+	case PayloadBytes, PayloadString:
+		w.WriteUvarint(uint64(len(p.Value)))
+		w.WriteBytes(p.Value)
+	case PayloadVector:
+		// components are read in place, Vector would allocate them
+		w.WriteUvarint(uint64(len(p.Value) / 4))
+		for i := 0; i+4 <= len(p.Value); i += 4 {
+			c, _ := utils.ReadLE[float32](p.Value[i:])
+			writeCompactFloat(w, c)
+		}
+	default:
+		return ErrInvalidPayload
+	}
+	return nil
+}
+
+// validateCompact checks a compact body by decoding it, bit packed fields can not be checked in place
+func validateCompact(body []byte) error {
+	return unmarshalCompact(body, &Packet{})
+}
+
+// unmarshalCompact decodes a compact body into p, the packet is relative to zero epoch
+func unmarshalCompact(body []byte, p *Packet) error {
+	if len(body) > MaxFrameSize {
+		return ErrOversize
+	}
+	r := utils.NewBitReader(body)
+	clientID, err := r.ReadUvarint()
+	if err != nil || clientID > math.MaxUint16 {
+		return ErrShortHeader
+	}
+	gameID, err := r.ReadUvarint()
+	if err != nil || gameID > math.MaxUint16 {
+		return ErrShortHeader
+	}
+	delta, err := r.ReadVarint()
+	if err != nil {
+		return ErrShortHeader
+	}
+	if delta > math.MaxInt64/int64(time.Millisecond) || delta < math.MinInt64/int64(time.Millisecond) {
+		return ErrCompactBody
+	}
+	n, err := r.ReadUvarint()
+	if err != nil {
+		return ErrShortHeader
+	}
+	if n > maxCompactEvents {
+		return ErrEventCountMismatch
+	}
+	for i := uint64(0); i < n; i++ {
+		err = readCompactEvent(r, nextEvent(p))
+		if err != nil {
+			return err
+		}
+	}
+	// only the zero padding of the last byte may be left
+	if r.Remaining() >= 8 {
+		return ErrTrailingBytes
+	}
+	if padding, _ := r.ReadBits(r.Remaining()); padding != 0 {
+		return ErrCompactBody
+	}
+	p.ClientID = uint16(clientID)
+	p.GameID = uint16(gameID)
+	p.Epoch = zeroEpoch
+	p.TimeStamp = zeroEpoch.Add(time.Duration(delta) * time.Millisecond)
+	return nil
+}
+
+func readCompactEvent(r *utils.BitReader, e *Event) error {
+	id, err := r.ReadBits(8)
+	if err != nil {
+		return ErrEventCountMismatch
+	}
+	t, err := r.ReadBits(compactTypeBits)
+	if err != nil {
+		return ErrEventCountMismatch
+	}
+	e.ID = uint8(id)
+	e.Data = 0
+	switch PayloadType(t) {
+	case PayloadInt32:
+		v, err := r.ReadVarint()
+		if err != nil || v < math.MinInt32 || v > math.MaxInt32 {
+			return ErrInvalidPayload
+		}
+		e.Data = int32(v)
+		e.Payload = nil
+	case PayloadInt64:
+		v, err := r.ReadVarint()
+		if err != nil {
+			return ErrInvalidPayload
+		}
+		utils.PutLE(reusePayload(e, PayloadInt64, 8), v)
+	case PayloadFloat32:
+		v, err := readCompactFloat(r)
+		if err != nil {
+			return ErrInvalidPayload
+		}
+		utils.PutLE(reusePayload(e, PayloadFloat32, 4), v)
+	case PayloadFloat64:
+		bits, err := r.ReadBits(64)
+		if err != nil {
+			return ErrInvalidPayload
+		}
+		utils.PutLE(reusePayload(e, PayloadFloat64, 8), bits)
+	case PayloadBool:
+		v, err := r.ReadBool()
+		if err != nil {
+			return ErrInvalidPayload
+		}
+		value := reusePayload(e, PayloadBool, 1)
+		value[0] = 0
+		if v {
+			value[0] = 1
+		}
+	case PayloadBytes, PayloadString:
+		length, err := r.ReadUvarint()
+		if err != nil || length > uint64(MaxPayloadSize) || 8*length > uint64(r.Remaining()) {
+			return ErrInvalidPayload
+		}
+		err = r.ReadBytesInto(reusePayload(e, PayloadType(t), int(length)))
+		if err != nil {
+			return ErrInvalidPayload
+		}
+	case PayloadVector:
+		count, err := r.ReadUvarint()
+		if err != nil || count > uint64(MaxPayloadSize/4) {
+			return ErrInvalidPayload
+		}
+		// every component takes at least 9 bits
+		if int(count)*9 > r.Remaining() {
+			return ErrInvalidPayload
+		}
+		value := reusePayload(e, PayloadVector, 4*int(count))
+		for i := 0; i < int(count); i++ {
+			v, err := readCompactFloat(r)
+			if err != nil {
+				return ErrInvalidPayload
+			}
+			utils.PutLE(value[4*i:], v)
+		}
+	default:
+		return ErrInvalidPayload
+	}
+	return nil
+}
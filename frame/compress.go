@@ -0,0 +1,224 @@
+package frame
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Compressed frames carries a compression section after the other sections
+// |-------------|
+// | compressor  |
+// |-------------|
+// |   1byte     |
+// |-------------|
+// body (events and time stamp) is compressed, header sections stay as they are.
+// senders ask for a compressor with Packet.Compression,
+// the frame is compressed only when it gets smaller
+
+const (
+	FlagCompressed uint8 = 1 << 6
+
+	CompressionHeaderSize int = 1
+
+	// compressor IDs, zero means no compression
+	CompressionNone       uint8 = 0
+	CompressionFlate      uint8 = 1
+	CompressionDictionary uint8 = 2
+
+	// substring length counted by the dictionary trainer
+	dictionaryGram int = 8
+)
+
+var (
+	ErrUnsupportedCompression error = errors.New("frame: unsupported compression")
+	ErrCompressedBody         error = errors.New("frame: invalid compressed body")
+
+	compressors   = map[uint8]Compressor{}
+	compressorsMu sync.RWMutex
+)
+
+// Compressor compresses frame bodies.
+// both peers must register a compressor with the same ID and settings
+type Compressor interface {
+	ID() uint8
+	Compress(src []byte) ([]byte, error)
+	// Decompress fails when the output exceeds limit
+	Decompress(src []byte, limit int) ([]byte, error)
+}
+
+func init() {
+	RegisterCompressor(NewFlateCompressor(CompressionFlate, nil))
+}
+
+// RegisterCompressor adds or replaces the compressor of an ID
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[c.ID()] = c
+}
+
+func LookupCompressor(id uint8) (Compressor, bool) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	c, exists := compressors[id]
+	return c, exists
+}
+
+// Compressors returns registered compressor IDs in preference order,
+// higher IDs are the more specialized ones and are preferred
+func Compressors() []uint8 {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	ids := make([]uint8, 0, len(compressors))
+	for id := range compressors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return ids
+}
+
+// NegotiateCompression picks the first offered compressor that is registered.
+// offers are in the preference order of the peer
+func NegotiateCompression(offered []uint8) uint8 {
+	for _, id := range offered {
+		if _, exists := LookupCompressor(id); exists && id != CompressionNone {
+			return id
+		}
+	}
+	return CompressionNone
+}
+
+func readCompression(section []byte, p *Packet) {
+	p.Compression = section[0]
+}
+
+func writeCompression(dst []byte, p *Packet) []byte {
+	return append(dst, p.Compression)
+}
+
+func validateCompression(section []byte) error {
+	if _, exists := LookupCompressor(section[0]); !exists {
+		return ErrUnsupportedCompression
+	}
+	return nil
+}
+
+// compressBody returns nil when compression does not make the body smaller
+func compressBody(id uint8, body []byte) ([]byte, error) {
+	c, exists := LookupCompressor(id)
+	if !exists {
+		return nil, ErrUnsupportedCompression
+	}
+	compressed, err := c.Compress(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed)+CompressionHeaderSize >= len(body) {
+		return nil, nil
+	}
+	return compressed, nil
+}
+
+func decompressBody(id uint8, body []byte) ([]byte, error) {
+	c, exists := LookupCompressor(id)
+	if !exists {
+		return nil, ErrUnsupportedCompression
+	}
+	return c.Decompress(body, MaxFrameSize)
+}
+
+// flateCompressor is DEFLATE with an optional preset dictionary.
+// writers are expensive to create so they are pooled
+type flateCompressor struct {
+	id      uint8
+	dict    []byte
+	writers sync.Pool
+}
+
+// NewFlateCompressor creates a DEFLATE compressor.
+// a dictionary trained on typical frames helps small frames that share little with themselves
+func NewFlateCompressor(id uint8, dict []byte) Compressor {
+	c := &flateCompressor{
+		id:   id,
+		dict: dict,
+	}
+	c.writers.New = func() interface{} {
+		w, _ := flate.NewWriterDict(nil, flate.BestCompression, c.dict)
+		return w
+	}
+	return c
+}
+
+func (c *flateCompressor) ID() uint8 {
+	return c.id
+}
+
+func (c *flateCompressor) Compress(src []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	w := c.writers.Get().(*flate.Writer)
+	defer c.writers.Put(w)
+	w.Reset(&buffer)
+	_, err := w.Write(src)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (c *flateCompressor) Decompress(src []byte, limit int) ([]byte, error) {
+	r := flate.NewReaderDict(bytes.NewReader(src), c.dict)
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, ErrCompressedBody
+	}
+	if len(out) > limit {
+		return nil, ErrOversize
+	}
+	return out, nil
+}
+
+// TrainDictionary builds a preset dictionary of at most size bytes from sample frames.
+// substrings repeated across samples are collected, the most common ones are placed last
+// since DEFLATE reaches the end of the dictionary with the shortest distances.
+// result only depends on samples, so peers training on the same samples get the same dictionary
+func TrainDictionary(samples [][]byte, size int) []byte {
+	counts := map[string]int{}
+	for _, sample := range samples {
+		seen := map[string]bool{}
+		for i := 0; i+dictionaryGram <= len(sample); i++ {
+			gram := string(sample[i : i+dictionaryGram])
+			if !seen[gram] {
+				seen[gram] = true
+				counts[gram]++
+			}
+		}
+	}
+	grams := make([]string, 0, len(counts))
+	for gram, n := range counts {
+		if n > 1 {
+			grams = append(grams, gram)
+		}
+	}
+	// ascending by count, ties in byte order
+	sort.Slice(grams, func(i, j int) bool {
+		if counts[grams[i]] != counts[grams[j]] {
+			return counts[grams[i]] < counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+	dict := make([]byte, 0, size)
+	for i := len(grams) - 1; i >= 0 && len(dict)+dictionaryGram <= size; i-- {
+		// most common grams are taken first, each next one goes in front
+		dict = append([]byte(grams[i]), dict...)
+	}
+	return dict
+}
@@ -0,0 +1,98 @@
+package frame
+
+import "errors"
+
+var (
+	// decode errors, each one is a distinct reject reason
+	ErrShortHeader        error = errors.New("frame: packet shorter than header")
+	ErrEventCountMismatch error = errors.New("frame: number of event does not match payload size")
+	ErrTrailingBytes      error = errors.New("frame: trailing bytes after time stamp")
+	ErrOversize           error = errors.New("frame: packet exceeds max packet size")
+)
+
+// Validate checks a raw packet strictly before any field is read.
+// checks are done by the codec of the packet version
+func Validate(packet []byte) error {
+	codec, err := codecOf(packet)
+	if err != nil {
+		return err
+	}
+	return codec.Validate(packet)
+}
+
+// Decode converts a packet into a packet object.
+// it never panics, malformed packets are reported with one of the decode errors
+func Decode(packet []byte) (*Packet, error) {
+	p := &Packet{}
+	err := DecodeInto(packet, p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DecodeInto decodes packet into an existing packet object.
+// events and payloads of p are reused, so nothing decoded before into p must be kept.
+// decoded packet never refers to the packet buffer, p is undefined when an error is returned
+func DecodeInto(packet []byte, p *Packet) error {
+	codec, err := codecOf(packet)
+	if err != nil {
+		return err
+	}
+	return codec.DecodeInto(packet, p)
+}
+
+// Encode converts a packet object into a packet with the codec of its version
+func Encode(p *Packet) ([]byte, error) {
+	packet, err := AppendMarshal(make([]byte, 0, encodedSizeHint(p)), p)
+	if err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// encodedSizeHint is a capacity that usually fits the encoded packet
+func encodedSizeHint(p *Packet) int {
+	size := v1HeaderSize(v1Flags) + MinPacketSize + ChecksumSize
+	for _, e := range p.Events {
+		size += TypedEventHeaderSize + PackSizeOf.Data
+		if e.Payload != nil {
+			size += len(e.Payload.Value)
+		}
+	}
+	if p.Fragment != nil {
+		size += len(p.Fragment.Data)
+	}
+	return size
+}
+
+func codecOf(packet []byte) (Codec, error) {
+	version, err := PeekVersion(packet)
+	if err != nil {
+		return nil, err
+	}
+	codec, exists := codecs[version]
+	if !exists {
+		return nil, ErrUnsupportedVersion
+	}
+	return codec, nil
+}
+
+// validateLegacy checks the legacy layout.
+// number of event byte must describe exactly the bytes in between header and time stamp
+func validateLegacy(packet []byte) error {
+	if len(packet) < HeaderSize {
+		return ErrShortHeader
+	}
+	if len(packet) > MaxPacketSize {
+		return ErrOversize
+	}
+	expected := MinPacketSize + int(getNOF(packet))*EventPacketSize
+	if len(packet) < expected {
+		return ErrEventCountMismatch
+	}
+	if len(packet) > expected {
+		return ErrTrailingBytes
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package frame
+
+import (
+	"errors"
+	"gameserver/utils"
+	"sync"
+	"time"
+)
+
+// Frames larger than the MTU are split into fragment frames.
+// a fragment frame has FlagFragment set and carries a slice of the encoded frame
+// |-----------------------------------|-------------------|---------------|
+// |         fragment section          |       header      |    chunk      |
+// |-----------------------------------|-------------------|---------------|
+// | fragment ID | index   | count     | clientID | gameID |  frame bytes  |
+// |-----------------------------------|-------------------|---------------|
+// |    2byte    | 1byte   | 1byte     |  2byte   | 2byte  |   ...         |
+// |-----------------------------------|-------------------|---------------|
+// fragment frames are not sequenced, the frame they carry is
+
+const (
+	FlagFragment uint8 = 1 << 3
+
+	FragmentHeaderSize int = 4
+	MaxFragmentCount   int = 255
+
+	// bookkeeping of a buffered chunk, a slice header on 64 bit hosts.
+	// it is counted against the reassembly buffer with the chunk
+	chunkHeaderSize int = 24
+)
+
+var (
+	ErrInvalidFragment error = errors.New("frame: invalid fragment")
+	ErrTooManyFragment error = errors.New("frame: frame needs too many fragments")
+	ErrNestedFragment  error = errors.New("frame: fragment inside a fragmented frame")
+	ErrReassemblyFull  error = errors.New("frame: reassembly buffer is full")
+)
+
+// Fragment is a slice of a fragmented frame.
+// fields other than Data are the fragment section
+type Fragment struct {
+	ID    uint16
+	Index uint8
+	Count uint8
+	Data  []byte `le:"-"`
+}
+
+func readFragment(section []byte, p *Packet) {
+	p.Fragment = &Fragment{}
+	utils.ReadStruct(section, p.Fragment)
+}
+
+func writeFragment(dst []byte, p *Packet) []byte {
+	dst, _ = utils.AppendStruct(dst, p.Fragment)
+	return dst
+}
+
+func validateFragment(section []byte) error {
+	if section[3] == 0 || section[2] >= section[3] {
+		return ErrInvalidFragment
+	}
+	return nil
+}
+
+// fragmentBodySize is the size of header in front of fragment chunk
+const fragmentBodySize int = 4
+
+func validateFragmentBody(body []byte) error {
+	if len(body) <= fragmentBodySize {
+		return ErrInvalidFragment
+	}
+	return nil
+}
+
+func appendFragmentBody(dst []byte, p *Packet) []byte {
+	dst = utils.AppendLE(dst, p.ClientID)
+	dst = utils.AppendLE(dst, p.GameID)
+	return append(dst, p.Fragment.Data...)
+}
+
+func unmarshalFragmentBody(body []byte, p *Packet) {
+	p.ClientID = GetClientID(body)
+	p.GameID = GetGameID(body)
+	p.Fragment.Data = append([]byte{}, body[fragmentBodySize:]...)
+}
+
+// Split divides an encoded frame into fragment frames that fit mtu.
+// frames that already fit are returned as they are,
+// fragments of a frame with checksum have their own checksum
+func Split(packet []byte, clientID, gameID, fragmentID uint16, mtu int) ([][]byte, error) {
+	if len(packet) <= mtu {
+		return [][]byte{packet}, nil
+	}
+	flags := FlagFragment
+	overhead := VersionHeaderSize + FragmentHeaderSize + fragmentBodySize
+	if hasMagic(packet) && len(packet) >= VersionHeaderSize && packet[3]&FlagChecksum != 0 {
+		flags |= FlagChecksum
+		overhead += ChecksumSize
+	}
+	chunkSize := mtu - overhead
+	if chunkSize <= 0 {
+		return nil, ErrTooManyFragment
+	}
+	count := (len(packet) + chunkSize - 1) / chunkSize
+	if count > MaxFragmentCount {
+		return nil, ErrTooManyFragment
+	}
+	fragments := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(packet) {
+			end = len(packet)
+		}
+		fragment, err := Encode(&Packet{
+			Version:  Version1,
+			Flags:    flags,
+			ClientID: clientID,
+			GameID:   gameID,
+			Fragment: &Fragment{
+				ID:    fragmentID,
+				Index: uint8(i),
+				Count: uint8(count),
+				Data:  packet[i*chunkSize : end],
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, fragment)
+	}
+	return fragments, nil
+}
+
+// ReassemblyStats is the reassembly statistics of a receiver
+type ReassemblyStats struct {
+	Completed uint64
+	// incomplete frames dropped after timeout
+	Expired uint64
+	// fragments dropped because of the memory limit
+	Dropped uint64
+	// bytes held by incomplete frames, chunk bookkeeping included
+	Buffered int
+}
+
+type reassemblyKey struct {
+	source string
+	id     uint16
+}
+
+type reassembly struct {
+	chunks   [][]byte
+	received int
+	// frame bytes received and bytes counted against the reassembly buffer
+	size    int
+	used    int
+	started time.Time
+}
+
+// Reassembler collects fragments until their frame is complete.
+// incomplete frames are dropped after timeout, buffered bytes are limited by maxBytes.
+// it is safe for concurrent use
+type Reassembler struct {
+	mu       sync.Mutex
+	buffers  map[reassemblyKey]*reassembly
+	timeout  time.Duration
+	maxBytes int
+	used     int
+	// incomplete frames are looked for once per half timeout, not on every fragment
+	expired time.Time
+	stats   ReassemblyStats
+}
+
+func NewReassembler(timeout time.Duration, maxBytes int) *Reassembler {
+	return &Reassembler{
+		buffers:  make(map[reassemblyKey]*reassembly),
+		timeout:  timeout,
+		maxBytes: maxBytes,
+	}
+}
+
+// Add buffers a fragment sent by source.
+// returns the encoded frame when its last fragment arrives, nil until then.
+// a fragment is checked against the memory limit before anything is buffered for it
+func (r *Reassembler) Add(source string, p *Packet) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.expired) >= r.timeout/2 {
+		r.expire(now)
+	}
+
+	f := p.Fragment
+	if f.Count == 0 || f.Index >= f.Count {
+		return nil, ErrInvalidFragment
+	}
+	key := reassemblyKey{source: source, id: f.ID}
+	buffer, exists := r.buffers[key]
+	cost := len(f.Data)
+	if exists {
+		if len(buffer.chunks) != int(f.Count) {
+			return nil, ErrInvalidFragment
+		}
+		if buffer.chunks[f.Index] != nil {
+			return nil, ErrDuplicate
+		}
+	} else {
+		cost += int(f.Count) * chunkHeaderSize
+	}
+	if r.used+cost > r.maxBytes {
+		r.stats.Dropped++
+		return nil, ErrReassemblyFull
+	}
+	if !exists {
+		buffer = &reassembly{
+			chunks:  make([][]byte, f.Count),
+			started: now,
+		}
+		r.buffers[key] = buffer
+	}
+	buffer.chunks[f.Index] = f.Data
+	buffer.received++
+	buffer.size += len(f.Data)
+	buffer.used += cost
+	r.used += cost
+	if buffer.received < len(buffer.chunks) {
+		return nil, nil
+	}
+
+	delete(r.buffers, key)
+	r.used -= buffer.used
+	r.stats.Completed++
+	packet := make([]byte, 0, buffer.size)
+	for _, chunk := range buffer.chunks {
+		packet = append(packet, chunk...)
+	}
+	return packet, nil
+}
+
+func (r *Reassembler) expire(now time.Time) {
+	for key, buffer := range r.buffers {
+		if now.Sub(buffer.started) > r.timeout {
+			delete(r.buffers, key)
+			r.used -= buffer.used
+			r.stats.Expired++
+		}
+	}
+	r.expired = now
+}
+
+func (r *Reassembler) Stats() ReassemblyStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	stats.Buffered = r.used
+	return stats
+}
+
+// Decode decodes a datagram of source.
+// fragments are collected, it returns nil packet and nil error
+// until the fragmented frame is complete
+func (r *Reassembler) Decode(source string, datagram []byte) (*Packet, error) {
+	p := &Packet{}
+	complete, err := r.DecodeInto(source, datagram, p)
+	if err != nil || !complete {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DecodeInto decodes a datagram of source into p like DecodeInto.
+// complete is false until the fragmented frame is complete, frames that are not fragmented
+// are decoded without allocating
+func (r *Reassembler) DecodeInto(source string, datagram []byte, p *Packet) (complete bool, err error) {
+	err = DecodeInto(datagram, p)
+	if err != nil || p.Fragment == nil {
+		return err == nil, err
+	}
+	packet, err := r.Add(source, p)
+	if err != nil || packet == nil {
+		return false, err
+	}
+	err = DecodeInto(packet, p)
+	if err != nil {
+		return false, err
+	}
+	if p.Fragment != nil {
+		return false, ErrNestedFragment
+	}
+	return true, nil
+}
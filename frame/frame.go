@@ -1,8 +1,6 @@
 package frame
 
 import (
-	"encoding/binary"
-	"errors"
 	"gameserver/config"
 	"gameserver/utils"
 	"time"
@@ -11,38 +9,67 @@ import (
 type Event struct {
 	ID   uint8
 	Data int32
+	// Payload is the value of a typed event, nil for legacy events which only carry Data
+	Payload *Payload
 }
 type Packet struct {
-	ClientID  uint16
-	GameID    uint16
-	Events    []*Event
-	TimeStamp time.Time
+	// Version and Flags travel in the version header,
+	// Version0 packets are sent without it
+	Version uint8
+	Flags   uint8
+	// sequence section, present when FlagSequenced is set
+	Seq     uint16
+	Ack     uint16
+	AckBits uint32
+	// delivery section, present when FlagReliable is set
+	Delivery  Delivery
+	MessageID uint16
+	// fragment section and chunk, set on fragment frames only
+	Fragment *Fragment
+	// compressor asked by the sender, compression section is present
+	// when FlagCompressed is set
+	Compression uint8
+	ClientID    uint16
+	GameID      uint16
+	Events      []*Event
+	TimeStamp   time.Time
+	// session epoch of compact frames, their time stamp is sent relative to it
+	Epoch time.Time
 }
 
 var (
 	Events = struct {
-		Register   uint8
-		Start      uint8
-		Data       uint8
-		End        uint8
-		Disconnect uint8
-		GameOver   uint8
+		Register    uint8
+		Start       uint8
+		Data        uint8
+		End         uint8
+		Snapshot    uint8
+		SnapshotAck uint8
+		Ack         uint8
+		Disconnect  uint8
+		GameOver    uint8
 	}{
-		Data:       0,
-		Register:   1,
-		Start:      2,
-		End:        3,
-		Disconnect: 254,
-		GameOver:   255,
+		Data:        0,
+		Register:    1,
+		Start:       2,
+		End:         3,
+		Snapshot:    4,
+		SnapshotAck: 5,
+		Ack:         253,
+		Disconnect:  254,
+		GameOver:    255,
 	}
 
 	EventName map[uint8]string = map[uint8]string{
-		Events.Data:       "data",
-		Events.Register:   "register",
-		Events.Start:      "start",
-		Events.End:        "end",
-		Events.Disconnect: "disconnect",
-		Events.GameOver:   "gameover",
+		Events.Data:        "data",
+		Events.Register:    "register",
+		Events.Start:       "start",
+		Events.End:         "end",
+		Events.Snapshot:    "snapshot",
+		Events.SnapshotAck: "snapshot_ack",
+		Events.Ack:         "ack",
+		Events.Disconnect:  "disconnect",
+		Events.GameOver:    "gameover",
 	}
 
 	PackSizeOf = struct {
@@ -61,11 +88,13 @@ var (
 		TimeStamp:     8,
 	}
 
-	MinPacketSize   int = PackSizeOf.ClientID + PackSizeOf.GameID + PackSizeOf.numberOfEvent + PackSizeOf.EventID + PackSizeOf.Data + PackSizeOf.TimeStamp
+	HeaderSize      int = PackSizeOf.ClientID + PackSizeOf.GameID + PackSizeOf.numberOfEvent
+	MinPacketSize   int = HeaderSize + PackSizeOf.TimeStamp
 	EventPacketSize int = PackSizeOf.EventID + PackSizeOf.Data
-	MaxPacketSize   int = MinPacketSize + EventPacketSize*255
+	MaxPacketSize   int = MinPacketSize + EventPacketSize*maxEvents
 
-	ErrInvalidEventPacket error = errors.New("invalid event data packet size")
+	// number of event is a byte
+	maxEvents int = 255
 )
 
 // Custom data package system for game event communication
@@ -78,80 +107,103 @@ var (
 // |  16bit  | 16bit  |     8bit        |   8bit   | 32bit |   8bit   | 32bit |...|   64bit   |
 // |-------------------------------------------------------------------------------------------
 
-func Unmarshal(p []byte) *Packet {
-	clientID := GetClientID(p)
-	gameID := GetGameID(p)
-	events := GetEvents(p)
-	timeStamp := GetTimeStamp(p)
-	return &Packet{
-		ClientID:  clientID,
-		GameID:    gameID,
-		Events:    events,
-		TimeStamp: timeStamp,
+// unmarshalLegacy decodes an already validated legacy layout into p.
+// it slices the buffer blindly
+func unmarshalLegacy(body []byte, p *Packet) {
+	p.ClientID = GetClientID(body)
+	p.GameID = GetGameID(body)
+	pos := HeaderSize
+	for i := 0; i < int(getNOF(body)); i++ {
+		e := nextEvent(p)
+		e.ID = body[pos]
+		e.Data, _ = utils.ReadLE[int32](body[pos+PackSizeOf.EventID:])
+		e.Payload = nil
+		pos += EventPacketSize
+	}
+	p.TimeStamp = getTimeStamp(body)
+}
+
+// reset clears p before it is decoded into, event slice is kept for reuse
+func (p *Packet) reset() {
+	*p = Packet{Events: p.Events[:0]}
+}
+
+// nextEvent appends an event to p.
+// events left in the slice capacity by a previous decode are reused
+func nextEvent(p *Packet) *Event {
+	n := len(p.Events)
+	if n < cap(p.Events) {
+		p.Events = p.Events[:n+1]
+	} else {
+		p.Events = append(p.Events, nil)
+	}
+	if p.Events[n] == nil {
+		p.Events[n] = &Event{}
 	}
+	return p.Events[n]
 }
 
 func GetClientID(packet []byte) uint16 {
-	clientIDPack := packet[:PackSizeOf.ClientID]
-	return binary.LittleEndian.Uint16(clientIDPack)
+	clientID, _ := utils.ReadLE[uint16](packet)
+	return clientID
 }
 
 func GetGameID(packet []byte) uint16 {
-	gameIDPack := packet[PackSizeOf.ClientID : PackSizeOf.ClientID+PackSizeOf.GameID]
-	return binary.LittleEndian.Uint16(gameIDPack)
-}
-
-func GetNOF(packet []byte) uint8 {
-	numberOfEventPack := packet[PackSizeOf.ClientID+PackSizeOf.GameID : PackSizeOf.ClientID+PackSizeOf.GameID+PackSizeOf.numberOfEvent]
-	return uint8(numberOfEventPack[0])
-}
-
-func GetEvents(packet []byte) []*Event {
-	n := GetNOF(packet)
-	events := make([]*Event, 0, n)
-	startByte := PackSizeOf.ClientID + PackSizeOf.GameID + PackSizeOf.numberOfEvent
-	for i := uint8(0); i < n; i++ {
-		eventIDPack := packet[startByte : startByte+PackSizeOf.EventID]
-		dataPack := packet[startByte+PackSizeOf.EventID : startByte+PackSizeOf.TimeStamp]
-		data := binary.LittleEndian.Uint32(dataPack)
-		e := &Event{
-			ID:   eventIDPack[0],
-			Data: int32(data),
-		}
-		events = append(events, e)
-		startByte += EventPacketSize
+	if len(packet) < PackSizeOf.ClientID {
+		return 0
 	}
-	return events
+	gameID, _ := utils.ReadLE[uint16](packet[PackSizeOf.ClientID:])
+	return gameID
+}
+
+// getNOF reads the number of events of a validated body
+func getNOF(packet []byte) uint8 {
+	return packet[PackSizeOf.ClientID+PackSizeOf.GameID]
 }
 
-func GetTimeStamp(packet []byte) time.Time {
+// getTimeStamp reads the time stamp at the end of a validated body
+func getTimeStamp(packet []byte) time.Time {
 	timePack := packet[len(packet)-PackSizeOf.TimeStamp:]
-	timeRead := binary.LittleEndian.Uint64(timePack)
-	return time.Unix(0, int64(timeRead))
+	timeRead, _ := utils.ReadLE[int64](timePack)
+	return time.Unix(0, timeRead)
 }
 
+// Marshal converts a packet object into a packet with the codec of its version.
+// packets with an unsupported version returns nil.
+//
+// Deprecated: Marshal drops the encode error, use Encode.
 func Marshal(p *Packet) []byte {
-	buffer := make([]byte, 0, MaxPacketSize)
-
-	clientIDBytes, _ := utils.ToBytes(p.ClientID)
-	clientIDBytes = clientIDBytes[:PackSizeOf.ClientID]
-	buffer = append(buffer, clientIDBytes...)
+	pack, _ := Encode(p)
+	return pack
+}
 
-	gameIDBytes, _ := utils.ToBytes(p.GameID)
-	gameIDBytes = gameIDBytes[:PackSizeOf.GameID]
-	buffer = append(buffer, gameIDBytes...)
+// Unmarshal converts a packet into a packet object, it is the same as Decode
+func Unmarshal(packet []byte) (*Packet, error) {
+	return Decode(packet)
+}
 
-	buffer = append(buffer, uint8(len(p.Events)))
+// AppendMarshal appends the encoded packet to dst and returns the extended buffer.
+// it does not allocate when dst has enough capacity, unless the frame is compressed
+func AppendMarshal(dst []byte, p *Packet) ([]byte, error) {
+	codec, exists := codecs[p.Version]
+	if !exists {
+		return dst, ErrUnsupportedVersion
+	}
+	return codec.AppendEncode(dst, p)
+}
 
+func appendLegacy(dst []byte, p *Packet) ([]byte, error) {
+	if len(p.Events) > maxEvents {
+		return dst, ErrEventCountMismatch
+	}
+	dst = utils.AppendLE(dst, p.ClientID)
+	dst = utils.AppendLE(dst, p.GameID)
+	dst = append(dst, uint8(len(p.Events)))
 	for _, e := range p.Events {
-		buffer = append(buffer, eventToBytes(e)...)
+		dst = append(dst, e.ID)
+		dst = utils.AppendLE(dst, uint32(e.Data))
 	}
-
-	t, _ := utils.ToBytes(p.TimeStamp.UnixNano())
-	t = t[:PackSizeOf.TimeStamp]
-	buffer = append(buffer, t...)
-
-	return buffer
+	return utils.AppendLE(dst, uint64(p.TimeStamp.UnixNano())), nil
 }
 
 func (p *Packet) IsEventPack(eventID uint8) bool {
@@ -163,26 +215,15 @@ func (p *Packet) IsEventPack(eventID uint8) bool {
 	return false
 }
 
-func eventToBytes(e *Event) []byte {
-	pack := make([]byte, 0, EventPacketSize)
-	pack = append(pack, e.ID)
-	data, _ := utils.ToBytes(e.Data)
-	data = data[:PackSizeOf.Data]
-	pack = append(pack, data...)
-	return pack
-}
-
 func PackGameIDAndClientID(gameID, clientID uint16) []byte {
-	gameIDPack, _ := utils.ToBytes(gameID)
-	clientIDPack, _ := utils.ToBytes(clientID)
 	pack := make([]byte, 0, PackSizeOf.GameID+PackSizeOf.ClientID)
-	pack = append(pack, gameIDPack[:PackSizeOf.GameID]...)
-	pack = append(pack, clientIDPack[:PackSizeOf.ClientID]...)
-	return pack
+	pack = utils.AppendLE(pack, gameID)
+	return utils.AppendLE(pack, clientID)
 }
 
 func CreateEventPacket(gameID uint16, event uint8, data int32) *Packet {
 	return &Packet{
+		Version:  CurrentVersion,
 		ClientID: config.ServerID,
 		GameID:   gameID,
 		Events: []*Event{
@@ -197,6 +238,7 @@ func CreateEventPacket(gameID uint16, event uint8, data int32) *Packet {
 
 func CreatePack(gameID, clientID uint16, event uint8) *Packet {
 	return &Packet{
+		Version:  CurrentVersion,
 		ClientID: clientID,
 		GameID:   gameID,
 		Events: []*Event{
@@ -208,16 +250,3 @@ func CreatePack(gameID, clientID uint16, event uint8) *Packet {
 		TimeStamp: time.Now(),
 	}
 }
-
-func IsValid(packet []byte) bool {
-	if len(packet) < MinPacketSize {
-		return false
-	}
-	if len(packet) > MaxPacketSize {
-		return false
-	}
-	if (len(packet) - MinPacketSize%EventPacketSize) != 0 {
-		return false
-	}
-	return true
-}
@@ -0,0 +1,182 @@
+package frame
+
+import (
+	"fmt"
+	"gameserver/utils"
+)
+
+// FieldError is a decode error with the field it was found in.
+// Field is a path like "events[2].length" and Offset is the byte offset of the field,
+// offsets in a compressed body are offsets of the decompressed body
+type FieldError struct {
+	Field  string
+	Offset int
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v: %v at offset %v", e.Field, e.Err, e.Offset)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+var sectionNames map[uint8]string = map[uint8]string{
+	FlagSequenced:  "sequence",
+	FlagReliable:   "delivery",
+	FlagFragment:   "fragment",
+	FlagCompressed: "compressor",
+}
+
+// Inspect checks a frame like Decode and reports the first malformed field as a *FieldError.
+// it walks the layout field by field, the game router uses the faster Validate
+func Inspect(packet []byte) error {
+	err := inspect(packet)
+	if err != nil {
+		return err
+	}
+	// layouts that are not walked field by field are checked as a whole
+	err = DecodeInto(packet, &Packet{})
+	if err != nil {
+		return &FieldError{Field: "frame", Err: err}
+	}
+	return nil
+}
+
+func inspect(packet []byte) error {
+	if !hasMagic(packet) {
+		return inspectBody(0, packet, 0)
+	}
+	if len(packet) < VersionHeaderSize {
+		return &FieldError{Field: "version", Offset: len(Magic), Err: ErrShortHeader}
+	}
+	if IsBundle(packet) {
+		return &FieldError{Field: "version", Offset: 2, Err: ErrNestedBundle}
+	}
+	if !IsSupportedVersion(packet[2]) {
+		return &FieldError{Field: "version", Offset: 2, Err: ErrUnsupportedVersion}
+	}
+	flags := packet[3]
+	if flags&FlagEncrypted != 0 {
+		return &FieldError{Field: "flags", Offset: 3, Err: ErrSealed}
+	}
+	if flags&^v1Flags != 0 {
+		return &FieldError{Field: "flags", Offset: 3, Err: ErrUnsupportedFlags}
+	}
+	if flags&FlagChecksum != 0 {
+		verified, err := verifyChecksum(packet)
+		if err != nil {
+			return &FieldError{Field: "checksum", Offset: len(packet) - ChecksumSize, Err: err}
+		}
+		packet = verified
+	}
+	offset := VersionHeaderSize
+	for _, section := range v1Sections {
+		if flags&section.flag == 0 {
+			continue
+		}
+		name := sectionNames[section.flag]
+		if len(packet) < offset+section.size {
+			return &FieldError{Field: name, Offset: offset, Err: ErrShortHeader}
+		}
+		if section.validate != nil {
+			err := section.validate(packet[offset : offset+section.size])
+			if err != nil {
+				return &FieldError{Field: sectionField(section.flag, packet[offset:]), Offset: offset, Err: err}
+			}
+		}
+		offset += section.size
+	}
+	body := packet[offset:]
+	if flags&FlagCompressed != 0 {
+		var err error
+		body, err = decompressBody(packet[offset-CompressionHeaderSize], body)
+		if err != nil {
+			return &FieldError{Field: "body", Offset: offset, Err: err}
+		}
+		offset = 0
+	}
+	switch {
+	case flags&FlagFragment != 0:
+		if validateFragmentBody(body) != nil {
+			return &FieldError{Field: "fragment.data", Offset: offset, Err: ErrInvalidFragment}
+		}
+	case flags&FlagCompact != 0:
+		// bit packed fields have no byte offset
+		if err := validateCompact(body); err != nil {
+			return &FieldError{Field: "body", Offset: offset, Err: err}
+		}
+	default:
+		return inspectBody(flags, body, offset)
+	}
+	return nil
+}
+
+// sectionField names the malformed field of a section that failed validation
+func sectionField(flag uint8, section []byte) string {
+	if flag == FlagFragment {
+		if section[3] == 0 {
+			return "fragment.count"
+		}
+		return "fragment.index"
+	}
+	return sectionNames[flag]
+}
+
+// inspectBody walks the header, events and time stamp of a legacy or typed body
+func inspectBody(flags uint8, body []byte, offset int) error {
+	header := []struct {
+		name string
+		size int
+	}{
+		{"client_id", PackSizeOf.ClientID},
+		{"game_id", PackSizeOf.GameID},
+		{"event_count", PackSizeOf.numberOfEvent},
+	}
+	pos := 0
+	for _, field := range header {
+		if len(body) < pos+field.size {
+			return &FieldError{Field: field.name, Offset: offset + pos, Err: ErrShortHeader}
+		}
+		pos += field.size
+	}
+	limit := MaxPacketSize
+	if flags&FlagTypedEvents != 0 {
+		limit = MaxFrameSize
+	}
+	if len(body) > limit {
+		return &FieldError{Field: "body", Offset: offset, Err: ErrOversize}
+	}
+	end := len(body) - PackSizeOf.TimeStamp
+	for i := 0; i < int(getNOF(body)); i++ {
+		field := fmt.Sprintf("events[%v]", i)
+		size := EventPacketSize
+		if flags&FlagTypedEvents != 0 {
+			if pos+TypedEventHeaderSize > end {
+				return &FieldError{Field: field, Offset: offset + pos, Err: ErrEventCountMismatch}
+			}
+			t := PayloadType(body[pos+1])
+			length, _ := utils.ReadLE[uint16](body[pos+2:])
+			if _, exists := PayloadTypeName[t]; !exists {
+				return &FieldError{Field: field + ".type", Offset: offset + pos + 1, Err: ErrInvalidPayload}
+			}
+			err := validatePayload(t, int(length))
+			if err != nil {
+				return &FieldError{Field: field + ".length", Offset: offset + pos + 2, Err: err}
+			}
+			size = TypedEventHeaderSize + int(length)
+		}
+		if pos+size > end {
+			return &FieldError{Field: field, Offset: offset + pos, Err: ErrEventCountMismatch}
+		}
+		pos += size
+	}
+	if pos > end {
+		return &FieldError{Field: "time_stamp", Offset: offset + pos, Err: ErrEventCountMismatch}
+	}
+	if pos < end {
+		return &FieldError{Field: "time_stamp", Offset: offset + pos, Err: ErrTrailingBytes}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package frame
+
+import (
+	"errors"
+	"gameserver/utils"
+	"math"
+)
+
+// Typed events replaces the fixed 4 byte data with a type-length-value payload.
+// a frame with typed events has FlagTypedEvents set and all of its events are encoded as
+// |----------------------------------------|
+// | eventID | type  | length |  payload... |
+// |----------------------------------------|
+// |  1byte  | 1byte | 2byte  | length byte |
+// |----------------------------------------|
+// legacy (int32) events inside such frame are sent as PayloadInt32
+
+type PayloadType uint8
+
+const (
+	PayloadInt32 PayloadType = iota + 1
+	PayloadInt64
+	PayloadFloat32
+	PayloadFloat64
+	PayloadBool
+	PayloadBytes
+	PayloadString
+	// vector is a list of float32 components, 2D and 3D vectors are the common ones
+	PayloadVector
+)
+
+const (
+	FlagTypedEvents uint8 = 1 << 0
+
+	TypedEventHeaderSize int = 4
+	MaxPayloadSize       int = math.MaxUint16
+)
+
+var (
+	PayloadTypeName map[PayloadType]string = map[PayloadType]string{
+		PayloadInt32:   "int32",
+		PayloadInt64:   "int64",
+		PayloadFloat32: "float32",
+		PayloadFloat64: "float64",
+		PayloadBool:    "bool",
+		PayloadBytes:   "bytes",
+		PayloadString:  "string",
+		PayloadVector:  "vector",
+	}
+
+	// payload sizes of fixed size types, others are variable
+	payloadSize map[PayloadType]int = map[PayloadType]int{
+		PayloadInt32:   4,
+		PayloadInt64:   8,
+		PayloadFloat32: 4,
+		PayloadFloat64: 8,
+		PayloadBool:    1,
+	}
+
+	ErrInvalidPayload     error = errors.New("frame: invalid event payload")
+	ErrPayloadType        error = errors.New("frame: payload type mismatch")
+	ErrPayloadTooLarge    error = errors.New("frame: event payload too large")
+	ErrTypedEventInLegacy error = errors.New("frame: typed events needs a versioned frame")
+)
+
+// Payload is the value of a typed event.
+// Value holds the little endian encoding of the type
+type Payload struct {
+	Type  PayloadType
+	Value []byte
+}
+
+func (t PayloadType) String() string {
+	name, exists := PayloadTypeName[t]
+	if !exists {
+		return "unknown"
+	}
+	return name
+}
+
+// IsTyped reports whether event has a typed payload instead of the legacy data
+func (e *Event) IsTyped() bool {
+	return e.Payload != nil
+}
+
+func Int64Payload(v int64) *Payload {
+	return &Payload{Type: PayloadInt64, Value: utils.AppendLE(make([]byte, 0, 8), v)}
+}
+
+func Float32Payload(v float32) *Payload {
+	return &Payload{Type: PayloadFloat32, Value: utils.AppendLE(make([]byte, 0, 4), v)}
+}
+
+func Float64Payload(v float64) *Payload {
+	return &Payload{Type: PayloadFloat64, Value: utils.AppendLE(make([]byte, 0, 8), v)}
+}
+
+func BoolPayload(v bool) *Payload {
+	value := []byte{0}
+	if v {
+		value[0] = 1
+	}
+	return &Payload{Type: PayloadBool, Value: value}
+}
+
+func BytesPayload(v []byte) *Payload {
+	return &Payload{Type: PayloadBytes, Value: append([]byte{}, v...)}
+}
+
+func StringPayload(v string) *Payload {
+	return &Payload{Type: PayloadString, Value: []byte(v)}
+}
+
+func VectorPayload(v ...float32) *Payload {
+	value := make([]byte, 0, 4*len(v))
+	for _, c := range v {
+		value = utils.AppendLE(value, c)
+	}
+	return &Payload{Type: PayloadVector, Value: value}
+}
+
+func (p *Payload) Int32() (int32, error) {
+	if p.Type != PayloadInt32 {
+		return 0, ErrPayloadType
+	}
+	return utils.ReadLE[int32](p.Value)
+}
+
+func (p *Payload) Int64() (int64, error) {
+	if p.Type != PayloadInt64 {
+		return 0, ErrPayloadType
+	}
+	return utils.ReadLE[int64](p.Value)
+}
+
+func (p *Payload) Float32() (float32, error) {
+	if p.Type != PayloadFloat32 {
+		return 0, ErrPayloadType
+	}
+	return utils.ReadLE[float32](p.Value)
+}
+
+func (p *Payload) Float64() (float64, error) {
+	if p.Type != PayloadFloat64 {
+		return 0, ErrPayloadType
+	}
+	return utils.ReadLE[float64](p.Value)
+}
+
+func (p *Payload) Bool() (bool, error) {
+	if p.Type != PayloadBool {
+		return false, ErrPayloadType
+	}
+	if len(p.Value) != 1 {
+		return false, ErrInvalidPayload
+	}
+	return p.Value[0] == 1, nil
+}
+
+func (p *Payload) Bytes() ([]byte, error) {
+	if p.Type != PayloadBytes {
+		return nil, ErrPayloadType
+	}
+	return p.Value, nil
+}
+
+// Text returns the value of a string payload
+func (p *Payload) Text() (string, error) {
+	if p.Type != PayloadString {
+		return "", ErrPayloadType
+	}
+	return string(p.Value), nil
+}
+
+func (p *Payload) Vector() ([]float32, error) {
+	if p.Type != PayloadVector {
+		return nil, ErrPayloadType
+	}
+	v := make([]float32, len(p.Value)/4)
+	for i := range v {
+		v[i], _ = utils.ReadLE[float32](p.Value[4*i:])
+	}
+	return v, nil
+}
+
+// Validate checks that payload length suits its type
+func (p *Payload) Validate() error {
+	return validatePayload(p.Type, len(p.Value))
+}
+
+func validatePayload(t PayloadType, length int) error {
+	if _, exists := PayloadTypeName[t]; !exists {
+		return ErrInvalidPayload
+	}
+	if length > MaxPayloadSize {
+		return ErrPayloadTooLarge
+	}
+	if size, fixed := payloadSize[t]; fixed && size != length {
+		return ErrInvalidPayload
+	}
+	if t == PayloadVector && length%4 != 0 {
+		return ErrInvalidPayload
+	}
+	return nil
+}
+
+func hasTypedEvents(p *Packet) bool {
+	for _, e := range p.Events {
+		if e.IsTyped() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTyped checks the layout of a frame body with typed events
+func validateTyped(packet []byte) error {
+	if len(packet) < HeaderSize {
+		return ErrShortHeader
+	}
+	if len(packet) > MaxFrameSize {
+		return ErrOversize
+	}
+	if len(packet) < MinPacketSize {
+		return ErrEventCountMismatch
+	}
+	end := len(packet) - PackSizeOf.TimeStamp
+	pos := HeaderSize
+	for i := 0; i < int(getNOF(packet)); i++ {
+		if pos+TypedEventHeaderSize > end {
+			return ErrEventCountMismatch
+		}
+		length, _ := utils.ReadLE[uint16](packet[pos+2:])
+		err := validatePayload(PayloadType(packet[pos+1]), int(length))
+		if err != nil {
+			return err
+		}
+		pos += TypedEventHeaderSize + int(length)
+		if pos > end {
+			return ErrEventCountMismatch
+		}
+	}
+	if pos != end {
+		return ErrTrailingBytes
+	}
+	return nil
+}
+
+// unmarshalTyped decodes an already validated typed frame body into p.
+// int32 payloads are folded into the legacy data
+func unmarshalTyped(body []byte, p *Packet) {
+	p.ClientID = GetClientID(body)
+	p.GameID = GetGameID(body)
+	pos := HeaderSize
+	for i := 0; i < int(getNOF(body)); i++ {
+		t := PayloadType(body[pos+1])
+		size, _ := utils.ReadLE[uint16](body[pos+2:])
+		length := int(size)
+		value := body[pos+TypedEventHeaderSize : pos+TypedEventHeaderSize+length]
+		e := nextEvent(p)
+		e.ID = body[pos]
+		e.Data = 0
+		if t == PayloadInt32 {
+			e.Data, _ = utils.ReadLE[int32](value)
+			e.Payload = nil
+		} else {
+			copy(reusePayload(e, t, length), value)
+		}
+		pos += TypedEventHeaderSize + length
+	}
+	p.TimeStamp = getTimeStamp(body)
+}
+
+// reusePayload sets a payload of type t and length n to e and returns its value to fill.
+// payload of a previous decode is reused when it is large enough
+func reusePayload(e *Event, t PayloadType, n int) []byte {
+	if e.Payload == nil {
+		e.Payload = &Payload{}
+	}
+	e.Payload.Type = t
+	if cap(e.Payload.Value) < n {
+		e.Payload.Value = make([]byte, n)
+	}
+	e.Payload.Value = e.Payload.Value[:n]
+	return e.Payload.Value
+}
+
+func appendTyped(dst []byte, p *Packet) ([]byte, error) {
+	if len(p.Events) > maxEvents {
+		return dst, ErrEventCountMismatch
+	}
+	dst = utils.AppendLE(dst, p.ClientID)
+	dst = utils.AppendLE(dst, p.GameID)
+	dst = append(dst, uint8(len(p.Events)))
+	for _, e := range p.Events {
+		if e.Payload == nil {
+			dst = append(dst, e.ID, uint8(PayloadInt32))
+			dst = utils.AppendLE(dst, uint16(PackSizeOf.Data))
+			dst = utils.AppendLE(dst, uint32(e.Data))
+			continue
+		}
+		err := e.Payload.Validate()
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, e.ID, uint8(e.Payload.Type))
+		dst = utils.AppendLE(dst, uint16(len(e.Payload.Value)))
+		dst = append(dst, e.Payload.Value...)
+	}
+	return utils.AppendLE(dst, uint64(p.TimeStamp.UnixNano())), nil
+}
@@ -0,0 +1,46 @@
+package frame
+
+import "sync"
+
+// datagram sized buffers shared by the read loops and encoders.
+// pointers are pooled, a slice in an interface would allocate on every put
+var buffers = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, MaxDatagramSize)
+		return &buffer
+	},
+}
+
+// GetBuffer returns a pooled buffer of MaxDatagramSize bytes.
+// it must be given back with PutBuffer once nothing refers to it
+func GetBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+// PutBuffer gives a buffer back to the pool.
+// buffers grown beyond MaxDatagramSize are dropped so the pool does not keep large frames
+func PutBuffer(buffer *[]byte) {
+	if cap(*buffer) != MaxDatagramSize {
+		return
+	}
+	*buffer = (*buffer)[:MaxDatagramSize]
+	buffers.Put(buffer)
+}
+
+// packets decoded by the read loops, they are decoded into with DecodeInto
+var packets = sync.Pool{
+	New: func() interface{} {
+		return &Packet{}
+	},
+}
+
+// GetPacket returns a pooled packet to decode into.
+// it must be given back with PutPacket once nothing refers to it or its events
+func GetPacket() *Packet {
+	return packets.Get().(*Packet)
+}
+
+// PutPacket gives a packet back to the pool, its events are reused by the next decode
+func PutPacket(p *Packet) {
+	packets.Put(p)
+}
@@ -0,0 +1,177 @@
+package frame
+
+import (
+	"errors"
+	"fmt"
+	"gameserver/config"
+	"sync"
+)
+
+// Direction is the allowed flow of an event
+type Direction uint8
+
+const (
+	ClientToServer Direction = 1 << 0
+	ServerToClient Direction = 1 << 1
+	Bidirectional  Direction = ClientToServer | ServerToClient
+)
+
+const (
+	// event IDs outside of this range are reserved for the protocol
+	FirstGameEventID uint8 = 16
+	LastGameEventID  uint8 = 239
+)
+
+var (
+	ErrReservedEvent   error = errors.New("frame: reserved event ID")
+	ErrUnknownEvent    error = errors.New("frame: unknown event ID")
+	ErrDuplicateEvent  error = errors.New("frame: event ID already registered")
+	ErrEventDirection  error = errors.New("frame: event is not allowed in this direction")
+	ErrEventSchema     error = errors.New("frame: event payload does not match schema")
+	ErrEventValidation error = errors.New("frame: event validation failed")
+	ErrEventNotFound   error = errors.New("frame: event not found in packet")
+
+	// DefaultRegistry is used by server and simulator, game events are registered into it
+	DefaultRegistry *Registry = NewRegistry(config.RejectUnknownEvents)
+)
+
+// EventSpec describes a registered event
+type EventSpec struct {
+	ID   uint8
+	Name string
+	// Payload is the expected payload type.
+	// PayloadInt32 means the legacy Data, zero accepts any payload
+	Payload   PayloadType
+	Direction Direction
+	// Delivery is the least delivery class that packets with this event are sent
+	Delivery Delivery
+	// Validate is optional, it is called after schema checks pass
+	Validate func(e *Event) error
+}
+
+// Registry holds event specs by ID.
+// it is safe for concurrent use
+type Registry struct {
+	mu    sync.RWMutex
+	specs map[uint8]*EventSpec
+	// unregistered game event IDs are rejected when true,
+	// unregistered reserved IDs are always rejected
+	rejectUnknown bool
+}
+
+// NewRegistry creates a registry with protocol events already registered
+func NewRegistry(rejectUnknown bool) *Registry {
+	r := &Registry{
+		specs:         make(map[uint8]*EventSpec),
+		rejectUnknown: rejectUnknown,
+	}
+	protocolEvents := []*EventSpec{
+		{ID: Events.Data, Payload: PayloadInt32, Direction: Bidirectional},
+		// register carries the session ticket when the matcher issued one
+		{ID: Events.Register, Direction: ClientToServer, Delivery: ReliableOrdered, Validate: validateRegister},
+		{ID: Events.Start, Payload: PayloadInt32, Direction: ServerToClient, Delivery: ReliableOrdered},
+		{ID: Events.End, Payload: PayloadInt32, Direction: Bidirectional, Delivery: ReliableOrdered},
+		// snapshots are replaced by the next one, lost ones are not resent.
+		// snapshot ack carries the tick in data
+		{ID: Events.Snapshot, Payload: PayloadBytes, Direction: ServerToClient},
+		{ID: Events.SnapshotAck, Payload: PayloadInt32, Direction: ClientToServer},
+		{ID: Events.Ack, Payload: PayloadInt32, Direction: Bidirectional},
+		{ID: Events.Disconnect, Payload: PayloadInt32, Direction: ClientToServer, Delivery: ReliableOrdered},
+		{ID: Events.GameOver, Payload: PayloadInt32, Direction: ServerToClient, Delivery: ReliableOrdered},
+	}
+	for _, spec := range protocolEvents {
+		spec.Name = EventName[spec.ID]
+		r.specs[spec.ID] = spec
+	}
+	return r
+}
+
+func IsReservedEventID(id uint8) bool {
+	return id < FirstGameEventID || id > LastGameEventID
+}
+
+// Register adds a game event, reserved and already registered IDs are refused
+func (r *Registry) Register(spec EventSpec) error {
+	if IsReservedEventID(spec.ID) {
+		return ErrReservedEvent
+	}
+	if spec.Direction == 0 {
+		spec.Direction = Bidirectional
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.specs[spec.ID]; exists {
+		return ErrDuplicateEvent
+	}
+	r.specs[spec.ID] = &spec
+	return nil
+}
+
+func (r *Registry) Lookup(id uint8) (*EventSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, exists := r.specs[id]
+	return spec, exists
+}
+
+// Name returns the registered name of event, unregistered events are data events
+func (r *Registry) Name(id uint8) string {
+	spec, exists := r.Lookup(id)
+	if !exists || spec.Name == "" {
+		return EventName[Events.Data]
+	}
+	return spec.Name
+}
+
+// Check applies direction, schema and validation rules of an event
+func (r *Registry) Check(e *Event, direction Direction) error {
+	spec, exists := r.Lookup(e.ID)
+	if !exists {
+		if IsReservedEventID(e.ID) {
+			return ErrReservedEvent
+		}
+		if r.rejectUnknown {
+			return ErrUnknownEvent
+		}
+		return nil
+	}
+	if spec.Direction&direction == 0 {
+		return ErrEventDirection
+	}
+	if spec.Payload == PayloadInt32 && e.IsTyped() {
+		return ErrEventSchema
+	}
+	if spec.Payload != 0 && spec.Payload != PayloadInt32 && (!e.IsTyped() || e.Payload.Type != spec.Payload) {
+		return ErrEventSchema
+	}
+	if spec.Validate != nil {
+		err := spec.Validate(e)
+		if err != nil {
+			return fmt.Errorf("%w: %v: %v", ErrEventValidation, spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// Delivery returns the strongest delivery class required by the packet or its events
+func (r *Registry) Delivery(p *Packet) Delivery {
+	delivery := p.Delivery
+	for _, e := range p.Events {
+		spec, exists := r.Lookup(e.ID)
+		if exists && spec.Delivery > delivery {
+			delivery = spec.Delivery
+		}
+	}
+	return delivery
+}
+
+// CheckPacket checks all events of a packet
+func (r *Registry) CheckPacket(p *Packet, direction Direction) error {
+	for _, e := range p.Events {
+		err := r.Check(e, direction)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
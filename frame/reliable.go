@@ -0,0 +1,317 @@
+package frame
+
+import (
+	"errors"
+	"gameserver/config"
+	"gameserver/utils"
+	"sync"
+	"time"
+)
+
+// Reliable frames carries a delivery section after the sequence section
+// |--------------------------|
+// | delivery |  message ID   |
+// |--------------------------|
+// |  1byte   |    2byte      |
+// |--------------------------|
+// message IDs are counted per delivery class, retransmissions keeps the message ID
+// and gets a new sequence. a message is delivered when any of its sequences is acked
+
+// Delivery is the delivery class of a packet
+type Delivery uint8
+
+const (
+	Unreliable Delivery = iota
+	ReliableUnordered
+	ReliableOrdered
+)
+
+const (
+	FlagReliable uint8 = 1 << 2
+
+	ReliableHeaderSize int = 3
+
+	minResendTimeout time.Duration = 100 * time.Millisecond
+	maxResendTimeout time.Duration = time.Second
+
+	// received message IDs remembered for duplicate suppression
+	receivedHistorySize int = 1024
+	// out of order messages waiting for the missing ones
+	maxOrderedBuffer int = 256
+)
+
+var (
+	DeliveryName map[Delivery]string = map[Delivery]string{
+		Unreliable:        "unreliable",
+		ReliableUnordered: "reliable",
+		ReliableOrdered:   "ordered",
+	}
+
+	ErrDuplicate       error = errors.New("frame: duplicate packet")
+	ErrOrderedOverrun  error = errors.New("frame: too many out of order messages")
+	ErrInvalidDelivery error = errors.New("frame: invalid delivery class")
+	ErrDeliveryFailed  error = errors.New("frame: reliable message is not acked after max resend attempts")
+)
+
+func readReliable(section []byte, p *Packet) {
+	p.Delivery = Delivery(section[0])
+	p.MessageID, _ = utils.ReadLE[uint16](section[1:])
+}
+
+func validateReliable(section []byte) error {
+	delivery := Delivery(section[0])
+	if delivery != ReliableUnordered && delivery != ReliableOrdered {
+		return ErrInvalidDelivery
+	}
+	return nil
+}
+
+func writeReliable(dst []byte, p *Packet) []byte {
+	dst = append(dst, uint8(p.Delivery))
+	return utils.AppendLE(dst, p.MessageID)
+}
+
+func (d Delivery) String() string {
+	name, exists := DeliveryName[d]
+	if !exists {
+		return "unknown"
+	}
+	return name
+}
+
+// ConnectionStats is the delivery statistics of one peer
+type ConnectionStats struct {
+	SequenceStats
+	Retransmits uint64
+	// reliable messages not acked after max resend attempts, the connection is given up with the first one
+	Failed            uint64
+	DuplicateMessages uint64
+}
+
+type pendingMessage struct {
+	packet   *Packet
+	seqs     []uint16
+	sentAt   time.Time
+	attempts int
+}
+
+type receivedMessage struct {
+	id    uint16
+	valid bool
+}
+
+// Connection is the transport state of one peer on top of UDP.
+// it sequences every outgoing packet, keeps reliable ones until they are acked
+// and delivers incoming reliable messages once, ordered ones in order.
+// it is safe for concurrent use
+type Connection struct {
+	mu       sync.Mutex
+	sequence *Sequencer
+
+	nextID  [ReliableOrdered + 1]uint16
+	pending map[Delivery]map[uint16]*pendingMessage
+
+	unordered   [receivedHistorySize]receivedMessage
+	nextOrdered uint16
+	ordered     map[uint16]*Packet
+	// a reliable message is received and no packet carried its ack yet
+	ackDue bool
+	// a reliable message is not acked after max resend attempts, the peer is lost
+	failed bool
+
+	stats ConnectionStats
+}
+
+func NewConnection() *Connection {
+	return &Connection{
+		sequence: NewSequencer(),
+		pending: map[Delivery]map[uint16]*pendingMessage{
+			ReliableUnordered: make(map[uint16]*pendingMessage),
+			ReliableOrdered:   make(map[uint16]*pendingMessage),
+		},
+		ordered: make(map[uint16]*Packet),
+	}
+}
+
+// Send stamps an outgoing packet. reliable packets get a message ID
+// and are kept for retransmission, packet must not be changed afterwards
+func (c *Connection) Send(p *Packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p.Delivery != Unreliable {
+		p.Flags |= FlagReliable
+		p.MessageID = c.nextID[p.Delivery]
+		c.nextID[p.Delivery]++
+	}
+	c.sequence.Stamp(p)
+	c.ackDue = false
+	if p.Delivery != Unreliable {
+		c.pending[p.Delivery][p.MessageID] = &pendingMessage{
+			packet:   p,
+			seqs:     []uint16{p.Seq},
+			sentAt:   time.Now(),
+			attempts: 1,
+		}
+	}
+}
+
+// Receive processes an incoming packet and returns the packets ready for delivery.
+// an ordered message may release the buffered ones after it
+func (c *Connection) Receive(p *Packet) ([]*Packet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// an ordered message that can not be buffered is dropped before its sequence is acked,
+	// so the peer resends it once the missing messages release the buffer
+	if p.Flags&FlagReliable != 0 && p.Delivery == ReliableOrdered && c.orderedOverrun(p.MessageID) {
+		return nil, ErrOrderedOverrun
+	}
+	if !c.sequence.Receive(p) {
+		return nil, ErrDuplicate
+	}
+	c.resolvePending()
+	if p.Flags&FlagReliable == 0 {
+		return []*Packet{p}, nil
+	}
+	c.ackDue = true
+	switch p.Delivery {
+	case ReliableUnordered:
+		received := &c.unordered[int(p.MessageID)%receivedHistorySize]
+		if received.valid && received.id == p.MessageID {
+			c.stats.DuplicateMessages++
+			return nil, ErrDuplicate
+		}
+		received.id = p.MessageID
+		received.valid = true
+		return []*Packet{p}, nil
+	case ReliableOrdered:
+		return c.receiveOrdered(p)
+	}
+	return []*Packet{p}, nil
+}
+
+func (c *Connection) receiveOrdered(p *Packet) ([]*Packet, error) {
+	if p.MessageID != c.nextOrdered {
+		_, buffered := c.ordered[p.MessageID]
+		if buffered || SeqGreater(c.nextOrdered, p.MessageID) {
+			c.stats.DuplicateMessages++
+			return nil, ErrDuplicate
+		}
+		c.ordered[p.MessageID] = p
+		return nil, nil
+	}
+	delivered := []*Packet{p}
+	c.nextOrdered++
+	for {
+		next, exists := c.ordered[c.nextOrdered]
+		if !exists {
+			break
+		}
+		delete(c.ordered, c.nextOrdered)
+		delivered = append(delivered, next)
+		c.nextOrdered++
+	}
+	return delivered, nil
+}
+
+// orderedOverrun reports that an ordered message would be buffered and the buffer is full.
+// the next expected message, duplicates and already buffered ones never overrun
+func (c *Connection) orderedOverrun(id uint16) bool {
+	if id == c.nextOrdered || SeqGreater(c.nextOrdered, id) || len(c.ordered) < maxOrderedBuffer {
+		return false
+	}
+	_, buffered := c.ordered[id]
+	return !buffered
+}
+
+// resolvePending forgets the reliable messages acked by the peer
+func (c *Connection) resolvePending() {
+	for _, messages := range c.pending {
+		for id, m := range messages {
+			for _, seq := range m.seqs {
+				if c.sequence.IsAcked(seq) {
+					delete(messages, id)
+					break
+				}
+			}
+		}
+	}
+}
+
+// Resend returns reliable packets whose retransmission timer is expired,
+// restamped with a new sequence. a message that is not acked after max resend attempts
+// fails the connection with ErrDeliveryFailed, the peer would wait for it forever
+// and the connection must be closed
+func (c *Connection) Resend(now time.Time) ([]*Packet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failed {
+		return nil, ErrDeliveryFailed
+	}
+	c.resolvePending()
+	timeout := c.resendTimeout()
+	resend := make([]*Packet, 0)
+	for _, messages := range c.pending {
+		for id, m := range messages {
+			if now.Sub(m.sentAt) < timeout {
+				continue
+			}
+			if m.attempts >= config.MaxResendAttempt {
+				delete(messages, id)
+				c.stats.Failed++
+				c.failed = true
+				return nil, ErrDeliveryFailed
+			}
+			// a copy is sent, the previous one may still be in use by the sender
+			p := *m.packet
+			c.sequence.Stamp(&p)
+			c.ackDue = false
+			m.packet = &p
+			m.seqs = append(m.seqs, p.Seq)
+			m.sentAt = now
+			m.attempts++
+			c.stats.Retransmits++
+			resend = append(resend, &p)
+		}
+	}
+	return resend, nil
+}
+
+// resendTimeout is twice the round trip time within limits
+func (c *Connection) resendTimeout() time.Duration {
+	timeout := 2 * c.sequence.Stats().RTT
+	if timeout < minResendTimeout {
+		return minResendTimeout
+	}
+	if timeout > maxResendTimeout {
+		return maxResendTimeout
+	}
+	return timeout
+}
+
+// AckDue reports that a reliable message is received and its ack is not sent yet.
+// when there is nothing else to send an ack packet should be sent
+func (c *Connection) AckDue() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ackDue
+}
+
+// Pending is the number of reliable messages waiting for an ack
+func (c *Connection) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resolvePending()
+	n := 0
+	for _, messages := range c.pending {
+		n += len(messages)
+	}
+	return n
+}
+
+func (c *Connection) Stats() ConnectionStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.SequenceStats = c.sequence.Stats()
+	return stats
+}
@@ -0,0 +1,223 @@
+package frame
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"gameserver/utils"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/poly1305"
+)
+
+// Sealed frames wraps an encoded frame encrypted with the session key of the client
+// |-----------------------------------------|--------------------------|-------|
+// |  version header  |    seal section      |       ciphertext         |  tag  |
+// |-----------------------------------------|--------------------------|-------|
+// | magic | 1 | flag | clientID | gameID | counter |  inner frame       |       |
+// |-----------------------------------------|--------------------------|-------|
+// | 2byte |1b | 1b   |  2byte   | 2byte  | 8byte   |   ...              | 16byte|
+// |-----------------------------------------|--------------------------|-------|
+// cleartext part is authenticated as additional data, client and game IDs
+// selects the session key so a frame can not be forged for another client.
+// counter is the nonce, counters seen before are rejected as replays
+
+const (
+	FlagEncrypted uint8 = 1 << 5
+
+	SealHeaderSize int = 12
+	// bytes added to a frame when it is sealed
+	SealOverhead int = VersionHeaderSize + SealHeaderSize + poly1305.TagSize
+
+	SessionKeySize int = chacha20poly1305.KeySize
+	PublicKeySize  int = curve25519.PointSize
+
+	// number of counters remembered behind the latest one
+	replayWindow uint64 = 64
+)
+
+var (
+	ErrSealed        error = errors.New("frame: frame is encrypted")
+	ErrNotSealed     error = errors.New("frame: frame is not encrypted")
+	ErrAuthFailed    error = errors.New("frame: frame authentication failed")
+	ErrReplay        error = errors.New("frame: replayed frame")
+	ErrSessionKey    error = errors.New("frame: invalid session key")
+	ErrSealedSession error = errors.New("frame: frame is sealed for another session")
+)
+
+// KeyPair is an ephemeral X25519 key pair used once for a session key exchange
+type KeyPair struct {
+	private [32]byte
+	Public  []byte
+}
+
+func NewKeyPair() (*KeyPair, error) {
+	k := &KeyPair{}
+	_, err := io.ReadFull(rand.Reader, k.private[:])
+	if err != nil {
+		return nil, err
+	}
+	k.Public, err = curve25519.X25519(k.private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// SessionKey derives the session key of a client from the public key of the other side.
+// IDs are mixed into the key so it is bound to one client of one game
+func (k *KeyPair) SessionKey(peerPublic []byte, gameID, clientID uint16) ([]byte, error) {
+	if len(peerPublic) != PublicKeySize {
+		return nil, ErrSessionKey
+	}
+	shared, err := curve25519.X25519(k.private[:], peerPublic)
+	if err != nil {
+		return nil, ErrSessionKey
+	}
+	info := utils.AppendLE([]byte("gameserver session key"), gameID)
+	info = utils.AppendLE(info, clientID)
+	key := make([]byte, SessionKeySize)
+	_, err = io.ReadFull(hkdf.New(sha256.New, shared, nil, info), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Cipher seals outgoing frames and opens incoming ones of a single session.
+// both sides share the key, direction keeps their nonces apart.
+// it is safe for concurrent use
+type Cipher struct {
+	mu       sync.Mutex
+	aead     cipher.AEAD
+	clientID uint16
+	gameID   uint16
+	// direction of the frames sealed by this side
+	direction Direction
+
+	sendCounter uint64
+	hasRecv     bool
+	recvCounter uint64
+	// bit n is set when recvCounter-(n+1) is received
+	recvBits uint64
+}
+
+// NewCipher creates the cipher of one side of a session,
+// direction is ClientToServer on the client and ServerToClient on the server
+func NewCipher(key []byte, gameID, clientID uint16, direction Direction) (*Cipher, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, ErrSessionKey
+	}
+	return &Cipher{
+		aead:      aead,
+		clientID:  clientID,
+		gameID:    gameID,
+		direction: direction,
+	}, nil
+}
+
+// IsSealed reports whether a raw frame is encrypted
+func IsSealed(packet []byte) bool {
+	return hasMagic(packet) && len(packet) >= VersionHeaderSize && packet[3]&FlagEncrypted != 0
+}
+
+// SealedIDs reads the client and game IDs of a sealed frame, they select the session key
+func SealedIDs(packet []byte) (gameID, clientID uint16, err error) {
+	if !IsSealed(packet) {
+		return 0, 0, ErrNotSealed
+	}
+	if len(packet) < SealOverhead {
+		return 0, 0, ErrShortHeader
+	}
+	return GetGameID(packet[VersionHeaderSize:]), GetClientID(packet[VersionHeaderSize:]), nil
+}
+
+func nonce(direction Direction, counter uint64) []byte {
+	n := make([]byte, chacha20poly1305.NonceSize)
+	n[0] = uint8(direction)
+	utils.PutLE(n[4:], counter)
+	return n
+}
+
+// Seal encrypts an encoded frame
+func (c *Cipher) Seal(packet []byte) []byte {
+	c.mu.Lock()
+	counter := c.sendCounter
+	c.sendCounter++
+	c.mu.Unlock()
+
+	sealed := make([]byte, 0, SealOverhead+len(packet))
+	sealed = append(sealed, Magic[0], Magic[1], Version1, FlagEncrypted)
+	sealed = utils.AppendLE(sealed, c.clientID)
+	sealed = utils.AppendLE(sealed, c.gameID)
+	sealed = utils.AppendLE(sealed, counter)
+	return c.aead.Seal(sealed, nonce(c.direction, counter), packet, sealed)
+}
+
+// Open authenticates and decrypts a sealed frame of the peer and returns the inner frame
+func (c *Cipher) Open(packet []byte) ([]byte, error) {
+	gameID, clientID, err := SealedIDs(packet)
+	if err != nil {
+		return nil, err
+	}
+	if gameID != c.gameID || clientID != c.clientID {
+		return nil, ErrSealedSession
+	}
+	headerSize := VersionHeaderSize + SealHeaderSize
+	counter, _ := utils.ReadLE[uint64](packet[VersionHeaderSize+4:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isReplay(counter) {
+		return nil, ErrReplay
+	}
+	inner, err := c.aead.Open(nil, nonce(Bidirectional&^c.direction, counter), packet[headerSize:], packet[:headerSize])
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	// window moves only for authentic frames
+	c.markReceived(counter)
+	return inner, nil
+}
+
+func (c *Cipher) isReplay(counter uint64) bool {
+	if !c.hasRecv || counter > c.recvCounter {
+		return false
+	}
+	if counter == c.recvCounter {
+		return true
+	}
+	diff := c.recvCounter - counter
+	if diff > replayWindow {
+		return true
+	}
+	return c.recvBits&(1<<(diff-1)) != 0
+}
+
+func (c *Cipher) markReceived(counter uint64) {
+	if !c.hasRecv {
+		c.hasRecv = true
+		c.recvCounter = counter
+		return
+	}
+	if counter > c.recvCounter {
+		diff := counter - c.recvCounter
+		if diff >= replayWindow {
+			c.recvBits = 0
+		} else {
+			c.recvBits <<= diff
+		}
+		if diff <= replayWindow {
+			c.recvBits |= 1 << (diff - 1)
+		}
+		c.recvCounter = counter
+		return
+	}
+	c.recvBits |= 1 << (c.recvCounter - counter - 1)
+}
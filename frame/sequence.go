@@ -0,0 +1,218 @@
+package frame
+
+import (
+	"gameserver/utils"
+	"sync"
+	"time"
+)
+
+// Sequenced frames carries a sequence section right after the version header
+// |--------------------------------------|
+// | sequence |   ack   |    ack bits     |
+// |--------------------------------------|
+// |  2byte   |  2byte  |     4byte       |
+// |--------------------------------------|
+// ack is the latest sequence received from the peer,
+// bit n of ack bits is set when ack-(n+1) is also received
+
+const (
+	FlagSequenced uint8 = 1 << 1
+
+	SequenceHeaderSize int = 8
+
+	// number of sent packets remembered for ack and loss tracking
+	sentHistorySize int = 1024
+	ackWindow       int = 32
+)
+
+func readSequence(section []byte, p *Packet) {
+	p.Seq, _ = utils.ReadLE[uint16](section)
+	p.Ack, _ = utils.ReadLE[uint16](section[2:])
+	p.AckBits, _ = utils.ReadLE[uint32](section[4:])
+}
+
+func writeSequence(dst []byte, p *Packet) []byte {
+	dst = utils.AppendLE(dst, p.Seq)
+	dst = utils.AppendLE(dst, p.Ack)
+	return utils.AppendLE(dst, p.AckBits)
+}
+
+// SeqGreater compares sequence numbers with wrap around
+func SeqGreater(a, b uint16) bool {
+	return int16(a-b) > 0
+}
+
+// SequenceStats is the delivery statistics of one peer
+type SequenceStats struct {
+	Sent       uint64
+	Acked      uint64
+	Lost       uint64
+	Received   uint64
+	Duplicates uint64
+	OutOfOrder uint64
+	// smoothed round trip time measured from acks
+	RTT time.Duration
+}
+
+// LossRate is the ratio of lost packets to the resolved (acked or lost) ones
+func (s SequenceStats) LossRate() float64 {
+	resolved := s.Acked + s.Lost
+	if resolved == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(resolved)
+}
+
+type sentPacket struct {
+	seq      uint16
+	sentAt   time.Time
+	pending  bool
+	acked    bool
+	resolved bool
+}
+
+// Sequencer tracks sequence numbers of one connection.
+// it stamps outgoing packets with its own sequence and ack of the peer,
+// and reads the acks of incoming packets to find out what the peer has received.
+// it is safe for concurrent use
+type Sequencer struct {
+	mu sync.Mutex
+
+	localSeq uint16
+	// oldest sent sequence that is not resolved yet
+	oldest uint16
+	sent   [sentHistorySize]sentPacket
+
+	hasRemote  bool
+	remoteSeq  uint16
+	remoteBits uint32
+
+	stats SequenceStats
+}
+
+// NewSequencer starts sequences from 1,
+// so an ack of 0 sent before anything is received never acks a real packet
+func NewSequencer() *Sequencer {
+	return &Sequencer{
+		localSeq: 1,
+	}
+}
+
+// Stamp sets sequence and ack fields of an outgoing packet
+func (s *Sequencer) Stamp(p *Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.Flags |= FlagSequenced
+	p.Seq = s.localSeq
+	p.Ack = s.remoteSeq
+	p.AckBits = s.remoteBits
+	s.sent[int(s.localSeq)%sentHistorySize] = sentPacket{seq: s.localSeq, sentAt: time.Now(), pending: true}
+	if s.stats.Sent == 0 {
+		s.oldest = s.localSeq
+	}
+	s.stats.Sent++
+	s.localSeq++
+}
+
+// Receive processes an incoming sequenced packet.
+// returns false for duplicates and packets too old to track, those should be dropped
+func (s *Sequencer) Receive(p *Packet) bool {
+	if p.Flags&FlagSequenced == 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.receiveSeq(p.Seq) {
+		s.stats.Duplicates++
+		return false
+	}
+	s.stats.Received++
+	s.receiveAck(p.Ack, p.AckBits)
+	return true
+}
+
+func (s *Sequencer) receiveSeq(seq uint16) bool {
+	if !s.hasRemote {
+		s.hasRemote = true
+		s.remoteSeq = seq
+		return true
+	}
+	diff := int(int16(seq - s.remoteSeq))
+	switch {
+	case diff > 0:
+		if diff >= ackWindow {
+			s.remoteBits = 0
+		} else {
+			s.remoteBits <<= uint(diff)
+		}
+		if diff <= ackWindow {
+			s.remoteBits |= 1 << uint(diff-1)
+		}
+		s.remoteSeq = seq
+		return true
+	case diff == 0:
+		return false
+	default:
+		if -diff > ackWindow {
+			return false
+		}
+		bit := uint32(1) << uint(-diff-1)
+		if s.remoteBits&bit != 0 {
+			return false
+		}
+		s.remoteBits |= bit
+		s.stats.OutOfOrder++
+		return true
+	}
+}
+
+func (s *Sequencer) receiveAck(ack uint16, bits uint32) {
+	s.markAcked(ack)
+	for i := 0; i < ackWindow; i++ {
+		if bits&(1<<uint(i)) != 0 {
+			s.markAcked(ack - uint16(i+1))
+		}
+	}
+	// packets fallen out of the ack window without an ack are lost
+	for s.stats.Sent > 0 && s.oldest != s.localSeq && int(int16(ack-s.oldest)) > ackWindow {
+		sent := &s.sent[int(s.oldest)%sentHistorySize]
+		if sent.seq == s.oldest && sent.pending && !sent.resolved {
+			sent.resolved = true
+			s.stats.Lost++
+		}
+		s.oldest++
+	}
+}
+
+func (s *Sequencer) markAcked(seq uint16) {
+	if !SeqGreater(s.localSeq, seq) {
+		return
+	}
+	sent := &s.sent[int(seq)%sentHistorySize]
+	if sent.seq != seq || !sent.pending || sent.resolved {
+		return
+	}
+	sent.acked = true
+	sent.resolved = true
+	s.stats.Acked++
+	rtt := time.Since(sent.sentAt)
+	if s.stats.RTT == 0 {
+		s.stats.RTT = rtt
+	} else {
+		s.stats.RTT += (rtt - s.stats.RTT) / 8
+	}
+}
+
+func (s *Sequencer) Stats() SequenceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// IsAcked reports whether a sent sequence is acked by the peer
+func (s *Sequencer) IsAcked(seq uint16) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent := s.sent[int(seq)%sentHistorySize]
+	return sent.seq == seq && sent.acked
+}
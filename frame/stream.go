@@ -0,0 +1,125 @@
+package frame
+
+import (
+	"bufio"
+	"errors"
+	"gameserver/utils"
+	"io"
+	"sync"
+)
+
+// Streams carry frames over reliable byte streams (TCP, WebSocket or any net.Conn)
+// |--------------------------|
+// |  length  |     frame     |
+// |--------------------------|
+// |  4byte   |   length byte |
+// |--------------------------|
+// frames are sent whole, streams are ordered so they are never fragmented or bundled
+
+const StreamLengthSize int = 4
+
+var ErrInvalidStream error = errors.New("frame: invalid stream frame length")
+
+// StreamWriter writes length prefixed frames to a stream.
+// every frame is written with a single write call.
+// it is safe for concurrent use
+type StreamWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	buffer []byte
+}
+
+func NewStreamWriter(w io.Writer) *StreamWriter {
+	return &StreamWriter{w: w}
+}
+
+// WritePacket encodes p and writes it
+func (w *StreamWriter) WritePacket(p *Packet) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	buffer, err := AppendMarshal(append(w.buffer[:0], 0, 0, 0, 0), p)
+	if err != nil {
+		return err
+	}
+	return w.write(buffer)
+}
+
+// WriteFrame writes a frame that is already encoded or sealed
+func (w *StreamWriter) WriteFrame(packet []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.write(append(append(w.buffer[:0], 0, 0, 0, 0), packet...))
+}
+
+// write fills the length prefix in front of the frame and writes both
+func (w *StreamWriter) write(buffer []byte) error {
+	w.buffer = buffer
+	length := len(buffer) - StreamLengthSize
+	if length == 0 {
+		return ErrInvalidStream
+	}
+	if length > MaxFrameSize {
+		return ErrOversize
+	}
+	utils.PutLE(buffer, uint32(length))
+	_, err := w.w.Write(buffer)
+	return err
+}
+
+// StreamReader reads length prefixed frames from a stream.
+// a frame longer than MaxFrameSize or an empty one breaks the stream, it must be closed
+type StreamReader struct {
+	r      *bufio.Reader
+	buffer []byte
+}
+
+func NewStreamReader(r io.Reader) *StreamReader {
+	return &StreamReader{r: bufio.NewReader(r)}
+}
+
+// ReadFrame returns the next frame, it is valid until the next read.
+// returns io.EOF when the stream ends between frames and
+// io.ErrUnexpectedEOF when it ends inside a frame
+func (r *StreamReader) ReadFrame() ([]byte, error) {
+	var prefix [StreamLengthSize]byte
+	_, err := io.ReadFull(r.r, prefix[:])
+	if err != nil {
+		return nil, err
+	}
+	length, _ := utils.ReadLE[uint32](prefix[:])
+	if length == 0 || length > uint32(MaxFrameSize) {
+		return nil, ErrInvalidStream
+	}
+	if cap(r.buffer) < int(length) {
+		r.buffer = make([]byte, length)
+	}
+	r.buffer = r.buffer[:length]
+	_, err = io.ReadFull(r.r, r.buffer)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.buffer, nil
+}
+
+// ReadPacket reads and decodes the next frame
+func (r *StreamReader) ReadPacket() (*Packet, error) {
+	p := &Packet{}
+	err := r.ReadInto(p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReadInto reads the next frame and decodes it into p, see DecodeInto.
+// a frame that can not be decoded is consumed, the stream stays usable
+func (r *StreamReader) ReadInto(p *Packet) error {
+	packet, err := r.ReadFrame()
+	if err != nil {
+		return err
+	}
+	return DecodeInto(packet, p)
+}
@@ -0,0 +1,50 @@
+package frame
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// Session tickets bind the UDP registration of a client to its matcher handshake.
+// matcher answers a random ticket with the game and client IDs and the register event
+// carries it as a bytes payload, legacy frames can not carry a ticket
+
+const SessionTicketSize int = 16
+
+var ErrInvalidTicket error = errors.New("frame: invalid session ticket")
+
+func NewSessionTicket() ([]byte, error) {
+	ticket := make([]byte, SessionTicketSize)
+	_, err := rand.Read(ticket)
+	if err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// CreateRegisterPack creates the register packet of a client, ticket is nil when tickets are not used
+func CreateRegisterPack(gameID, clientID uint16, ticket []byte) *Packet {
+	p := CreatePack(gameID, clientID, Events.Register)
+	if ticket != nil {
+		p.Events[0].Payload = BytesPayload(ticket)
+	}
+	return p
+}
+
+// SessionTicket returns the ticket of a register packet, nil when it has none
+func SessionTicket(p *Packet) []byte {
+	for _, e := range p.Events {
+		if e.ID == Events.Register && e.IsTyped() && e.Payload.Type == PayloadBytes {
+			return e.Payload.Value
+		}
+	}
+	return nil
+}
+
+// validateRegister accepts the legacy data or a ticket
+func validateRegister(e *Event) error {
+	if e.IsTyped() && (e.Payload.Type != PayloadBytes || len(e.Payload.Value) != SessionTicketSize) {
+		return ErrInvalidTicket
+	}
+	return nil
+}
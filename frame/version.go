@@ -0,0 +1,325 @@
+package frame
+
+import "errors"
+
+// Versioned frames starts with a version header and continues with the legacy layout
+// |------------------------------------|----------------------------------------
+// |           version header           |   legacy layout (header, events, time)
+// |------------------------------------|----------------------------------------
+// |  magic  | version | flags          | clientID | gameID | number of event ...
+// |------------------------------------|----------------------------------------
+// |  2byte  |  1byte  | 1byte          |  2byte   | 2byte  |     1byte       ...
+// |------------------------------------|----------------------------------------
+// frames without magic are Version0 (legacy) frames
+
+const (
+	Version0 uint8 = 0
+	Version1 uint8 = 1
+
+	// version that clients and server speak by default
+	CurrentVersion uint8 = Version1
+
+	VersionHeaderSize int = 4
+)
+
+var (
+	Magic = [2]byte{'G', 'S'}
+
+	// largest frame of any supported version.
+	// typed events are variable sized, bigger frames are rejected
+	MaxFrameSize int = 1 << 18
+	// largest datagram, frames larger than the MTU are fragmented by the sender
+	MaxDatagramSize int = 65507
+
+	ErrUnsupportedVersion error = errors.New("frame: unsupported protocol version")
+	ErrUnsupportedFlags   error = errors.New("frame: unsupported header flags")
+
+	codecs = map[uint8]Codec{}
+)
+
+// Codec encodes and decodes a single protocol version.
+// new header layouts are added as new codecs so old clients keep working
+type Codec interface {
+	Version() uint8
+	Validate(packet []byte) error
+	// DecodeInto overwrites p, see DecodeInto
+	DecodeInto(packet []byte, p *Packet) error
+	// AppendEncode appends the encoded packet to dst
+	AppendEncode(dst []byte, p *Packet) ([]byte, error)
+}
+
+func init() {
+	RegisterCodec(legacyCodec{})
+	RegisterCodec(v1Codec{})
+}
+
+// RegisterCodec adds or replaces the codec of a protocol version
+func RegisterCodec(c Codec) {
+	codecs[c.Version()] = c
+}
+
+func IsSupportedVersion(version uint8) bool {
+	_, exists := codecs[version]
+	return exists
+}
+
+// PeekVersion reads the protocol version of a raw frame without decoding it
+func PeekVersion(packet []byte) (uint8, error) {
+	if !hasMagic(packet) {
+		return Version0, nil
+	}
+	if len(packet) < VersionHeaderSize {
+		return 0, ErrShortHeader
+	}
+	return packet[2], nil
+}
+
+// IsReservedClientID reports client IDs that can not be used with legacy frames.
+// little endian bytes of those IDs are equal to magic so their frames looks versioned
+func IsReservedClientID(clientID uint16) bool {
+	return uint8(clientID) == Magic[0] && uint8(clientID>>8) == Magic[1]
+}
+
+func hasMagic(packet []byte) bool {
+	return len(packet) >= len(Magic) && packet[0] == Magic[0] && packet[1] == Magic[1]
+}
+
+// legacyCodec is the original layout without version header
+type legacyCodec struct{}
+
+func (legacyCodec) Version() uint8 {
+	return Version0
+}
+
+func (legacyCodec) Validate(packet []byte) error {
+	return validateLegacy(packet)
+}
+
+func (c legacyCodec) DecodeInto(packet []byte, p *Packet) error {
+	err := c.Validate(packet)
+	if err != nil {
+		return err
+	}
+	p.reset()
+	unmarshalLegacy(packet, p)
+	return nil
+}
+
+func (legacyCodec) AppendEncode(dst []byte, p *Packet) ([]byte, error) {
+	if p.Flags != 0 {
+		return dst, ErrUnsupportedFlags
+	}
+	if hasTypedEvents(p) {
+		return dst, ErrTypedEventInLegacy
+	}
+	return appendLegacy(dst, p)
+}
+
+// v1Codec prepends the version header to the legacy layout.
+// optional header sections are placed in between, in the order of v1Sections
+type v1Codec struct{}
+
+// headerSection is an optional part of the version 1 header, present when its flag is set
+type headerSection struct {
+	flag  uint8
+	size  int
+	read  func(section []byte, p *Packet)
+	write func(dst []byte, p *Packet) []byte
+	// validate is optional
+	validate func(section []byte) error
+}
+
+var v1Sections = []headerSection{
+	{FlagSequenced, SequenceHeaderSize, readSequence, writeSequence, nil},
+	{FlagReliable, ReliableHeaderSize, readReliable, writeReliable, validateReliable},
+	{FlagFragment, FragmentHeaderSize, readFragment, writeFragment, validateFragment},
+	// compression section must stay the last one, it is read right before the body
+	{FlagCompressed, CompressionHeaderSize, readCompression, writeCompression, validateCompression},
+}
+
+// flags understood by version 1
+const v1Flags uint8 = FlagTypedEvents | FlagSequenced | FlagReliable | FlagFragment | FlagChecksum | FlagCompressed | FlagCompact
+
+func (v1Codec) Version() uint8 {
+	return Version1
+}
+
+func (c v1Codec) Validate(packet []byte) error {
+	flags, body, err := c.open(packet)
+	if err != nil {
+		return err
+	}
+	return validateV1Body(flags, body)
+}
+
+// open checks the version header and sections,
+// returns the body without checksum trailer and compression
+func (v1Codec) open(packet []byte) (uint8, []byte, error) {
+	if len(packet) < VersionHeaderSize {
+		return 0, nil, ErrShortHeader
+	}
+	flags := packet[3]
+	if flags&FlagEncrypted != 0 {
+		// sealed frames are opened with the session cipher first
+		return 0, nil, ErrSealed
+	}
+	if flags&^v1Flags != 0 {
+		return 0, nil, ErrUnsupportedFlags
+	}
+	if flags&FlagChecksum != 0 {
+		var err error
+		packet, err = verifyChecksum(packet)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	offset := v1HeaderSize(flags)
+	if len(packet) < offset {
+		return 0, nil, ErrShortHeader
+	}
+	sectionOffset := VersionHeaderSize
+	for _, section := range v1Sections {
+		if flags&section.flag == 0 {
+			continue
+		}
+		if section.validate != nil {
+			err := section.validate(packet[sectionOffset : sectionOffset+section.size])
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		sectionOffset += section.size
+	}
+	body := packet[offset:]
+	if flags&FlagCompressed != 0 {
+		var err error
+		body, err = decompressBody(packet[offset-CompressionHeaderSize], body)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	return flags, body, nil
+}
+
+func validateV1Body(flags uint8, body []byte) error {
+	if flags&FlagFragment != 0 {
+		return validateFragmentBody(body)
+	}
+	if flags&FlagCompact != 0 {
+		return validateCompact(body)
+	}
+	if flags&FlagTypedEvents != 0 {
+		return validateTyped(body)
+	}
+	return validateLegacy(body)
+}
+
+func (c v1Codec) DecodeInto(packet []byte, p *Packet) error {
+	flags, body, err := c.open(packet)
+	if err != nil {
+		return err
+	}
+	p.reset()
+	switch {
+	case flags&FlagFragment != 0:
+		err = validateFragmentBody(body)
+	case flags&FlagCompact != 0:
+		// compact bodies are validated while they are decoded
+		err = unmarshalCompact(body, p)
+	default:
+		err = validateV1Body(flags, body)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case flags&(FlagFragment|FlagCompact) != 0:
+		// fragment body is read after the sections, compact one is already decoded
+	case flags&FlagTypedEvents != 0:
+		unmarshalTyped(body, p)
+	default:
+		unmarshalLegacy(body, p)
+	}
+	p.Version = Version1
+	p.Flags = flags
+	sectionOffset := VersionHeaderSize
+	for _, section := range v1Sections {
+		if flags&section.flag != 0 {
+			section.read(packet[sectionOffset:sectionOffset+section.size], p)
+			sectionOffset += section.size
+		}
+	}
+	if flags&FlagFragment != 0 {
+		unmarshalFragmentBody(body, p)
+	}
+	return nil
+}
+
+// AppendEncode writes the header and body in place.
+// compression section is the last one, so a body that pays off compressing
+// is replaced behind it without moving the other sections
+func (v1Codec) AppendEncode(dst []byte, p *Packet) ([]byte, error) {
+	// compressed flag is set below when compression pays off
+	flags := p.Flags &^ FlagCompressed
+	if flags&^v1Flags != 0 {
+		return dst, ErrUnsupportedFlags
+	}
+	if hasTypedEvents(p) && flags&FlagCompact == 0 {
+		flags |= FlagTypedEvents
+	}
+	if flags&FlagFragment != 0 && p.Fragment == nil {
+		return dst, ErrInvalidFragment
+	}
+	start := len(dst)
+	buffer := append(dst, Magic[0], Magic[1], Version1, flags)
+	for _, section := range v1Sections {
+		if flags&section.flag != 0 {
+			buffer = section.write(buffer, p)
+		}
+	}
+	bodyStart := len(buffer)
+	var err error
+	switch {
+	case flags&FlagFragment != 0:
+		buffer = appendFragmentBody(buffer, p)
+	case flags&FlagCompact != 0:
+		buffer, err = appendCompact(buffer, p)
+	case flags&FlagTypedEvents != 0:
+		buffer, err = appendTyped(buffer, p)
+	default:
+		buffer, err = appendLegacy(buffer, p)
+	}
+	if err != nil {
+		return dst, err
+	}
+	if p.Compression != CompressionNone {
+		compressed, err := compressBody(p.Compression, buffer[bodyStart:])
+		if err != nil {
+			return dst, err
+		}
+		if compressed != nil {
+			flags |= FlagCompressed
+			buffer[start+3] = flags
+			buffer = writeCompression(buffer[:bodyStart], p)
+			buffer = append(buffer, compressed...)
+		}
+	}
+	if flags&FlagChecksum != 0 {
+		buffer = appendChecksum(buffer, start)
+	}
+	if len(buffer)-start > MaxFrameSize {
+		return dst, ErrOversize
+	}
+	return buffer, nil
+}
+
+// v1HeaderSize is the size of version header and the sections flagged in it
+func v1HeaderSize(flags uint8) int {
+	size := VersionHeaderSize
+	for _, section := range v1Sections {
+		if flags&section.flag != 0 {
+			size += section.size
+		}
+	}
+	return size
+}
@@ -1,5 +1,7 @@
 module gameserver
 
-go 1.16
+go 1.18
 
 require golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
+
+require golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
@@ -0,0 +1,141 @@
+package quantize
+
+import (
+	"errors"
+	"gameserver/frame"
+	"gameserver/utils"
+)
+
+// Quantized values travel as bytes payloads of typed events
+// |-------------------------------------|
+// | number of values | values...        |
+// |-------------------------------------|
+// |     uvarint      | Bits() per value |
+// |-------------------------------------|
+// the receiver needs the same encoder as the sender, ranges and bits are not sent.
+// values of at most 32 bits also fit the data of a legacy event
+
+var (
+	ErrInvalidPayload error = errors.New("quantize: invalid quantized payload")
+	ErrTooManyBits    error = errors.New("quantize: value does not fit 32 bits")
+)
+
+// encoder is implemented by Scalar, Vector and Rotation
+type encoder[T any] interface {
+	Bits() int
+	Write(w *utils.BitWriter, v T) error
+	Read(r *utils.BitReader) (T, error)
+}
+
+// Payload quantizes values into a typed event payload
+func (s *Scalar) Payload(values ...float32) (*frame.Payload, error) {
+	return payloadOf[float32](s, values)
+}
+
+// Values dequantizes a payload of Payload
+func (s *Scalar) Values(p *frame.Payload) ([]float32, error) {
+	return valuesOf[float32](s, p)
+}
+
+// Data quantizes a value into the data of a legacy event
+func (s *Scalar) Data(v float32) (int32, error) {
+	return dataOf[float32](s, v)
+}
+
+func (s *Scalar) FromData(data int32) (float32, error) {
+	return fromData[float32](s, data)
+}
+
+func (v *Vector) Payload(values ...[]float32) (*frame.Payload, error) {
+	return payloadOf[[]float32](v, values)
+}
+
+func (v *Vector) Values(p *frame.Payload) ([][]float32, error) {
+	return valuesOf[[]float32](v, p)
+}
+
+func (v *Vector) Data(value []float32) (int32, error) {
+	return dataOf[[]float32](v, value)
+}
+
+func (v *Vector) FromData(data int32) ([]float32, error) {
+	return fromData[[]float32](v, data)
+}
+
+func (r *Rotation) Payload(values ...Quaternion) (*frame.Payload, error) {
+	return payloadOf[Quaternion](r, values)
+}
+
+func (r *Rotation) Values(p *frame.Payload) ([]Quaternion, error) {
+	return valuesOf[Quaternion](r, p)
+}
+
+func (r *Rotation) Data(q Quaternion) (int32, error) {
+	return dataOf[Quaternion](r, q)
+}
+
+func (r *Rotation) FromData(data int32) (Quaternion, error) {
+	return fromData[Quaternion](r, data)
+}
+
+func payloadOf[T any](e encoder[T], values []T) (*frame.Payload, error) {
+	w := utils.NewBitWriter(1 + (len(values)*e.Bits()+7)/8)
+	w.WriteUvarint(uint64(len(values)))
+	for _, v := range values {
+		err := e.Write(w, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(w.Bytes()) > frame.MaxPayloadSize {
+		return nil, frame.ErrPayloadTooLarge
+	}
+	return &frame.Payload{Type: frame.PayloadBytes, Value: w.Bytes()}, nil
+}
+
+func valuesOf[T any](e encoder[T], p *frame.Payload) ([]T, error) {
+	value, err := p.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	r := utils.NewBitReader(value)
+	count, err := r.ReadUvarint()
+	if err != nil || e.Bits() == 0 || count > uint64(r.Remaining()) {
+		return nil, ErrInvalidPayload
+	}
+	// the count is checked before allocating, padding is less than a byte
+	size := count * uint64(e.Bits())
+	if size > uint64(r.Remaining()) || uint64(r.Remaining())-size >= 8 {
+		return nil, ErrInvalidPayload
+	}
+	values := make([]T, count)
+	for i := range values {
+		values[i], err = e.Read(r)
+		if err != nil {
+			return nil, ErrInvalidPayload
+		}
+	}
+	return values, nil
+}
+
+func dataOf[T any](e encoder[T], v T) (int32, error) {
+	if e.Bits() > 32 {
+		return 0, ErrTooManyBits
+	}
+	w := utils.NewBitWriter(4)
+	err := e.Write(w, v)
+	if err != nil {
+		return 0, err
+	}
+	w.WriteBits(0, 32-e.Bits())
+	data, _ := utils.ReadLE[int32](w.Bytes())
+	return data, nil
+}
+
+func fromData[T any](e encoder[T], data int32) (T, error) {
+	if e.Bits() > 32 {
+		var zero T
+		return zero, ErrTooManyBits
+	}
+	return e.Read(utils.NewBitReader(utils.AppendLE(nil, data)))
+}
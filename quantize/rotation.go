@@ -0,0 +1,105 @@
+package quantize
+
+import (
+	"gameserver/utils"
+	"math"
+)
+
+// Rotations are quaternions sent with the smallest three method
+// |---------------------------------------------|
+// | largest index | three smaller components     |
+// |---------------------------------------------|
+// |     2bit      | 3 x bits of the rotation     |
+// |---------------------------------------------|
+// the largest component is left out and made positive, q and -q are the same rotation.
+// the others are within [-1/sqrt2, 1/sqrt2] and the largest is rebuilt from them
+
+const largestIndexBits int = 2
+
+// Quaternion is a rotation as x, y, z, w
+type Quaternion [4]float32
+
+// Rotation quantizes unit quaternions, values are normalized before they are written
+type Rotation struct {
+	component *Scalar
+}
+
+// NewRotation returns a rotation that quantizes the three smaller components to n bits
+func NewRotation(n int) (*Rotation, error) {
+	component, err := NewScalarBits(-math.Sqrt2/2, math.Sqrt2/2, n)
+	if err != nil {
+		return nil, err
+	}
+	return &Rotation{component: component}, nil
+}
+
+func (r *Rotation) Bits() int {
+	return largestIndexBits + 3*r.component.bits
+}
+
+// MaxError is the largest error of a component of a normalized quaternion whose largest component is positive
+func (r *Rotation) MaxError() float32 {
+	// largest component is at least 1/2 and the others sum up to at most 3/4,
+	// so the rebuilt one is off by at most 6e + 6e^2
+	e := float64(r.component.MaxError())
+	return float32(6*e + 6*e*e)
+}
+
+func (r *Rotation) Write(w *utils.BitWriter, q Quaternion) error {
+	q = Normalize(q)
+	largest := 0
+	for i := range q {
+		if math.Abs(float64(q[i])) > math.Abs(float64(q[largest])) {
+			largest = i
+		}
+	}
+	sign := float32(1)
+	if q[largest] < 0 {
+		sign = -1
+	}
+	w.WriteBits(uint64(largest), largestIndexBits)
+	for i := range q {
+		if i != largest {
+			r.component.Write(w, sign*q[i])
+		}
+	}
+	return nil
+}
+
+func (r *Rotation) Read(reader *utils.BitReader) (Quaternion, error) {
+	var q Quaternion
+	index, err := reader.ReadBits(largestIndexBits)
+	if err != nil {
+		return q, err
+	}
+	largest := int(index)
+	sum := 0.0
+	for i := range q {
+		if i == largest {
+			continue
+		}
+		q[i], err = r.component.Read(reader)
+		if err != nil {
+			return q, err
+		}
+		sum += float64(q[i]) * float64(q[i])
+	}
+	q[largest] = float32(math.Sqrt(math.Max(0, 1-sum)))
+	return q, nil
+}
+
+// Normalize returns q scaled to unit length, zero and non finite quaternions are the identity
+func Normalize(q Quaternion) Quaternion {
+	length := 0.0
+	for _, c := range q {
+		length += float64(c) * float64(c)
+	}
+	length = math.Sqrt(length)
+	if length == 0 || math.IsNaN(length) || math.IsInf(length, 0) {
+		return Quaternion{0, 0, 0, 1}
+	}
+	for i := range q {
+		q[i] = float32(float64(q[i]) / length)
+	}
+	return q
+}
@@ -0,0 +1,116 @@
+package quantize
+
+import (
+	"errors"
+	"gameserver/utils"
+	"math"
+	"math/bits"
+)
+
+// Values are quantized to an unsigned integer of a fixed number of bits,
+// 0 is the minimum of the range and all bits set is the maximum.
+// values out of range are clamped and NaN is quantized as the minimum
+
+const (
+	// MaxBits is the largest quantized size of a single scalar
+	MaxBits int = 32
+)
+
+var (
+	ErrInvalidRange     error = errors.New("quantize: invalid range")
+	ErrInvalidPrecision error = errors.New("quantize: precision can not be reached with 32 bits and float32 values")
+	ErrInvalidBits      error = errors.New("quantize: invalid number of bits")
+)
+
+// Scalar quantizes float32 values of a range
+type Scalar struct {
+	min  float64
+	max  float64
+	bits int
+	// value of a single quantization step
+	step float64
+}
+
+// NewScalar returns a scalar that keeps values of [min, max] within precision/2,
+// it uses the fewest bits that make a step small enough
+func NewScalar(min, max, precision float32) (*Scalar, error) {
+	if !validRange(min, max) || !(precision > 0) || math.IsInf(float64(precision), 0) {
+		return nil, ErrInvalidRange
+	}
+	// part of the precision is lost to float32 rounding of dequantized values
+	step := float64(precision) - 2*rounding(float64(min), float64(max))
+	if step <= 0 {
+		return nil, ErrInvalidPrecision
+	}
+	steps := math.Ceil((float64(max) - float64(min)) / step)
+	if steps >= 1<<MaxBits {
+		return nil, ErrInvalidPrecision
+	}
+	return NewScalarBits(min, max, bits.Len64(uint64(steps)))
+}
+
+// NewScalarBits returns a scalar that quantizes values of [min, max] to n bits
+func NewScalarBits(min, max float32, n int) (*Scalar, error) {
+	if !validRange(min, max) {
+		return nil, ErrInvalidRange
+	}
+	if n < 1 || n > MaxBits {
+		return nil, ErrInvalidBits
+	}
+	return &Scalar{
+		min:  float64(min),
+		max:  float64(max),
+		bits: n,
+		step: (float64(max) - float64(min)) / float64(uint64(1)<<n-1),
+	}, nil
+}
+
+func validRange(min, max float32) bool {
+	return !math.IsInf(float64(min), 0) && !math.IsInf(float64(max), 0) && min < max
+}
+
+// rounding is the largest float32 rounding error of values in [min, max]
+func rounding(min, max float64) float64 {
+	return math.Max(math.Abs(min), math.Abs(max)) / (1 << 24)
+}
+
+func (s *Scalar) Bits() int {
+	return s.bits
+}
+
+// MaxError is the largest difference between a value in range and its dequantized value
+func (s *Scalar) MaxError() float32 {
+	// dequantized values are rounded to float32 as well
+	return float32(s.step/2 + rounding(s.min, s.max))
+}
+
+func (s *Scalar) Quantize(v float32) uint32 {
+	value := float64(v)
+	switch {
+	case math.IsNaN(value) || value <= s.min:
+		return 0
+	case value >= s.max:
+		return uint32(uint64(1)<<s.bits - 1)
+	}
+	return uint32(math.Round((value - s.min) / s.step))
+}
+
+func (s *Scalar) Dequantize(q uint32) float32 {
+	if uint64(q) >= uint64(1)<<s.bits-1 {
+		return float32(s.max)
+	}
+	return float32(s.min + float64(q)*s.step)
+}
+
+func (s *Scalar) Write(w *utils.BitWriter, v float32) error {
+	w.WriteBits(uint64(s.Quantize(v)), s.bits)
+	return nil
+}
+
+func (s *Scalar) Read(r *utils.BitReader) (float32, error) {
+	q, err := r.ReadBits(s.bits)
+	if err != nil {
+		return 0, err
+	}
+	return s.Dequantize(uint32(q)), nil
+}
@@ -0,0 +1,80 @@
+package quantize
+
+import (
+	"errors"
+	"gameserver/utils"
+)
+
+var ErrDimension error = errors.New("quantize: vector dimension mismatch")
+
+// Vector quantizes 2D, 3D or longer float32 vectors, every axis with its own scalar.
+// positions and velocities are vectors with the range of the game world and the fastest move
+type Vector struct {
+	axes []*Scalar
+}
+
+// NewVector returns a vector whose axes have the same range and precision
+func NewVector(dimensions int, min, max, precision float32) (*Vector, error) {
+	if dimensions < 1 {
+		return nil, ErrDimension
+	}
+	axis, err := NewScalar(min, max, precision)
+	if err != nil {
+		return nil, err
+	}
+	axes := make([]*Scalar, dimensions)
+	for i := range axes {
+		axes[i] = axis
+	}
+	return &Vector{axes: axes}, nil
+}
+
+// NewVectorOf returns a vector with a scalar per axis
+func NewVectorOf(axes ...*Scalar) *Vector {
+	return &Vector{axes: append([]*Scalar(nil), axes...)}
+}
+
+func (v *Vector) Dimensions() int {
+	return len(v.axes)
+}
+
+func (v *Vector) Bits() int {
+	n := 0
+	for _, axis := range v.axes {
+		n += axis.bits
+	}
+	return n
+}
+
+// MaxError is the largest error of a single component
+func (v *Vector) MaxError() float32 {
+	var max float32
+	for _, axis := range v.axes {
+		if e := axis.MaxError(); e > max {
+			max = e
+		}
+	}
+	return max
+}
+
+func (v *Vector) Write(w *utils.BitWriter, value []float32) error {
+	if len(value) != len(v.axes) {
+		return ErrDimension
+	}
+	for i, axis := range v.axes {
+		axis.Write(w, value[i])
+	}
+	return nil
+}
+
+func (v *Vector) Read(r *utils.BitReader) ([]float32, error) {
+	value := make([]float32, len(v.axes))
+	for i, axis := range v.axes {
+		c, err := axis.Read(r)
+		if err != nil {
+			return nil, err
+		}
+		value[i] = c
+	}
+	return value, nil
+}
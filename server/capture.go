@@ -0,0 +1,65 @@
+package server
+
+import (
+	"gameserver/frame"
+	"log"
+	"os"
+	"time"
+)
+
+// openCapture starts recording the traffic of the game router into a capture file.
+// records are written unbuffered so the file is complete whenever the server stops
+func (s *Server) openCapture(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	s.capture, err = frame.NewCaptureWriter(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	log.Printf("Recording game traffic into %v\n", path)
+	return nil
+}
+
+// recordInbound records a received datagram after it is opened.
+// unsealed datagrams are decoded to find out their IDs
+func (s *Server) recordInbound(datagram []byte, sealedBy *session, addr string) {
+	if s.capture == nil {
+		return
+	}
+	var gameID, clientID uint16
+	if sealedBy != nil {
+		gameID, clientID = sealedBy.gameID, sealedBy.player.ClientID
+	} else {
+		gameID, clientID, _ = frame.PeekIDs(datagram)
+	}
+	s.record(frame.ClientToServer, datagram, gameID, clientID, addr)
+}
+
+// recordOutbound records a datagram sent to a client before it is sealed
+func (s *Server) recordOutbound(datagram []byte, clientID uint16, addr string) {
+	if s.capture == nil {
+		return
+	}
+	var gameID uint16
+	if sess := s.session(clientID); sess != nil {
+		gameID = sess.gameID
+	}
+	s.record(frame.ServerToClient, datagram, gameID, clientID, addr)
+}
+
+func (s *Server) record(direction frame.Direction, datagram []byte, gameID, clientID uint16, peer string) {
+	err := s.capture.Write(&frame.CaptureRecord{
+		Time:      time.Now(),
+		Direction: direction,
+		GameID:    gameID,
+		ClientID:  clientID,
+		Peer:      peer,
+		Frame:     datagram,
+	})
+	if err != nil {
+		log.Printf("capture: %v\n", err)
+	}
+}
@@ -9,7 +9,15 @@ import (
 	"gameserver/utils"
 	"log"
 	"net"
+	"net/netip"
 	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// longest wait for reliable packets of an ended game
+	gameOverLinger time.Duration = 2 * time.Second
 )
 
 func (s *Server) GameRouter(ip, port string) {
@@ -25,88 +33,408 @@ func (s *Server) GameRouter(ip, port string) {
 		return
 	}
 	defer conn.Close()
+	if config.CaptureFile != "" {
+		err = s.openCapture(config.CaptureFile)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	go s.resendRoutine()
+	go s.coalesceRoutine()
 	s.gameRoutine(conn)
 }
 
 func (s *Server) gameRoutine(conn *net.UDPConn) {
 	for {
-		buff := make([]byte, frame.MaxPacketSize)
-		n, addr, err := conn.ReadFrom(buff)
+		buff := frame.GetBuffer()
+		n, addrPort, err := conn.ReadFromUDPAddrPort(*buff)
 		if err != nil {
+			frame.PutBuffer(buff)
 			log.Println(err)
 			continue
 		}
-		buff = buff[:n]
-		if frame.IsValid(buff) {
-			log.Println(frame.ErrInvalidEventPacket)
+		// limited before the datagram is opened, decrypted and decoded
+		addrPort = netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port())
+		if !s.allowDatagram(addrPort) {
+			frame.PutBuffer(buff)
 			continue
 		}
-		go s.eventRouter(buff, addr.String())
+		s.receiveDatagram((*buff)[:n], addrPort.String())
+		// decoded packets never refer to the read buffer
+		frame.PutBuffer(buff)
+	}
+}
+
+// receiveDatagram opens a datagram and receives every frame of it
+func (s *Server) receiveDatagram(datagram []byte, addr string) {
+	packet, sealedBy, err := s.open(datagram)
+	if err == nil {
+		s.recordInbound(packet, sealedBy, addr)
+	}
+	frames := [][]byte{packet}
+	if err == nil && frame.IsBundle(packet) {
+		frames, err = frame.Unbundle(packet)
+	}
+	if err != nil {
+		s.reject(err, addr)
+		return
+	}
+	for _, f := range frames {
+		s.receive(f, sealedBy, addr)
+	}
+}
+
+// receive decodes a single frame of a datagram into a pooled packet and routes it.
+// sealedBy is the session that sealed the datagram, nil when it was not sealed
+func (s *Server) receive(packet []byte, sealedBy *session, addr string) {
+	pack := frame.GetPacket()
+	complete, err := s.accept(packet, sealedBy, addr, pack)
+	if err != nil || !complete {
+		frame.PutPacket(pack)
+		if err != nil {
+			s.reject(err, addr)
+		}
+		return
+	}
+	go s.eventRouter(pack, addr)
+}
+
+// accept decodes a frame into pack and checks it, frames that are not fragmented
+// are accepted without allocating. complete is false for fragments of an incomplete frame
+func (s *Server) accept(packet []byte, sealedBy *session, addr string, pack *frame.Packet) (complete bool, err error) {
+	complete, err = s.reassembler.DecodeInto(addr, packet, pack)
+	if err != nil || !complete {
+		return false, err
+	}
+	if sealedBy != nil && (pack.ClientID != sealedBy.player.ClientID || pack.GameID != sealedBy.gameID) {
+		// a client can only speak for itself
+		err = frame.ErrSealedSession
+	}
+	if err == nil && config.PinClientAddress {
+		err = s.checkSender(pack, addr)
+	}
+	if err == nil {
+		// limited before a router goroutine is spawned for the packet
+		err = s.checkRate(pack)
+	}
+	if err == nil {
+		err = s.rebase(pack)
 	}
+	if err == nil {
+		err = s.checkPacket(pack)
+	}
+	return err == nil, err
+}
+
+func (s *Server) reject(err error, addr string) {
+	s.rejects.Inc(rejectReason(err))
+	log.Printf("[reject] %v. remote: %v\n", err, addr)
 }
 
-func (s *Server) eventRouter(buffer []byte, addr string) {
-	gameID := frame.GetGameID(buffer)
+func (s *Server) eventRouter(pack *frame.Packet, addr string) {
+	gameID := pack.GameID
 	players, exists := s.gameLobby[gameID]
 	if !exists {
 		// handle later
 		// log.Printf("event comming from GID: %v.", gameID)
+		frame.PutPacket(pack)
 		return
 	}
 
-	pack := frame.Unmarshal(buffer)
+	// register packets are rare, they are left to the garbage collector
 	if pack.IsEventPack(frame.Events.Register) {
 		player, err := selectPlayer(players, pack.ClientID)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
+		if config.SessionTickets {
+			// IDs are easy to guess, the ticket proves the matcher handshake
+			err = s.redeemTicket(pack.ClientID, gameID, frame.SessionTicket(pack))
+			if err == errReusedTicket && s.registeredFrom(pack.ClientID, addr) {
+				// the ack of the register is lost, the connection acks the retransmission again
+				err = nil
+			}
+			if err != nil {
+				s.rejects.Inc(rejectReason(err))
+				log.Printf("[reject] %v. remote: %v\n", err, addr)
+				return
+			}
+		}
+		sess := s.openSession(player, gameID, nil)
+		_, err = sess.conn.Receive(pack)
+		if err != nil {
+			// retransmitted register
+			s.rejects.Inc(rejectReason(err))
+			return
+		}
 		// register UDP address
-		registerPlayer(player, addr)
+		registerPlayer(player, addr, pack.Version)
+		s.pinAddress(sess, addr)
 		if s.checkAllPlayerRegistered(players, pack.GameID) {
 			log.Println(">>> Sending game started event")
 			startEventPack := frame.CreateEventPacket(pack.GameID, frame.Events.Start, config.NullData)
 			s.broadCastWithGameID(startEventPack)
+			go s.snapshotRoutine(pack.GameID, s.openWorld(pack.GameID))
 			go s.simulateGameover(pack.GameID)
 		}
 		return
 	}
 
-	if pack.IsEventPack(frame.Events.Disconnect) {
-		s.broadCastWithGameID(frame.CreateEventPacket(gameID, frame.Events.GameOver, config.NullData))
+	sess := s.session(pack.ClientID)
+	if sess == nil {
+		s.route(pack)
+		return
+	}
+	// packets of a client are routed one by one to keep ordered messages in order.
+	// an ordered packet that waits for the missing ones is kept by the connection
+	sess.routeMu.Lock()
+	defer sess.routeMu.Unlock()
+	delivered, err := sess.conn.Receive(pack)
+	if err != nil {
+		s.rejects.Inc(rejectReason(err))
+		frame.PutPacket(pack)
 		return
 	}
+	for _, p := range delivered {
+		s.route(p)
+	}
+}
+
+// route routes a delivered packet and gives it back to the packet pool unless it is relayed
+func (s *Server) route(pack *frame.Packet) {
+	if s.routeEvent(pack) {
+		frame.PutPacket(pack)
+	}
+}
+
+// routeEvent handles a delivered packet, consumed is false when it is relayed to the game.
+// relayed packets are kept for retransmission and must not be reused
+func (s *Server) routeEvent(pack *frame.Packet) (consumed bool) {
+	if pack.IsEventPack(frame.Events.Ack) {
+		// ack packets only carry acks, they are already processed
+		return true
+	}
+
+	if pack.IsEventPack(frame.Events.Disconnect) {
+		s.broadCastWithGameID(frame.CreateEventPacket(pack.GameID, frame.Events.GameOver, config.NullData))
+		return true
+	}
+
+	if pack.IsEventPack(frame.Events.SnapshotAck) {
+		s.ackSnapshot(pack)
+		return true
+	}
 
 	someDataManipulationAndCorrectionProcess(pack)
+	s.updateWorld(pack)
 	s.broadCastWithGameID(pack)
+	return false
 }
 
+// broadCastWithGameID sends packet to all players of the game.
+// control events are sent reliably, relayed packets keep the delivery class of their sender
 func (s *Server) broadCastWithGameID(p *frame.Packet) {
-	packet := frame.Marshal(p)
-	players := s.gameLobby[p.GameID]
-	for _, p := range players {
-		if !p.IsRegistered() {
+	s.broadcast(p.GameID, func(*client.Client) *frame.Packet {
+		return p
+	})
+}
+
+// broadcast sends every player of the game its own packet,
+// players that packetOf returns nil for are skipped
+func (s *Server) broadcast(gameID uint16, packetOf func(player *client.Client) *frame.Packet) {
+	players := s.gameLobby[gameID]
+	for _, player := range players {
+		if !player.IsRegistered() {
 			log.Println("error. Broadcast to unattached connection")
 			return
 		}
+		if s.isDisconnected(player.ClientID) {
+			continue
+		}
+		p := packetOf(player)
+		if p == nil {
+			continue
+		}
+
+		// every player receives the packet with its own protocol version and sequence.
+		// flags belongs to the hop that packet arrived, they are set again for this one
+		outgoing := *p
+		outgoing.Version = player.Version
+		outgoing.Flags = 0
+		outgoing.Compression = player.Compression
+		outgoing.Delivery = s.events.Delivery(p)
+		sess := s.session(player.ClientID)
+		if config.FrameChecksum && player.Version != frame.Version0 && (sess == nil || sess.cipher == nil) {
+			outgoing.Flags = frame.FlagChecksum
+		}
+		setCompact(player, &outgoing)
+		if sess != nil && player.Version != frame.Version0 {
+			sess.conn.Send(&outgoing)
+		}
+		s.sendTo(player, &outgoing)
+	}
+}
 
-		// I need to change client udp ports because.
-		// Simulation in same computer would be impossible all client has same ip and same port
-		utils.SelectPort(p)
+// sendTo encodes packet with the player version and sends it to player UDP address,
+// or to its stream when the player registered over a stream.
+// frames of versioned players are coalesced when their session has a bundler
+func (s *Server) sendTo(player *client.Client, p *frame.Packet) {
+	buff := frame.GetBuffer()
+	defer frame.PutBuffer(buff)
+	packet, err := frame.AppendMarshal((*buff)[:0], p)
+	if err != nil {
+		// packet can not be downgraded to the player version
+		log.Printf("%v. client ID: %v, protocol version: %v\n", err, player.ClientID, player.Version)
+		return
+	}
+
+	var cipher *frame.Cipher
+	var bundler *frame.Bundler
+	if sess := s.session(player.ClientID); sess != nil {
+		cipher = sess.cipher
+		bundler = sess.bundler
+	}
 
+	if stream := s.stream(player.ClientID); stream != nil {
+		s.writeStream(player, cipher, stream, packet)
+		return
+	}
+
+	// legacy clients can not reassemble or unbundle, their frames always fit the MTU
+	datagrams := [][]byte{packet}
+	if player.Version != frame.Version0 {
+		fragmentID := uint16(atomic.AddUint32(&s.fragmentID, 1))
+		datagrams, err = frame.Split(packet, p.ClientID, p.GameID, fragmentID, datagramMTU(cipher))
+		if err != nil {
+			log.Printf("%v. client ID: %v\n", err, player.ClientID)
+			return
+		}
+		if bundler != nil {
+			var ready [][]byte
+			for _, datagram := range datagrams {
+				ready = append(ready, bundler.Add(datagram)...)
+			}
+			datagrams = ready
+		}
+	}
+	s.writeDatagrams(player, cipher, datagrams)
+}
+
+// writeDatagrams seals datagrams when cipher is not nil and sends them to player UDP address.
+// datagrams are recorded when the traffic is captured
+func (s *Server) writeDatagrams(player *client.Client, cipher *frame.Cipher, datagrams [][]byte) {
+	// I need to change client udp ports because.
+	// Simulation in same computer would be impossible all client has same ip and same port
+	utils.SelectPort(player)
+
+	for _, datagram := range datagrams {
+		// sealed datagrams can not be read back, they are recorded before sealing
+		s.recordOutbound(datagram, player.ClientID, player.Addr)
+		if cipher != nil {
+			datagram = cipher.Seal(datagram)
+		}
 		// NOTE an attemp system might be good
-		err := UDPSend(packet, p.Addr)
+		err := UDPSend(datagram, player.Addr)
 		if err != nil {
 			log.Println(err)
-			continue
 		}
 	}
 }
 
-func registerPlayer(player *client.Client, addr string) {
+// resendRoutine retransmits unacked reliable packets
+// and sends ack packets to clients that has nothing else to receive
+func (s *Server) resendRoutine() {
+	ticker := time.NewTicker(time.Duration(config.ResendTickMillisecond) * time.Millisecond)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, sess := range s.sessionList() {
+			if !sess.player.IsRegistered() {
+				continue
+			}
+			resend, err := sess.conn.Resend(now)
+			if err != nil {
+				// the client is lost, its game goes on without it
+				s.disconnect(sess.player.ClientID, err)
+				continue
+			}
+			for _, p := range resend {
+				s.sendTo(sess.player, p)
+			}
+			if sess.conn.AckDue() {
+				ack := frame.CreateEventPacket(sess.gameID, frame.Events.Ack, config.NullData)
+				ack.Version = sess.player.Version
+				ack.Compression = sess.player.Compression
+				setCompact(sess.player, ack)
+				sess.conn.Send(ack)
+				s.sendTo(sess.player, ack)
+			}
+		}
+	}
+}
+
+// coalesceRoutine sends the coalesced frames of every client once per coalesce tick
+func (s *Server) coalesceRoutine() {
+	ticker := time.NewTicker(time.Duration(config.CoalesceTickMillisecond) * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, sess := range s.sessionList() {
+			if sess.bundler == nil || !sess.player.IsRegistered() {
+				continue
+			}
+			if datagram := sess.bundler.Flush(); datagram != nil {
+				s.writeDatagrams(sess.player, sess.cipher, [][]byte{datagram})
+			}
+		}
+	}
+}
+
+// rebase moves compact packets to the session epoch of their sender.
+// sender must have negotiated compact frames
+func (s *Server) rebase(p *frame.Packet) error {
+	if p.Flags&frame.FlagCompact == 0 {
+		return nil
+	}
+	sess := s.session(p.ClientID)
+	if sess == nil || sess.player.Epoch.IsZero() {
+		return frame.ErrUnsupportedFlags
+	}
+	p.Rebase(sess.player.Epoch)
+	return nil
+}
+
+// setCompact sends versioned packets compact to players that negotiated it
+func setCompact(player *client.Client, p *frame.Packet) {
+	if player.Version == frame.Version0 || player.Epoch.IsZero() {
+		return
+	}
+	p.Flags |= frame.FlagCompact
+	p.Epoch = player.Epoch
+}
+
+func registerPlayer(player *client.Client, addr string, version uint8) {
 	player.Addr = addr
+	player.Version = version
 	player.UDPRegistered = true
-	log.Printf("Client UDP register success, client ID: %v\n", player.ClientID)
+	log.Printf("Client UDP register success, client ID: %v, protocol version: %v\n", player.ClientID, version)
+}
+
+// checkPacket applies version policy and event rules to an inbound packet
+func (s *Server) checkPacket(p *frame.Packet) error {
+	err := checkVersion(p)
+	if err != nil {
+		return err
+	}
+	return s.events.CheckPacket(p, frame.ClientToServer)
+}
+
+// checkVersion applies the server version policy.
+// legacy clients are answered with legacy frames, unless legacy frames are not accepted at all
+func checkVersion(p *frame.Packet) error {
+	if p.Version == frame.Version0 && !config.AcceptLegacyFrames {
+		return frame.ErrUnsupportedVersion
+	}
+	return nil
 }
 
 func selectPlayer(players []*client.Client, clientID uint16) (*client.Client, error) {
@@ -133,8 +461,14 @@ func (s *Server) checkAllPlayerRegistered(players []*client.Client, gameID uint1
 
 func (s *Server) simulateGameover(gameID uint16) {
 	utils.RandomSleepMillisecond(config.MinGameOverTime, config.MaxGameOverTime)
+	s.closeWorld(gameID)
 	s.broadCastWithGameID(frame.CreateEventPacket(gameID, frame.Events.GameOver, config.NullData))
 	fmt.Printf("# Game %v ended.\n", gameID)
+	// game over must be acked before the game is forgotten
+	s.waitDelivered(gameID, gameOverLinger)
+	s.closeSessions(gameID)
+	s.closeTickets(gameID)
+	s.gameLimit.Forget(gameID)
 	delete(s.gameLobby, gameID)
 }
 
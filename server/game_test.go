@@ -0,0 +1,47 @@
+package server
+
+import (
+	"gameserver/client"
+	"gameserver/frame"
+	"gameserver/utils"
+	"testing"
+	"time"
+)
+
+func TestAcceptZeroAllocation(t *testing.T) {
+	s := NewServer()
+	s.clientLimit = utils.NewRateLimiter[uint16](0, 0)
+	s.gameLimit = utils.NewRateLimiter[uint16](0, 0)
+	player := client.NewClient(1, nil)
+	player.Version = frame.CurrentVersion
+	player.Epoch = time.Now().Add(-time.Second)
+	addr := "127.0.0.1:40001"
+	s.pinAddress(s.openSession(player, 1, nil), addr)
+
+	ack := frame.CreatePack(1, 1, frame.Events.Ack)
+	ack.Flags = frame.FlagSequenced | frame.FlagChecksum
+	data := frame.CreatePack(1, 1, frame.Events.Data)
+	data.Events = append(data.Events, &frame.Event{ID: 40, Payload: frame.VectorPayload(1, 2, 3)})
+	data.Flags = frame.FlagSequenced | frame.FlagCompact
+	data.Epoch = player.Epoch
+	for _, p := range []*frame.Packet{ack, data} {
+		packet, err := frame.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pack := frame.GetPacket()
+		if complete, err := s.accept(packet, nil, addr, pack); !complete || err != nil {
+			t.Fatal("ERROR: frame is not accepted", err)
+		}
+		if len(pack.Events) != len(p.Events) || pack.Events[len(pack.Events)-1].ID != p.Events[len(p.Events)-1].ID {
+			t.Fatal("ERROR: accepted frame mismatch", pack.Events)
+		}
+		if allocs := testing.AllocsPerRun(100, func() {
+			s.accept(packet, nil, addr, pack)
+		}); allocs != 0 {
+			t.Log("ERROR: receive path allocates", allocs)
+			t.Fail()
+		}
+		frame.PutPacket(pack)
+	}
+}
@@ -2,19 +2,31 @@ package server
 
 import (
 	"bufio"
+	"encoding/binary"
+	"errors"
+	"gameserver/auth"
 	"gameserver/client"
 	"gameserver/config"
 	"gameserver/frame"
 	"gameserver/utils"
 	"log"
 	"net"
+	"time"
 )
 
+var errGameMode error = errors.New("server: player is not allowed to join the game mode")
+
 func (s *Server) StartMatcher(ip, port string) {
 	s.listen(ip, port)
 }
 
 func (s *Server) listen(ip, port string) {
+	authenticator, err := auth.New()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	s.authenticator = authenticator
 	listener, err := net.Listen("tcp", config.ServerListenAddress+":"+port)
 	if err != nil {
 		// listen error must be handle.
@@ -22,37 +34,101 @@ func (s *Server) listen(ip, port string) {
 		log.Println(err)
 		return
 	}
+	s.requestRoutine(listener)
+}
+
+// requestRoutine accepts game requests, every request is read on its own goroutine
+func (s *Server) requestRoutine(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			log.Println(err)
 			return
 		}
-		s.matchingRoutine(conn)
+		if !s.allowRequest(conn) {
+			conn.Close()
+			continue
+		}
+		// authenticators may take a while, a slow request must not hold up the others
+		go s.matchingRoutine(conn)
 	}
 }
 
 func (s *Server) matchingRoutine(conn net.Conn) {
+	// the whole game request must arrive in time, the connection is only written afterwards
+	conn.SetReadDeadline(time.Now().Add(time.Duration(config.MatchTimeoutMillisecond) * time.Millisecond))
 	reader := bufio.NewReader(conn)
-	msg, err := utils.ReadNBytes(reader, utils.HashLength)
+	credentials, err := auth.ReadCredentials(reader)
 	if err != nil {
 		log.Println(err)
+		conn.Close()
 		return
 	}
 	log.Println("[req] game request arrived from: " + conn.RemoteAddr().String())
-	valid := utils.ValidateHash(msg)
-	if !valid {
-		log.Println("[auth] auth failed. remote: " + conn.RemoteAddr().String())
+	identity, err := s.authenticator.Authenticate(credentials)
+	if err == nil && !identity.Allows(config.GameMode) {
+		err = errGameMode
+	}
+	if err != nil {
+		log.Printf("[auth] auth failed. remote: %v, reason: %v\n", conn.RemoteAddr(), err)
 		conn.Close()
 		return
 	}
-	log.Println("[auth] auth success!. remote: " + conn.RemoteAddr().String())
-	c := client.NewClient(s.currentClientID, conn)
+	log.Printf("[auth] auth success!. remote: %v, player: %v\n", conn.RemoteAddr(), identity.PlayerID)
+	c := client.NewClient(s.nextClientID(), conn)
+	c.PlayerID = identity.PlayerID
+	if config.EncryptFrames {
+		// key exchange public key follows the auth hash
+		c.PublicKey, err = utils.ReadNBytes(reader, frame.PublicKeySize)
+		if err != nil {
+			log.Println(err)
+			conn.Close()
+			return
+		}
+	}
+	if config.CompressFrames {
+		c.Compression, err = negotiateCompression(reader)
+		if err != nil {
+			log.Println(err)
+			conn.Close()
+			return
+		}
+	}
+	if config.CompactFrames {
+		compact, err := reader.ReadByte()
+		if err != nil {
+			log.Println(err)
+			conn.Close()
+			return
+		}
+		c.Compact = compact == 1
+	}
+	conn.SetReadDeadline(time.Time{})
+	s.enqueue(c)
+}
+
+// enqueue adds the client to the game queue,
+// a game is created once the queue has enough participant
+func (s *Server) enqueue(c *client.Client) {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
 	s.gameQueue = append(s.gameQueue, c)
-	s.currentClientID++
 	s.checkQueue()
 }
 
+// nextClientID hands out a client ID.
+// IDs reserved by the frame version header are skipped
+func (s *Server) nextClientID() uint16 {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	for frame.IsReservedClientID(s.currentClientID) {
+		s.currentClientID++
+	}
+	clientID := s.currentClientID
+	s.currentClientID++
+	return clientID
+}
+
 // Check queue if there are enough participant to fill a game
 func (s *Server) checkQueue() {
 	group := make([]*client.Client, 0, config.GameSize)
@@ -72,10 +148,35 @@ func (s *Server) checkQueue() {
 
 // create the game and attach it to gameList
 func (s *Server) createGame(players []*client.Client) {
-	// send all clients its own client and game ID
-	for _, p := range players {
+	// send all clients its own client and game ID,
+	// followed by the session ticket when tickets are used,
+	// the server public key when frames are encrypted,
+	// the negotiated compressor when frames are compressed
+	// and the session epoch when frames are compact
+	ciphers := make([]*frame.Cipher, len(players))
+	tickets := make([][]byte, len(players))
+	epoch := time.Now()
+	for i, p := range players {
 		pack := frame.PackGameIDAndClientID(s.currentGameID, p.ClientID)
-		_, err := p.TCPconn.Write(pack)
+		var err error
+		if config.SessionTickets {
+			tickets[i], err = frame.NewSessionTicket()
+			pack = append(pack, tickets[i]...)
+		}
+		if err == nil && len(p.PublicKey) != 0 {
+			var public []byte
+			ciphers[i], public, err = sessionCipher(p, s.currentGameID)
+			pack = append(pack, public...)
+		}
+		if config.CompressFrames {
+			pack = append(pack, p.Compression)
+		}
+		if config.CompactFrames {
+			pack = append(pack, compactAnswer(p, epoch)...)
+		}
+		if err == nil {
+			_, err = p.TCPconn.Write(pack)
+		}
 		if err != nil {
 			// if something went wrong change all states to 'InQueue' again
 			abortGameCreation(players)
@@ -88,8 +189,14 @@ func (s *Server) createGame(players []*client.Client) {
 			return
 		}
 	}
+	for i, p := range players {
+		if tickets[i] != nil {
+			s.issueTicket(p.ClientID, s.currentGameID, tickets[i])
+		}
+	}
 	s.gameLobby[s.currentGameID] = players
-	for _, p := range players {
+	for i, p := range players {
+		s.openSession(p, s.currentGameID, ciphers[i])
 		p.TCPconn.Close()
 		p.ChangeState(client.ClientState.InGame)
 	}
@@ -97,6 +204,51 @@ func (s *Server) createGame(players []*client.Client) {
 	s.clearGameQueue()
 }
 
+// negotiateCompression reads the compressors offered by a client
+// and picks the first one that server also has
+func negotiateCompression(reader *bufio.Reader) (uint8, error) {
+	n, err := reader.ReadByte()
+	if err != nil {
+		return frame.CompressionNone, err
+	}
+	offered, err := utils.ReadNBytes(reader, int(n))
+	if err != nil {
+		return frame.CompressionNone, err
+	}
+	return frame.NegotiateCompression(offered), nil
+}
+
+// compactAnswer accepts compact frames when client asked for them.
+// session epoch follows the accept byte
+func compactAnswer(p *client.Client, epoch time.Time) []byte {
+	if !p.Compact {
+		return []byte{0}
+	}
+	p.Epoch = epoch
+	answer := make([]byte, 1+frame.PackSizeOf.TimeStamp)
+	answer[0] = 1
+	binary.LittleEndian.PutUint64(answer[1:], uint64(epoch.UnixNano()))
+	return answer
+}
+
+// sessionCipher completes the key exchange of a client.
+// returns the session cipher and the public key that client needs for the same key
+func sessionCipher(p *client.Client, gameID uint16) (*frame.Cipher, []byte, error) {
+	keyPair, err := frame.NewKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := keyPair.SessionKey(p.PublicKey, gameID, p.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	cipher, err := frame.NewCipher(key, gameID, p.ClientID, frame.ServerToClient)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cipher, keyPair.Public, nil
+}
+
 func (s *Server) clearGameQueue() {
 	newGameQueue := make([]*client.Client, 0, len(s.gameQueue))
 	for _, c := range s.gameQueue {
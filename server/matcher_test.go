@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"gameserver/auth"
+	"gameserver/config"
+	"gameserver/simulator"
+	"net"
+	"testing"
+	"time"
+)
+
+// slowAuthenticator holds the requests of "slow" until release is closed
+type slowAuthenticator struct {
+	release chan struct{}
+}
+
+func (a *slowAuthenticator) Authenticate(credentials []byte) (*auth.Identity, error) {
+	if string(credentials) == "slow" {
+		<-a.release
+		return nil, errors.New("slow request")
+	}
+	return &auth.Identity{PlayerID: 1, Modes: 1 << config.GameMode}, nil
+}
+
+func TestMatcherSlowRequests(t *testing.T) {
+	s := NewServer()
+	slow := &slowAuthenticator{release: make(chan struct{})}
+	defer close(slow.release)
+	s.authenticator = slow
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go s.requestRoutine(listener)
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// one request waits for its authenticator, the other one never sends its credentials
+	waiting, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer waiting.Close()
+	waiting.Write(auth.AppendCredentials(nil, []byte("slow")))
+	silent, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	matches := make(chan *simulator.Match, config.GameSize)
+	for i := 0; i < config.GameSize; i++ {
+		go func() {
+			match, err := simulator.GameRequest(host, port)
+			if err != nil {
+				t.Error("ERROR: game request failed", err)
+			}
+			matches <- match
+		}()
+	}
+	timeout := time.After(2 * time.Second)
+	for i := 0; i < config.GameSize; i++ {
+		select {
+		case match := <-matches:
+			if match == nil || match.GameID != 1 {
+				t.Fatal("ERROR: game is not created", match)
+			}
+		case <-timeout:
+			t.Fatal("ERROR: game requests are held up by a slow one")
+		}
+	}
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if len(s.gameLobby[1]) != config.GameSize || len(s.gameQueue) != 0 {
+		t.Log("ERROR: game lobby mismatch", len(s.gameLobby[1]), len(s.gameQueue))
+		t.Fail()
+	}
+}
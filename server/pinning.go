@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"gameserver/frame"
+	"log"
+)
+
+var (
+	errSpoofedClient      error = errors.New("server: client ID does not belong to the sender address")
+	errUnregisteredClient error = errors.New("server: client is not registered")
+)
+
+// pinAddress binds a registered client to the address it registered from
+func (s *Server) pinAddress(sess *session, addr string) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	if sess.addr != "" {
+		delete(s.addresses, sess.addr)
+	}
+	sess.addr = addr
+	s.addresses[addr] = sess.player.ClientID
+}
+
+// registeredFrom reports that the client is registered and pinned to addr
+func (s *Server) registeredFrom(clientID uint16, addr string) bool {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sess := s.sessions[clientID]
+	return sess != nil && sess.addr == addr
+}
+
+// sender returns the client pinned to addr, pinned is false when addr belongs to no client.
+// packets must come from the address of the client they claim,
+// only register packets come from an address that is not pinned yet
+func (s *Server) sender(pack *frame.Packet, addr string) (clientID uint16, pinned bool, err error) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	clientID, pinned = s.addresses[addr]
+	if pinned {
+		if clientID != pack.ClientID {
+			return clientID, true, errSpoofedClient
+		}
+		return clientID, true, nil
+	}
+	if sess := s.sessions[pack.ClientID]; sess != nil && sess.addr != "" {
+		return 0, false, errSpoofedClient
+	}
+	if !pack.IsEventPack(frame.Events.Register) {
+		return 0, false, errUnregisteredClient
+	}
+	return pack.ClientID, false, nil
+}
+
+// checkSender applies the spoof policy to an inbound packet.
+// flagged packets of a pinned address are relayed as the client of the address
+func (s *Server) checkSender(pack *frame.Packet, addr string) error {
+	clientID, pinned, err := s.sender(pack, addr)
+	if err == errSpoofedClient && pinned && s.spoofPolicy == "flag" {
+		s.flagged.Inc(rejectReason(err))
+		log.Printf("[flag] %v, claimed: %v, sender: %v. remote: %v\n", err, pack.ClientID, clientID, addr)
+		pack.ClientID = clientID
+		return nil
+	}
+	return err
+}
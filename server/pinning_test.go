@@ -0,0 +1,101 @@
+package server
+
+import (
+	"gameserver/client"
+	"gameserver/frame"
+	"testing"
+)
+
+// pinnedServer has a client pinned to every address, client IDs start from 1
+func pinnedServer(addrs ...string) *Server {
+	s := NewServer()
+	for i, addr := range addrs {
+		s.pinAddress(s.openSession(client.NewClient(uint16(i+1), nil), 1, nil), addr)
+	}
+	return s
+}
+
+func TestPinningDrop(t *testing.T) {
+	s := pinnedServer("127.0.0.1:40001", "127.0.0.1:40002")
+	s.spoofPolicy = "drop"
+
+	cases := []struct {
+		name     string
+		clientID uint16
+		addr     string
+		err      error
+	}{
+		{"pinned address", 1, "127.0.0.1:40001", nil},
+		{"address of another client", 1, "127.0.0.1:40002", errSpoofedClient},
+		{"unknown address", 2, "127.0.0.1:40009", errSpoofedClient},
+	}
+	for _, c := range cases {
+		pack := frame.CreatePack(1, c.clientID, frame.Events.Data)
+		if err := s.checkSender(pack, c.addr); err != c.err || pack.ClientID != c.clientID {
+			t.Logf("ERROR: %v. expected: %v, got: %v, client ID: %v", c.name, c.err, err, pack.ClientID)
+			t.Fail()
+		}
+	}
+	if len(s.flagged.Reasons()) != 0 {
+		t.Log("ERROR: dropped packets are flagged", s.flagged.Snapshot())
+		t.Fail()
+	}
+}
+
+func TestPinningFlag(t *testing.T) {
+	s := pinnedServer("127.0.0.1:40001", "127.0.0.1:40002")
+	s.spoofPolicy = "flag"
+
+	// packets of a pinned address are relayed as the client of the address
+	pack := frame.CreatePack(1, 1, frame.Events.Data)
+	if err := s.checkSender(pack, "127.0.0.1:40002"); err != nil || pack.ClientID != 2 {
+		t.Fatal("ERROR: spoofed packet is not attributed to the sender", pack.ClientID, err)
+	}
+	if s.flagged.Get(rejectReason(errSpoofedClient)) != 1 {
+		t.Log("ERROR: spoofed packet is not counted", s.flagged.Snapshot())
+		t.Fail()
+	}
+
+	// an address that is not pinned has no client to attribute the packet to
+	pack = frame.CreatePack(1, 1, frame.Events.Data)
+	if err := s.checkSender(pack, "127.0.0.1:40009"); err != errSpoofedClient || pack.ClientID != 1 {
+		t.Log("ERROR: packet of an unknown address is not dropped", pack.ClientID, err)
+		t.Fail()
+	}
+	if s.flagged.Get(rejectReason(errSpoofedClient)) != 1 {
+		t.Log("ERROR: dropped packet is flagged", s.flagged.Snapshot())
+		t.Fail()
+	}
+}
+
+func TestPinningRegister(t *testing.T) {
+	s := NewServer()
+	sess := s.openSession(client.NewClient(3, nil), 1, nil)
+	addr := "127.0.0.1:40003"
+
+	// only register packets come from an address that is not pinned yet
+	if err := s.checkSender(frame.CreatePack(1, 3, frame.Events.Data), addr); err != errUnregisteredClient {
+		t.Log("ERROR: packet of an unregistered client is accepted", err)
+		t.Fail()
+	}
+	if err := s.checkSender(frame.CreateRegisterPack(1, 3, nil), addr); err != nil {
+		t.Fatal("ERROR: register packet is rejected", err)
+	}
+
+	s.pinAddress(sess, addr)
+	if err := s.checkSender(frame.CreatePack(1, 3, frame.Events.Data), addr); err != nil {
+		t.Log("ERROR: packet of the registered address is rejected", err)
+		t.Fail()
+	}
+	// the client is pinned, registering again from another address is spoofing
+	if err := s.checkSender(frame.CreateRegisterPack(1, 3, nil), "127.0.0.1:40009"); err != errSpoofedClient {
+		t.Log("ERROR: register from another address is accepted", err)
+		t.Fail()
+	}
+	// a new pin moves the client, its old address is forgotten
+	s.pinAddress(sess, "127.0.0.1:40004")
+	if err := s.checkSender(frame.CreatePack(1, 3, frame.Events.Data), addr); err != errSpoofedClient {
+		t.Log("ERROR: old address still speaks for the client", err)
+		t.Fail()
+	}
+}
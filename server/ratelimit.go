@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"gameserver/frame"
+	"gameserver/utils"
+	"log"
+	"net"
+	"net/netip"
+	"time"
+)
+
+var (
+	errRequestRate        error = errors.New("server: too many game requests from the address")
+	errDatagramRate       error = errors.New("server: too many datagrams from the address")
+	errClientRate         error = errors.New("server: client exceeded its event rate")
+	errGameRate           error = errors.New("server: game exceeded its event rate")
+	errDisconnectedClient error = errors.New("server: client is disconnected")
+)
+
+// allowRequest limits the game requests of an IP, refused connections are counted
+func (s *Server) allowRequest(conn net.Conn) bool {
+	if s.requestLimit.Allow(utils.GetIP(conn.RemoteAddr().String()), time.Now()) {
+		return true
+	}
+	s.refused.Inc(rejectReason(errRequestRate))
+	log.Printf("[limit] %v. remote: %v\n", errRequestRate, conn.RemoteAddr())
+	return false
+}
+
+// allowDatagram limits the datagrams of an address before they are opened and decoded.
+// refused datagrams are only counted, logging a flood would cost more than the flood
+func (s *Server) allowDatagram(addr netip.AddrPort) bool {
+	if s.datagramLimit.Allow(addr, time.Now()) {
+		return true
+	}
+	s.rejects.Inc(rejectReason(errDatagramRate))
+	return false
+}
+
+// checkRate takes a token per frame and a token per event from the buckets of the client and its game,
+// so frames without events are limited too. clients over their own limit are disconnected
+// when the policy is "disconnect", a busy game does not disconnect the client that hits its limit
+func (s *Server) checkRate(pack *frame.Packet) error {
+	if s.isDisconnected(pack.ClientID) {
+		return errDisconnectedClient
+	}
+
+	now := time.Now()
+	cost := 1 + len(pack.Events)
+	var err error
+	if !s.clientLimit.AllowN(pack.ClientID, cost, now) {
+		err = errClientRate
+	} else if !s.gameLimit.AllowN(pack.GameID, cost, now) {
+		err = errGameRate
+	}
+	if err == errClientRate && s.rateLimitPolicy == "disconnect" {
+		s.disconnect(pack.ClientID, err)
+	}
+	return err
+}
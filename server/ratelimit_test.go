@@ -0,0 +1,116 @@
+package server
+
+import (
+	"gameserver/client"
+	"gameserver/frame"
+	"gameserver/utils"
+	"net/netip"
+	"testing"
+)
+
+// framePack is a frame of client with eventCount data events
+func framePack(clientID uint16, eventCount int) *frame.Packet {
+	p := frame.CreatePack(1, clientID, frame.Events.Data)
+	p.Events = p.Events[:0]
+	for i := 0; i < eventCount; i++ {
+		p.Events = append(p.Events, &frame.Event{ID: frame.Events.Data})
+	}
+	return p
+}
+
+func TestRateLimitCost(t *testing.T) {
+	s := NewServer()
+	s.rateLimitPolicy = "drop"
+	s.clientLimit = utils.NewRateLimiter[uint16](0.001, 6)
+	s.gameLimit = utils.NewRateLimiter[uint16](0, 0)
+
+	// frames without events cost a token too
+	for i := 0; i < 6; i++ {
+		if err := s.checkRate(framePack(1, 0)); err != nil {
+			t.Fatal("ERROR: frame within the burst is limited", i, err)
+		}
+	}
+	if err := s.checkRate(framePack(1, 0)); err != errClientRate {
+		t.Log("ERROR: frames without events are not limited", err)
+		t.Fail()
+	}
+	// a frame costs a token and a token per event
+	for i, eventCount := range []int{2, 2, 0} {
+		err := s.checkRate(framePack(2, eventCount))
+		if (i < 2 && err != nil) || (i == 2 && err != errClientRate) {
+			t.Log("ERROR: events are not charged", i, err)
+			t.Fail()
+		}
+	}
+	if s.isDisconnected(1) || s.isDisconnected(2) || len(s.Disconnects()) != 0 {
+		t.Log("ERROR: client is disconnected under drop policy", s.Disconnects())
+		t.Fail()
+	}
+}
+
+func TestRateLimitDisconnect(t *testing.T) {
+	s := NewServer()
+	s.rateLimitPolicy = "disconnect"
+	s.clientLimit = utils.NewRateLimiter[uint16](0.001, 2)
+	s.gameLimit = utils.NewRateLimiter[uint16](0.001, 6)
+	players := []*client.Client{client.NewClient(1, nil), client.NewClient(2, nil)}
+	for _, p := range players {
+		s.openSession(p, 1, nil)
+	}
+	s.gameLobby[1] = players
+
+	s.checkRate(framePack(1, 1))
+	if err := s.checkRate(framePack(1, 1)); err != errClientRate {
+		t.Fatal("ERROR: client over the limit is not limited", err)
+	}
+	if s.session(1) != nil || !s.isDisconnected(1) || s.disconnects.Get(rejectReason(errClientRate)) != 1 {
+		t.Fatal("ERROR: client over the limit is not disconnected", s.Disconnects())
+	}
+	if err := s.checkRate(framePack(1, 0)); err != errDisconnectedClient {
+		t.Log("ERROR: disconnected client is not rejected", err)
+		t.Fail()
+	}
+
+	// only the noisy client leaves, a busy game disconnects nobody
+	s.clientLimit = utils.NewRateLimiter[uint16](0, 0)
+	err := s.checkRate(framePack(2, 0))
+	for i := 0; err == nil && i < 6; i++ {
+		err = s.checkRate(framePack(2, 0))
+	}
+	if err != errGameRate {
+		t.Fatal("ERROR: game over the limit is not limited", err)
+	}
+	if s.session(2) == nil || s.isDisconnected(2) || s.gameLobby[1] == nil {
+		t.Log("ERROR: client of a busy game is disconnected", s.Disconnects())
+		t.Fail()
+	}
+
+	s.closeSessions(1)
+	if s.isDisconnected(1) {
+		t.Log("ERROR: disconnected client is kept after its game")
+		t.Fail()
+	}
+}
+
+func TestDatagramLimit(t *testing.T) {
+	s := NewServer()
+	s.datagramLimit = utils.NewRateLimiter[netip.AddrPort](0.001, 3)
+	addr := netip.MustParseAddrPort("127.0.0.1:40001")
+	for i := 0; i < 3; i++ {
+		if !s.allowDatagram(addr) {
+			t.Fatal("ERROR: datagram burst is not allowed", i)
+		}
+	}
+	if s.allowDatagram(addr) {
+		t.Log("ERROR: datagram over the limit is allowed")
+		t.Fail()
+	}
+	if !s.allowDatagram(netip.MustParseAddrPort("127.0.0.1:40002")) {
+		t.Log("ERROR: addresses share a bucket")
+		t.Fail()
+	}
+	if s.rejects.Get(rejectReason(errDatagramRate)) != 1 {
+		t.Log("ERROR: refused datagram is not counted", s.Rejects())
+		t.Fail()
+	}
+}
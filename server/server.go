@@ -1,11 +1,17 @@
 package server
 
 import (
+	"gameserver/auth"
 	"gameserver/client"
 	"gameserver/config"
 	"gameserver/frame"
+	"gameserver/snapshot"
+	"gameserver/utils"
+	"log"
+	"net/netip"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -19,6 +25,56 @@ type Server struct {
 	gameState       map[uint16]bool
 	currentGameID   uint16
 	currentClientID uint16
+	// held while the game queue is changed and games are created,
+	// game requests are read concurrently
+	queueMu sync.Mutex
+
+	// inbound packets dropped by the game router, counted per reason
+	rejects *Counter
+	// inbound packets relayed in spite of a spoofed client ID, counted per reason
+	flagged     *Counter
+	spoofPolicy string
+	// game requests refused by the matcher, counted per reason
+	refused *Counter
+	// clients disconnected from their game, counted per reason
+	disconnects *Counter
+
+	// game requests per IP, datagrams per address and inbound events per client and per game
+	requestLimit    *utils.RateLimiter[string]
+	datagramLimit   *utils.RateLimiter[netip.AddrPort]
+	clientLimit     *utils.RateLimiter[uint16]
+	gameLimit       *utils.RateLimiter[uint16]
+	rateLimitPolicy string
+	// event rules that inbound packets must obey
+	events *frame.Registry
+
+	// transport state of registered clients by client ID,
+	// client IDs by the address they are pinned to,
+	// game IDs of disconnected clients by client ID
+	// and open streams by their address
+	sessions     map[uint16]*session
+	addresses    map[string]uint16
+	disconnected map[uint16]uint16
+	streams      map[string]*stream
+	sessionsMu   sync.Mutex
+
+	// fragmented inbound frames and the ID of the last outbound one
+	reassembler *frame.Reassembler
+	fragmentID  uint32
+
+	// world state of running games by game ID
+	worlds   map[uint16]*snapshot.World
+	worldsMu sync.Mutex
+
+	// records the game router traffic, nil when it is not recorded
+	capture *frame.CaptureWriter
+
+	// checks the credentials of game requests
+	authenticator auth.Authenticator
+
+	// session tickets issued by the matcher by client ID
+	tickets   map[uint16]*ticket
+	ticketsMu sync.Mutex
 }
 
 func NewServer() *Server {
@@ -28,9 +84,45 @@ func NewServer() *Server {
 		gameState:       make(map[uint16]bool),
 		currentGameID:   1,
 		currentClientID: 1,
+		rejects:         NewCounter(),
+		flagged:         NewCounter(),
+		spoofPolicy:     config.SpoofPolicy,
+		refused:         NewCounter(),
+		disconnects:     NewCounter(),
+		requestLimit:    utils.NewRateLimiter[string](config.RequestsPerSecond, config.RequestBurst),
+		datagramLimit:   utils.NewRateLimiter[netip.AddrPort](config.DatagramsPerSecond, config.DatagramBurst),
+		clientLimit:     utils.NewRateLimiter[uint16](config.ClientEventsPerSecond, config.ClientEventBurst),
+		gameLimit:       utils.NewRateLimiter[uint16](config.GameEventsPerSecond, config.GameEventBurst),
+		rateLimitPolicy: config.RateLimitPolicy,
+		events:          frame.DefaultRegistry,
+		sessions:        make(map[uint16]*session),
+		addresses:       make(map[string]uint16),
+		disconnected:    make(map[uint16]uint16),
+		streams:         make(map[string]*stream),
+		worlds:          make(map[uint16]*snapshot.World),
+		tickets:         make(map[uint16]*ticket),
+		reassembler: frame.NewReassembler(
+			time.Duration(config.FragmentTimeoutMillisecond)*time.Millisecond,
+			config.ReassemblyBufferSize,
+		),
 	}
 }
 
+// Rejects returns the number of rejected inbound packets per reason
+func (s *Server) Rejects() map[string]uint64 {
+	return s.rejects.Snapshot()
+}
+
+// Refused returns the number of game requests refused by the matcher per reason
+func (s *Server) Refused() map[string]uint64 {
+	return s.refused.Snapshot()
+}
+
+// Disconnects returns the number of clients disconnected from their game per reason
+func (s *Server) Disconnects() map[string]uint64 {
+	return s.disconnects.Snapshot()
+}
+
 func (s *Server) InterruptHandle() {
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -41,6 +133,20 @@ func (s *Server) InterruptHandle() {
 		for gameID := range s.gameLobby {
 			s.broadCastWithGameID(frame.CreateEventPacket(gameID, frame.Events.GameOver, config.NullData))
 		}
+		for _, reason := range s.rejects.Reasons() {
+			log.Printf("[stats] rejected packets. reason: %v, count: %v\n", reason, s.rejects.Get(reason))
+		}
+		for _, reason := range s.flagged.Reasons() {
+			log.Printf("[stats] flagged packets. reason: %v, count: %v\n", reason, s.flagged.Get(reason))
+		}
+		for _, reason := range s.refused.Reasons() {
+			log.Printf("[stats] refused game requests. reason: %v, count: %v\n", reason, s.refused.Get(reason))
+		}
+		for _, reason := range s.disconnects.Reasons() {
+			log.Printf("[stats] disconnected clients. reason: %v, count: %v\n", reason, s.disconnects.Get(reason))
+		}
+		reassembly := s.reassembler.Stats()
+		log.Printf("[stats] fragmented frames. completed: %v, expired: %v, dropped: %v\n", reassembly.Completed, reassembly.Expired, reassembly.Dropped)
 		time.Sleep(time.Millisecond * 500)
 		os.Exit(0)
 	}(s)
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"gameserver/client"
+	"gameserver/config"
+	"gameserver/frame"
+	"gameserver/snapshot"
+	"log"
+	"sync"
+	"time"
+)
+
+var errNoSessionKey error = errors.New("server: no session key for client")
+
+// session is the transport state of a registered client on the game router
+type session struct {
+	player *client.Client
+	gameID uint16
+	// sequence, ack and reliable delivery state of the client connection
+	conn *frame.Connection
+	// held while inbound packets of the client are routed
+	routeMu sync.Mutex
+	// seals and opens frames of the client, nil when frames are not encrypted
+	cipher *frame.Cipher
+	// world state snapshots sent to the client and its baseline
+	snapshots *snapshot.Sender
+	// coalesces frames sent to the client, nil when frames are not coalesced
+	bundler *frame.Bundler
+	// address the client registered from, empty until it registers
+	addr string
+}
+
+// openSession creates the session of a client when its game is created.
+// cipher is only used when the session does not exist yet
+func (s *Server) openSession(player *client.Client, gameID uint16, cipher *frame.Cipher) *session {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sess, exists := s.sessions[player.ClientID]
+	if !exists {
+		sess = &session{
+			player:    player,
+			gameID:    gameID,
+			conn:      frame.NewConnection(),
+			cipher:    cipher,
+			snapshots: snapshot.NewSender(config.SnapshotHistorySize),
+		}
+		if config.CoalesceFrames {
+			sess.bundler = frame.NewBundler(datagramMTU(cipher))
+		}
+		s.sessions[player.ClientID] = sess
+	}
+	return sess
+}
+
+// datagramMTU is the largest frame that is sent without fragmenting,
+// sealed frames must fit the MTU with the seal overhead
+func datagramMTU(cipher *frame.Cipher) int {
+	if cipher != nil {
+		return config.MTU - frame.SealOverhead
+	}
+	return config.MTU
+}
+
+// session returns nil for clients that are not registered yet
+func (s *Server) session(clientID uint16) *session {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	return s.sessions[clientID]
+}
+
+func (s *Server) sessionList() []*session {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// open returns the inner frame of a sealed datagram and the session that sealed it.
+// plaintext datagrams are returned as they are unless frames must be encrypted
+func (s *Server) open(datagram []byte) ([]byte, *session, error) {
+	if !frame.IsSealed(datagram) {
+		if config.EncryptFrames {
+			return nil, nil, frame.ErrNotSealed
+		}
+		return datagram, nil, nil
+	}
+	_, clientID, err := frame.SealedIDs(datagram)
+	if err != nil {
+		return nil, nil, err
+	}
+	sess := s.session(clientID)
+	if sess == nil || sess.cipher == nil {
+		return nil, nil, errNoSessionKey
+	}
+	packet, err := sess.cipher.Open(datagram)
+	if err != nil {
+		return nil, nil, err
+	}
+	return packet, sess, nil
+}
+
+// waitDelivered waits until reliable packets of the game are acked or timeout
+func (s *Server) waitDelivered(gameID uint16, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		pending := 0
+		for _, sess := range s.sessionList() {
+			if sess.gameID == gameID {
+				pending += sess.conn.Pending()
+			}
+		}
+		if pending == 0 {
+			return
+		}
+		time.Sleep(time.Duration(config.ResendTickMillisecond) * time.Millisecond)
+	}
+}
+
+// closeSessions forgets the sessions of the game and its disconnected clients
+func (s *Server) closeSessions(gameID uint16) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	for clientID, sess := range s.sessions {
+		if sess.gameID == gameID {
+			s.dropSession(clientID, sess)
+		}
+	}
+	for clientID, disconnectedFrom := range s.disconnected {
+		if disconnectedFrom == gameID {
+			delete(s.disconnected, clientID)
+		}
+	}
+}
+
+// disconnect removes the session of a client, the rest of its game goes on.
+// later packets of the client are rejected and it receives nothing until its game ends
+func (s *Server) disconnect(clientID uint16, reason error) {
+	s.sessionsMu.Lock()
+	sess, exists := s.sessions[clientID]
+	if exists {
+		s.dropSession(clientID, sess)
+		s.disconnected[clientID] = sess.gameID
+	}
+	s.sessionsMu.Unlock()
+	if !exists {
+		return
+	}
+	s.disconnects.Inc(rejectReason(reason))
+	log.Printf("[disconnect] %v. client ID: %v, game ID: %v\n", reason, clientID, sess.gameID)
+}
+
+func (s *Server) isDisconnected(clientID uint16) bool {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	_, disconnected := s.disconnected[clientID]
+	return disconnected
+}
+
+// dropSession logs delivery statistics of a session and forgets it, sessionsMu must be held
+func (s *Server) dropSession(clientID uint16, sess *session) {
+	stats := sess.conn.Stats()
+	log.Printf("[stats] GID: %v, CID: %v, sent: %v, acked: %v, lost: %v (%.1f%%), received: %v, duplicate: %v, out of order: %v, rtt: %v, retransmit: %v, failed: %v\n",
+		sess.gameID, clientID, stats.Sent, stats.Acked, stats.Lost, stats.LossRate()*100, stats.Received, stats.Duplicates+stats.DuplicateMessages, stats.OutOfOrder, stats.RTT, stats.Retransmits, stats.Failed)
+	delete(s.sessions, clientID)
+	if s.addresses[sess.addr] == clientID {
+		delete(s.addresses, sess.addr)
+	}
+	s.clientLimit.Forget(clientID)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"gameserver/client"
+	"gameserver/config"
+	"gameserver/events"
+	"gameserver/frame"
+	"gameserver/snapshot"
+	"time"
+)
+
+// openWorld creates the world state of a game when it starts
+func (s *Server) openWorld(gameID uint16) *snapshot.World {
+	s.worldsMu.Lock()
+	defer s.worldsMu.Unlock()
+	world := snapshot.NewWorld()
+	s.worlds[gameID] = world
+	return world
+}
+
+// world returns nil for games that are not running
+func (s *Server) world(gameID uint16) *snapshot.World {
+	s.worldsMu.Lock()
+	defer s.worldsMu.Unlock()
+	return s.worlds[gameID]
+}
+
+// closeWorld forgets the world state of a game, its snapshot routine stops
+func (s *Server) closeWorld(gameID uint16) {
+	s.worldsMu.Lock()
+	defer s.worldsMu.Unlock()
+	delete(s.worlds, gameID)
+}
+
+// snapshotRoutine sends the world state of a game every snapshot tick until the world is closed
+func (s *Server) snapshotRoutine(gameID uint16, world *snapshot.World) {
+	ticker := time.NewTicker(time.Duration(config.SnapshotTickMillisecond) * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if s.world(gameID) != world {
+			return
+		}
+		tick, state := world.Snapshot()
+		s.broadcastSnapshot(gameID, tick, state)
+	}
+}
+
+// broadcastSnapshot sends every player a delta against the last snapshot it acked.
+// legacy players can not receive typed events, they get no snapshots
+func (s *Server) broadcastSnapshot(gameID uint16, tick uint32, state snapshot.State) {
+	s.broadcast(gameID, func(player *client.Client) *frame.Packet {
+		sess := s.session(player.ClientID)
+		if sess == nil || player.Version == frame.Version0 {
+			return nil
+		}
+		p := frame.CreateEventPacket(gameID, frame.Events.Snapshot, config.NullData)
+		p.Events[0].Payload = frame.BytesPayload(sess.snapshots.Delta(tick, state))
+		return p
+	})
+}
+
+// ackSnapshot moves the snapshot baseline of the client to the acked tick
+func (s *Server) ackSnapshot(p *frame.Packet) {
+	sess := s.session(p.ClientID)
+	if sess == nil {
+		return
+	}
+	sess.snapshots.Ack(uint32(p.Events[0].Data))
+}
+
+// updateWorld applies game events to the world state,
+// player entities are moved by their move events
+func (s *Server) updateWorld(p *frame.Packet) {
+	world := s.world(p.GameID)
+	if world == nil {
+		return
+	}
+	move := &events.Move{}
+	if move.Decode(p) == nil {
+		world.Set(p.ClientID, move.Position)
+	}
+}
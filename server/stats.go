@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Counter counts occurrences per reason.
+// it is safe for concurrent use, router goroutines share the same counter
+type Counter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func NewCounter() *Counter {
+	return &Counter{
+		counts: make(map[string]uint64),
+	}
+}
+
+func (c *Counter) Inc(reason string) {
+	c.mu.Lock()
+	c.counts[reason]++
+	c.mu.Unlock()
+}
+
+func (c *Counter) Get(reason string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[reason]
+}
+
+// Snapshot returns a copy of all counts
+func (c *Counter) Snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := make(map[string]uint64, len(c.counts))
+	for reason, n := range c.counts {
+		snapshot[reason] = n
+	}
+	return snapshot
+}
+
+// rejectReason converts an error into a counter reason.
+// wrapped errors are counted under the error they wrap
+func rejectReason(err error) string {
+	if wrapped := errors.Unwrap(err); wrapped != nil {
+		return wrapped.Error()
+	}
+	return err.Error()
+}
+
+// Reasons returns the counted reasons in sorted order
+func (c *Counter) Reasons() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reasons := make([]string, 0, len(c.counts))
+	for reason := range c.counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
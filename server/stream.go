@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"gameserver/client"
+	"gameserver/frame"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	// longest wait for a stream client to take a frame
+	streamWriteTimeout time.Duration = time.Second
+)
+
+// stream is a connection of a client that can not use UDP
+type stream struct {
+	addr   string
+	conn   net.Conn
+	writer *frame.StreamWriter
+}
+
+// StreamRouter accepts game router connections over TCP for clients behind networks that block UDP.
+// streams carry the same frames as datagrams with a length prefix, see frame.StreamWriter.
+// their frames are routed by the game router, a client registered over a stream
+// receives its frames on the stream
+func (s *Server) StreamRouter(ip, port string) {
+	listener, err := net.Listen("tcp", ip+":"+port)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer listener.Close()
+	s.streamRoutine(listener)
+}
+
+func (s *Server) streamRoutine(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println(err)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go s.readStream(conn)
+	}
+}
+
+// readStream receives the frames of a stream as datagrams until the stream ends.
+// stream addresses are prefixed, so they never collide with the UDP ones
+func (s *Server) readStream(conn net.Conn) {
+	defer conn.Close()
+	remote, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	remote = netip.AddrPortFrom(remote.Addr().Unmap(), remote.Port())
+	addr := "tcp://" + remote.String()
+	s.openStream(&stream{addr: addr, conn: conn, writer: frame.NewStreamWriter(conn)})
+	defer s.closeStream(addr)
+
+	reader := frame.NewStreamReader(conn)
+	for {
+		packet, err := reader.ReadFrame()
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				s.reject(err, addr)
+			}
+			return
+		}
+		if !s.allowDatagram(remote) {
+			continue
+		}
+		// frame is valid until the next read, decoded packets never refer to it
+		s.receiveDatagram(packet, addr)
+	}
+}
+
+func (s *Server) openStream(st *stream) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	s.streams[st.addr] = st
+}
+
+func (s *Server) closeStream(addr string) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	delete(s.streams, addr)
+}
+
+// stream returns the stream of the address the client is pinned to,
+// nil when the client speaks UDP
+func (s *Server) stream(clientID uint16) *stream {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sess := s.sessions[clientID]
+	if sess == nil || sess.addr == "" {
+		return nil
+	}
+	return s.streams[sess.addr]
+}
+
+// writeStream seals packet when cipher is not nil and writes it to the stream of player.
+// streams are ordered and take frames whole, frames are never fragmented or coalesced.
+// a stream that does not take a frame in time is closed
+func (s *Server) writeStream(player *client.Client, cipher *frame.Cipher, st *stream, packet []byte) {
+	s.recordOutbound(packet, player.ClientID, st.addr)
+	if cipher != nil {
+		packet = cipher.Seal(packet)
+	}
+	st.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	err := st.writer.WriteFrame(packet)
+	if err != nil {
+		log.Printf("%v. client ID: %v\n", err, player.ClientID)
+		st.conn.Close()
+	}
+}
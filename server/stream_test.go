@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/rand"
+	"gameserver/client"
+	"gameserver/frame"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamRouter(t *testing.T) {
+	s := NewServer()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go s.streamRoutine(listener)
+
+	// the other player speaks UDP and is already registered
+	var gameID uint16 = 1
+	players := []*client.Client{client.NewClient(1, nil), client.NewClient(2, nil)}
+	registerPlayer(players[1], "127.0.0.1:40002", frame.CurrentVersion)
+	s.gameLobby[gameID] = players
+	key := make([]byte, 32)
+	rand.Read(key)
+	serverCipher, _ := frame.NewCipher(key, gameID, 1, frame.ServerToClient)
+	clientCipher, _ := frame.NewCipher(key, gameID, 1, frame.ClientToServer)
+	s.openSession(players[0], gameID, serverCipher)
+	ticket, _ := frame.NewSessionTicket()
+	s.issueTicket(1, gameID, ticket)
+	defer s.closeWorld(gameID)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	register := frame.CreateRegisterPack(gameID, 1, ticket)
+	frame.NewConnection().Send(register)
+	packet, err := frame.Encode(register)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := frame.NewStreamWriter(conn).WriteFrame(clientCipher.Seal(packet)); err != nil {
+		t.Fatal("ERROR: stream write failed", err)
+	}
+
+	// registering over the stream starts the game, the start event comes back on the stream
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reader := frame.NewStreamReader(conn)
+	sealed, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatal("ERROR: nothing is received on the stream", err)
+	}
+	packet, err = clientCipher.Open(sealed)
+	if err != nil {
+		t.Fatal("ERROR: stream frame is not sealed for the client", err)
+	}
+	start, err := frame.Decode(packet)
+	if err != nil || !start.IsEventPack(frame.Events.Start) {
+		t.Fatal("ERROR: start event is not received", start, err)
+	}
+	if !players[0].IsRegistered() || s.stream(1) == nil {
+		t.Log("ERROR: client is not registered on its stream")
+		t.Fail()
+	}
+
+	// the client is pinned to its stream, a datagram can not speak for it
+	packet, _ = frame.Encode(register)
+	s.receiveDatagram(clientCipher.Seal(packet), "127.0.0.1:40001")
+	if s.rejects.Get(rejectReason(errSpoofedClient)) != 1 {
+		t.Log("ERROR: datagram speaks for a stream client", s.Rejects())
+		t.Fail()
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.stream(1) != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.stream(1) != nil {
+		t.Log("ERROR: closed stream is kept")
+		t.Fail()
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+var (
+	errMissingTicket error = errors.New("server: register without session ticket")
+	errWrongTicket   error = errors.New("server: wrong session ticket")
+	errReusedTicket  error = errors.New("server: session ticket is already used")
+)
+
+// ticket is the session ticket that matcher issued to a client,
+// it registers the client once
+type ticket struct {
+	gameID uint16
+	value  []byte
+	used   bool
+}
+
+func (s *Server) issueTicket(clientID, gameID uint16, value []byte) {
+	s.ticketsMu.Lock()
+	defer s.ticketsMu.Unlock()
+	s.tickets[clientID] = &ticket{gameID: gameID, value: value}
+}
+
+// redeemTicket checks the ticket presented by a register packet and marks it used
+func (s *Server) redeemTicket(clientID, gameID uint16, presented []byte) error {
+	if presented == nil {
+		return errMissingTicket
+	}
+	s.ticketsMu.Lock()
+	defer s.ticketsMu.Unlock()
+	t, exists := s.tickets[clientID]
+	if !exists || t.gameID != gameID || subtle.ConstantTimeCompare(t.value, presented) != 1 {
+		return errWrongTicket
+	}
+	if t.used {
+		return errReusedTicket
+	}
+	t.used = true
+	return nil
+}
+
+func (s *Server) closeTickets(gameID uint16) {
+	s.ticketsMu.Lock()
+	defer s.ticketsMu.Unlock()
+	for clientID, t := range s.tickets {
+		if t.gameID == gameID {
+			delete(s.tickets, clientID)
+		}
+	}
+}
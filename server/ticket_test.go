@@ -0,0 +1,75 @@
+package server
+
+import (
+	"gameserver/client"
+	"gameserver/config"
+	"gameserver/frame"
+	"testing"
+	"time"
+)
+
+func TestRegisterLostAck(t *testing.T) {
+	s := NewServer()
+	var gameID uint16 = 1
+	// the second player does not register, so the game does not start
+	players := []*client.Client{client.NewClient(1, nil), client.NewClient(2, nil)}
+	s.gameLobby[gameID] = players
+	ticket, _ := frame.NewSessionTicket()
+	s.issueTicket(1, gameID, ticket)
+	addr := "127.0.0.1:40001"
+	// routed in place of the router goroutine of receive
+	route := func(packet []byte, addr string) {
+		pack := frame.GetPacket()
+		if _, err := s.accept(packet, nil, addr, pack); err != nil {
+			s.reject(err, addr)
+			return
+		}
+		s.eventRouter(pack, addr)
+	}
+
+	conn := frame.NewConnection()
+	register := frame.CreateRegisterPack(gameID, 1, ticket)
+	register.Delivery = frame.ReliableOrdered
+	conn.Send(register)
+	packet, err := frame.Encode(register)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route(packet, addr)
+	sess := s.session(1)
+	if sess == nil || !players[0].IsRegistered() || !sess.conn.AckDue() {
+		t.Fatal("ERROR: register is not accepted")
+	}
+	// the ack of the server is lost
+	sess.conn.Send(frame.CreateEventPacket(gameID, frame.Events.Ack, config.NullData))
+
+	resend, err := conn.Resend(time.Now().Add(time.Minute))
+	if err != nil || len(resend) != 1 {
+		t.Fatal("ERROR: register is not retransmitted", err)
+	}
+	packet, _ = frame.Encode(resend[0])
+	route(packet, addr)
+	if s.rejects.Get(rejectReason(errReusedTicket)) != 0 || !sess.conn.AckDue() {
+		t.Fatal("ERROR: retransmitted register is not acked", s.Rejects())
+	}
+	ack := frame.CreateEventPacket(gameID, frame.Events.Ack, config.NullData)
+	sess.conn.Send(ack)
+	packet, _ = frame.Encode(ack)
+	decoded, err := frame.Decode(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Receive(decoded)
+	if conn.Pending() != 0 {
+		t.Log("ERROR: register is still pending after the ack", conn.Pending())
+		t.Fail()
+	}
+
+	// the ticket still registers once from another address
+	packet, _ = frame.Encode(register)
+	route(packet, "127.0.0.1:40009")
+	if s.rejects.Get(rejectReason(errReusedTicket))+s.rejects.Get(rejectReason(errSpoofedClient)) != 1 {
+		t.Log("ERROR: ticket is reused from another address", s.Rejects())
+		t.Fail()
+	}
+}
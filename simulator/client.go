@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
+	"gameserver/auth"
 	"gameserver/config"
+	"gameserver/events"
 	"gameserver/frame"
+	"gameserver/snapshot"
 	"gameserver/utils"
 	"log"
 	"math/rand"
@@ -13,6 +16,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -20,21 +24,70 @@ import (
 type SimulatedClient struct {
 	ClientID uint16
 	GameID   uint16
-	ReadChan chan []byte
+	// datagrams read from the server in pooled buffers
+	ReadChan chan *[]byte
 	GameOver *bool
+	// sequence, ack and reliable delivery state of the server connection
+	Conn *frame.Connection
+	// packets delivered by the connection and not read yet
+	delivered []*frame.Packet
+	// fragmented frames of the server and the ID of the last own one,
+	// frames are written by the game loop and the resend routine at the same time
+	reassembler *frame.Reassembler
+	fragmentID  uint32
+	// seals and opens frames, nil when frames are not encrypted
+	cipher *frame.Cipher
+	// coalesces frames sent to the server, nil when frames are not coalesced
+	bundler *frame.Bundler
+	// compressor negotiated with the matcher
+	compression uint8
+	// session epoch of compact frames, zero when they are not used
+	epoch time.Time
+	// world state snapshots of the server and the tick to ack, zero when there is none
+	snapshots   *snapshot.Receiver
+	snapshotAck uint32
+	// frames are sent and received on the same socket,
+	// server pins the client to the address it registers from
+	udpConn *net.UDPConn
+}
+
+// Match is the answer of the matcher to a game request
+type Match struct {
+	GameID   uint16
+	ClientID uint16
+	// nil when frames are not encrypted
+	Cipher      *frame.Cipher
+	Compression uint8
+	// zero when compact frames are not used
+	Epoch time.Time
+	// presented by the register event, nil when tickets are not used
+	Ticket []byte
 }
 
 func ClientSimulation(ip, TCPport, UDPport string) error {
-	gameID, clientID, err := GameRequest(ip, TCPport)
+	match, err := GameRequest(ip, TCPport)
 	if err != nil {
 		return err
 	}
+	clientID := match.ClientID
 	gameover := false
 	s := &SimulatedClient{
-		GameID:   gameID,
-		ClientID: clientID,
-		ReadChan: make(chan []byte, 2048),
-		GameOver: &gameover,
+		GameID:      match.GameID,
+		ClientID:    clientID,
+		ReadChan:    make(chan *[]byte, 2048),
+		GameOver:    &gameover,
+		Conn:        frame.NewConnection(),
+		cipher:      match.Cipher,
+		compression: match.Compression,
+		epoch:       match.Epoch,
+		snapshots:   snapshot.NewReceiver(config.SnapshotHistorySize),
+		reassembler: frame.NewReassembler(
+			time.Duration(config.FragmentTimeoutMillisecond)*time.Millisecond,
+			config.ReassemblyBufferSize,
+		),
+	}
+	if config.CoalesceFrames {
+		s.bundler = frame.NewBundler(s.mtu())
 	}
 
 	port, _ := strconv.Atoi(UDPport)
@@ -42,9 +95,15 @@ func ClientSimulation(ip, TCPport, UDPport string) error {
 		port += int(clientID)
 	}
 
-	go s.ListenUDP(ip, port, clientID)
+	err = s.ListenUDP(port)
+	if err != nil {
+		return err
+	}
+	go s.readRoutine()
+	go s.resendRoutine(ip, UDPport)
+	go s.coalesceRoutine(ip, UDPport)
 
-	registerPack := frame.CreatePack(s.GameID, s.ClientID, frame.Events.Register)
+	registerPack := frame.CreateRegisterPack(s.GameID, s.ClientID, match.Ticket)
 
 	err = s.WriteEvent(ip, UDPport, registerPack)
 	if err != nil {
@@ -70,34 +129,108 @@ func ClientSimulation(ip, TCPport, UDPport string) error {
 
 	log.Println("# Game over")
 
+	// game over must be acked
+	s.flush(ip, UDPport, time.Now())
+
+	stats := s.Conn.Stats()
+	log.Printf("# [stats] sent: %v, acked: %v, lost: %v (%.1f%%), received: %v, duplicate: %v, out of order: %v, rtt: %v, retransmit: %v, failed: %v\n",
+		stats.Sent, stats.Acked, stats.Lost, stats.LossRate()*100, stats.Received, stats.Duplicates+stats.DuplicateMessages, stats.OutOfOrder, stats.RTT, stats.Retransmits, stats.Failed)
+
 	return nil
 }
 
-func GameRequest(ip, port string) (uint16, uint16, error) {
+// GameRequest waits in the matcher queue for game and client IDs.
+// session key, frame compression and compact frames are negotiated in the same request
+func GameRequest(ip, port string) (*Match, error) {
 	conn, err := net.Dial("tcp", ip+":"+port)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
+	}
+	request, err := initMessage()
+	if err != nil {
+		return nil, err
+	}
+	var keyPair *frame.KeyPair
+	if config.EncryptFrames {
+		keyPair, err = frame.NewKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		request = append(request, keyPair.Public...)
+	}
+	if config.CompressFrames {
+		offered := frame.Compressors()
+		request = append(request, uint8(len(offered)))
+		request = append(request, offered...)
+	}
+	if config.CompactFrames {
+		request = append(request, 1)
 	}
-	_, err = conn.Write(initMessage())
+	_, err = conn.Write(request)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 	log.Println("# Game request registered. You are in the queue...")
 	buffer := bufio.NewReader(conn)
 	msg, err := utils.ReadNBytes(buffer, frame.PackSizeOf.GameID+frame.PackSizeOf.ClientID)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
+	}
+	match := &Match{
+		GameID:      binary.LittleEndian.Uint16(msg[:frame.PackSizeOf.GameID]),
+		ClientID:    binary.LittleEndian.Uint16(msg[frame.PackSizeOf.GameID : frame.PackSizeOf.GameID+frame.PackSizeOf.ClientID]),
+		Compression: frame.CompressionNone,
+	}
+	log.Printf("# [pool] gameID: %v, clientID: %v\n", match.GameID, match.ClientID)
+
+	if config.SessionTickets {
+		match.Ticket, err = utils.ReadNBytes(buffer, frame.SessionTicketSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if keyPair != nil {
+		serverPublic, err := utils.ReadNBytes(buffer, frame.PublicKeySize)
+		if err != nil {
+			return nil, err
+		}
+		key, err := keyPair.SessionKey(serverPublic, match.GameID, match.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		match.Cipher, err = frame.NewCipher(key, match.GameID, match.ClientID, frame.ClientToServer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.CompressFrames {
+		match.Compression, err = buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("# [pool] compression: %v\n", match.Compression)
+	}
+	if config.CompactFrames {
+		accepted, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if accepted == 1 {
+			epoch, err := utils.ReadNBytes(buffer, frame.PackSizeOf.TimeStamp)
+			if err != nil {
+				return nil, err
+			}
+			match.Epoch = time.Unix(0, int64(binary.LittleEndian.Uint64(epoch)))
+			log.Printf("# [pool] compact frames, epoch: %v\n", match.Epoch)
+		}
 	}
-	gameID := binary.LittleEndian.Uint16(msg[:frame.PackSizeOf.GameID])
-	clientID := binary.LittleEndian.Uint16(msg[frame.PackSizeOf.GameID : frame.PackSizeOf.GameID+frame.PackSizeOf.ClientID])
-	log.Printf("# [pool] gameID: %v, clientID: %v\n", gameID, clientID)
-	return gameID, clientID, err
+	return match, nil
 }
 
 func (s *SimulatedClient) WriteEvent(ip, UDPport string, p *frame.Packet) error {
-	pack := frame.Marshal(p)
 	log.Printf("> [sending] GID: %v, CID: %v, Event: %v\n", s.GameID, s.ClientID, resolveEvent(p))
-	err := s.WriteUDP(ip, UDPport, pack)
+	err := s.send(ip, UDPport, p)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -105,19 +238,238 @@ func (s *SimulatedClient) WriteEvent(ip, UDPport string, p *frame.Packet) error
 	return nil
 }
 
+// send passes versioned packets through the connection,
+// control events are sent reliably according to the event registry
+func (s *SimulatedClient) send(ip, UDPport string, p *frame.Packet) error {
+	if p.Version != frame.Version0 {
+		p.Compression = s.compression
+		if !s.epoch.IsZero() {
+			p.Flags |= frame.FlagCompact
+			p.Epoch = s.epoch
+		}
+		if config.FrameChecksum && s.cipher == nil {
+			p.Flags |= frame.FlagChecksum
+		}
+		p.Delivery = frame.DefaultRegistry.Delivery(p)
+		s.Conn.Send(p)
+	}
+	return s.writeFrame(ip, UDPport, p)
+}
+
+// writeFrame encodes packet and sends it, fragmented when it does not fit the MTU
+func (s *SimulatedClient) writeFrame(ip, UDPport string, p *frame.Packet) error {
+	buff := frame.GetBuffer()
+	defer frame.PutBuffer(buff)
+	packet, err := frame.AppendMarshal((*buff)[:0], p)
+	if err != nil {
+		return err
+	}
+	datagrams := [][]byte{packet}
+	if p.Version != frame.Version0 {
+		fragmentID := uint16(atomic.AddUint32(&s.fragmentID, 1))
+		datagrams, err = frame.Split(packet, s.ClientID, s.GameID, fragmentID, s.mtu())
+		if err != nil {
+			return err
+		}
+		if s.bundler != nil {
+			var ready [][]byte
+			for _, datagram := range datagrams {
+				ready = append(ready, s.bundler.Add(datagram)...)
+			}
+			datagrams = ready
+		}
+	}
+	return s.writeDatagrams(ip, UDPport, datagrams)
+}
+
+// mtu is the largest frame that is sent without fragmenting
+func (s *SimulatedClient) mtu() int {
+	if s.cipher != nil {
+		return config.MTU - frame.SealOverhead
+	}
+	return config.MTU
+}
+
+// writeDatagrams seals datagrams when frames are encrypted and sends them
+func (s *SimulatedClient) writeDatagrams(ip, UDPport string, datagrams [][]byte) error {
+	for _, datagram := range datagrams {
+		if s.cipher != nil {
+			datagram = s.cipher.Seal(datagram)
+		}
+		err := s.WriteUDP(ip, UDPport, datagram)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coalesceRoutine sends the coalesced frames once per coalesce tick
+func (s *SimulatedClient) coalesceRoutine(ip, UDPport string) {
+	ticker := time.NewTicker(time.Duration(config.CoalesceTickMillisecond) * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.flushBundle(ip, UDPport)
+	}
+}
+
+func (s *SimulatedClient) flushBundle(ip, UDPport string) {
+	if s.bundler == nil {
+		return
+	}
+	if datagram := s.bundler.Flush(); datagram != nil {
+		err := s.writeDatagrams(ip, UDPport, [][]byte{datagram})
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// resendRoutine retransmits unacked reliable packets and sends pending acks
+func (s *SimulatedClient) resendRoutine(ip, UDPport string) {
+	ticker := time.NewTicker(time.Duration(config.ResendTickMillisecond) * time.Millisecond)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.flush(ip, UDPport, now)
+	}
+}
+
+func (s *SimulatedClient) flush(ip, UDPport string, now time.Time) {
+	resend, err := s.Conn.Resend(now)
+	if err != nil {
+		// the server is lost, the game can not go on
+		if !*s.GameOver {
+			log.Println("# Server is lost.", err)
+			*s.GameOver = true
+		}
+		return
+	}
+	for _, p := range resend {
+		err := s.writeFrame(ip, UDPport, p)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	if s.Conn.AckDue() {
+		err := s.send(ip, UDPport, frame.CreatePack(s.GameID, s.ClientID, frame.Events.Ack))
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	if tick := atomic.SwapUint32(&s.snapshotAck, 0); tick != 0 {
+		ack := frame.CreatePack(s.GameID, s.ClientID, frame.Events.SnapshotAck)
+		ack.Events[0].Data = int32(tick)
+		err := s.send(ip, UDPport, ack)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	// flush is also the last send at game over, nothing may stay coalesced
+	s.flushBundle(ip, UDPport)
+}
+
+// applySnapshot reconstructs the world state of a snapshot, its tick is acked on the next flush
+func (s *SimulatedClient) applySnapshot(pack *frame.Packet) {
+	// a snapshot carries a bytes payload, a legacy event with the snapshot ID has none
+	err := frame.DefaultRegistry.Check(pack.Events[0], frame.ServerToClient)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	data, err := pack.Events[0].Payload.Bytes()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	tick, state, err := s.snapshots.Apply(data)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Printf("< [snapshot] tick: %v, entities: %v, size: %v\n", tick, len(state), len(data))
+	atomic.StoreUint32(&s.snapshotAck, tick)
+}
+
+// nextPacket returns the next packet delivered by the connection.
+// duplicates are dropped, ack and snapshot packets are consumed
+func (s *SimulatedClient) nextPacket() *frame.Packet {
+	for {
+		if len(s.delivered) > 0 {
+			pack := s.delivered[0]
+			s.delivered = s.delivered[1:]
+			if pack.IsEventPack(frame.Events.Ack) {
+				continue
+			}
+			if pack.IsEventPack(frame.Events.Snapshot) {
+				s.applySnapshot(pack)
+				continue
+			}
+			return pack
+		}
+		buff := <-s.ReadChan
+		s.receiveDatagram(*buff)
+		// decoded packets never refer to the read buffer
+		frame.PutBuffer(buff)
+	}
+}
+
+// receiveDatagram opens a datagram of the server and receives its frames
+func (s *SimulatedClient) receiveDatagram(buffer []byte) {
+	if s.cipher != nil {
+		var err error
+		buffer, err = s.cipher.Open(buffer)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	frames := [][]byte{buffer}
+	if frame.IsBundle(buffer) {
+		var err error
+		frames, err = frame.Unbundle(buffer)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	for _, f := range frames {
+		s.receive(f)
+	}
+}
+
+// receive decodes a single frame of a datagram and queues the packets it delivers
+func (s *SimulatedClient) receive(packet []byte) {
+	// server is the only source
+	pack, err := s.reassembler.Decode(config.ClientRequestAddress, packet)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if pack == nil {
+		return
+	}
+	pack.Rebase(s.epoch)
+	delivered, err := s.Conn.Receive(pack)
+	if err != nil {
+		return
+	}
+	s.delivered = append(s.delivered, delivered...)
+}
+
 func (s *SimulatedClient) WriteUDP(ip, port string, packet []byte) error {
-	conn, err := net.Dial("udp", ip+":"+port)
+	addr, err := net.ResolveUDPAddr("udp", ip+":"+port)
 	if err != nil {
 		return err
 	}
-	_, err = conn.Write(packet)
+	_, err = s.udpConn.WriteToUDP(packet, addr)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *SimulatedClient) ListenUDP(ip string, port int, clientID uint16) error {
+// ListenUDP opens the UDP socket that frames are sent from and received on
+func (s *SimulatedClient) ListenUDP(port int) error {
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{
 		Port: port,
 		IP:   net.ParseIP(config.ServerListenAddress),
@@ -125,21 +477,27 @@ func (s *SimulatedClient) ListenUDP(ip string, port int, clientID uint16) error
 	if err != nil {
 		return err
 	}
+	s.udpConn = conn
+	return nil
+}
+
+func (s *SimulatedClient) readRoutine() {
 	for {
-		buffer := make([]byte, 2048)
-		n, err := conn.Read(buffer)
+		buff := frame.GetBuffer()
+		n, err := s.udpConn.Read(*buff)
 		if err != nil {
+			frame.PutBuffer(buff)
 			fmt.Println(err)
 			continue
 		}
-		s.ReadChan <- buffer[:n]
+		*buff = (*buff)[:n]
+		s.ReadChan <- buff
 	}
 }
 
 func (s *SimulatedClient) CheckGameOver() {
 	for {
-		buffer := <-s.ReadChan
-		pack := frame.Unmarshal(buffer)
+		pack := s.nextPacket()
 		log.Printf("< [receiving] GID: %v, CID: %v, Event: %v\n", s.GameID, s.ClientID, resolveEvent(pack))
 		if pack.IsEventPack(frame.Events.GameOver) {
 			break
@@ -149,30 +507,51 @@ func (s *SimulatedClient) CheckGameOver() {
 }
 
 func (s *SimulatedClient) dummyEvent() *frame.Packet {
-	noe := rand.Intn(4)
-	events := make([]*frame.Event, noe)
-	for i := range events {
-		events[i] = &frame.Event{
-			ID:   uint8(rand.Intn(256)),
-			Data: int32(rand.Int31()),
-		}
-	}
-	return &frame.Packet{
+	p := &frame.Packet{
+		Version:   frame.CurrentVersion,
 		ClientID:  s.ClientID,
 		GameID:    s.GameID,
-		Events:    events,
 		TimeStamp: time.Now(),
 	}
+	noe := rand.Intn(4)
+	for i := 0; i < noe; i++ {
+		switch rand.Intn(3) {
+		case 0:
+			move := &events.Move{Position: []float32{rand.Float32() * 100, rand.Float32() * 100, 0}}
+			move.Encode(p)
+		case 1:
+			hit := &events.Hit{Target: rand.Int31n(int32(config.GameSize)) + 1, Damage: rand.Float32() * 10, Critical: rand.Intn(10) == 0}
+			hit.Encode(p)
+		default:
+			chat := &events.Chat{Message: "gg"}
+			chat.Encode(p)
+		}
+	}
+	return p
 }
 
-func initMessage() []byte {
-	return utils.CreateHash()
+// initMessage is the length prefixed credentials of the game request, ClientCredentials
+// or the auth token of a random player. simulated clients share the token keys of the server,
+// real clients get their tokens from an issuer
+func initMessage() ([]byte, error) {
+	if config.ClientCredentials != "" {
+		return auth.AppendCredentials(nil, []byte(config.ClientCredentials)), nil
+	}
+	tokens, err := utils.ConfigKeyring()
+	if err != nil {
+		return nil, err
+	}
+	lifetime := time.Duration(config.TokenLifetimeSecond) * time.Second
+	token, err := tokens.Issue(rand.Uint64(), 1<<config.GameMode, lifetime)
+	if err != nil {
+		return nil, err
+	}
+	return auth.AppendCredentials(nil, token), nil
 }
 
 func (s *SimulatedClient) waitForEvent(e uint8) {
 	for {
-		buffer := <-s.ReadChan
-		pack := frame.Unmarshal(buffer)
+		pack := s.nextPacket()
 		if pack.IsEventPack(e) {
 			log.Printf("< [receiving] GID: %v, CID: %v, Event: %v\n", s.GameID, s.ClientID, resolveEvent(pack))
 			break
@@ -196,11 +575,7 @@ func (s *SimulatedClient) interruptHandle(ip, port string) {
 
 func resolveEvent(pack *frame.Packet) string {
 	if len(pack.Events) == 1 {
-		event, exists := frame.EventName[pack.Events[0].ID]
-		if exists {
-			return event
-		}
-		return frame.EventName[frame.Events.Data]
+		return frame.DefaultRegistry.Name(pack.Events[0].ID)
 	}
 	return frame.EventName[frame.Events.Data]
 }
@@ -0,0 +1,203 @@
+package snapshot
+
+import (
+	"errors"
+	"gameserver/utils"
+	"math"
+)
+
+// Snapshots are sent as delta against a baseline that the client acked
+// |-------------------------------------------------------|
+// |  tick  | baseline tick | number of entity | entities...|
+// |-------------------------------------------------------|
+// | 4byte  |    4byte      |     uvarint      |            |
+// |-------------------------------------------------------|
+// baseline tick is zero for full snapshots. entities are bit packed in ID order
+// |-------------------------------------------------------|
+// | entity ID | op    | by op                             |
+// |-------------------------------------------------------|
+// | uvarint   | 2bit  | changed: field count, change mask |
+// |           |       |   (1bit per field), changed fields|
+// |           |       | added: field count, all fields    |
+// |           |       | removed: nothing                  |
+// |-------------------------------------------------------|
+// field count is uvarint and fields are raw 32 bit floats.
+// entities that did not change are not written at all
+
+const (
+	opChanged uint64 = 0
+	opAdded   uint64 = 1
+	opRemoved uint64 = 2
+
+	opBits int = 2
+
+	// DeltaHeaderSize is the size of the tick and baseline tick
+	DeltaHeaderSize int = 8
+
+	// fields of a single entity are limited so a malformed count can not allocate much
+	MaxEntityFields int = 1024
+)
+
+var (
+	ErrInvalidDelta    error = errors.New("snapshot: invalid delta")
+	ErrUnknownBaseline error = errors.New("snapshot: baseline is not known")
+	ErrStaleSnapshot   error = errors.New("snapshot: snapshot is older than the latest one")
+)
+
+// AppendDelta appends the delta of state against base to dst.
+// base is nil and baseTick is zero for a full snapshot
+func AppendDelta(dst []byte, tick, baseTick uint32, base, state State) []byte {
+	dst = utils.AppendLE(dst, tick)
+	dst = utils.AppendLE(dst, baseTick)
+	w := utils.NewBitWriterTo(dst)
+
+	var changed, removed []uint16
+	for _, id := range state.ids() {
+		baseFields, exists := base[id]
+		if !exists || !equalFields(baseFields, state[id]) {
+			changed = append(changed, id)
+		}
+	}
+	for _, id := range base.ids() {
+		if _, exists := state[id]; !exists {
+			removed = append(removed, id)
+		}
+	}
+	w.WriteUvarint(uint64(len(changed) + len(removed)))
+	for _, id := range changed {
+		w.WriteUvarint(uint64(id))
+		fields := state[id]
+		baseFields, exists := base[id]
+		if !exists || len(baseFields) != len(fields) {
+			w.WriteBits(opAdded, opBits)
+			w.WriteUvarint(uint64(len(fields)))
+			for _, f := range fields {
+				w.WriteBits(uint64(math.Float32bits(f)), 32)
+			}
+			continue
+		}
+		w.WriteBits(opChanged, opBits)
+		w.WriteUvarint(uint64(len(fields)))
+		for i := range fields {
+			w.WriteBool(math.Float32bits(fields[i]) != math.Float32bits(baseFields[i]))
+		}
+		for i := range fields {
+			if math.Float32bits(fields[i]) != math.Float32bits(baseFields[i]) {
+				w.WriteBits(uint64(math.Float32bits(fields[i])), 32)
+			}
+		}
+	}
+	for _, id := range removed {
+		w.WriteUvarint(uint64(id))
+		w.WriteBits(opRemoved, opBits)
+	}
+	return w.Bytes()
+}
+
+// DeltaTicks reads the tick and baseline tick of a delta
+func DeltaTicks(data []byte) (tick, baseTick uint32, err error) {
+	tick, err = utils.ReadLE[uint32](data)
+	if err != nil {
+		return 0, 0, ErrInvalidDelta
+	}
+	baseTick, err = utils.ReadLE[uint32](data[4:])
+	if err != nil {
+		return 0, 0, ErrInvalidDelta
+	}
+	return tick, baseTick, nil
+}
+
+// ApplyDelta reconstructs the full state of a delta on its baseline.
+// base is not changed, it must be nil for full snapshots
+func ApplyDelta(data []byte, base State) (State, error) {
+	if len(data) < DeltaHeaderSize {
+		return nil, ErrInvalidDelta
+	}
+	state := base.Clone()
+	r := utils.NewBitReader(data[DeltaHeaderSize:])
+	n, err := r.ReadUvarint()
+	// every entity takes at least 10 bits
+	if err != nil || n*10 > uint64(r.Remaining()) {
+		return nil, ErrInvalidDelta
+	}
+	for i := uint64(0); i < n; i++ {
+		err = applyEntity(r, state)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// only the zero padding of the last byte may be left
+	if r.Remaining() >= 8 {
+		return nil, ErrInvalidDelta
+	}
+	if padding, _ := r.ReadBits(r.Remaining()); padding != 0 {
+		return nil, ErrInvalidDelta
+	}
+	return state, nil
+}
+
+func applyEntity(r *utils.BitReader, state State) error {
+	id, err := r.ReadUvarint()
+	if err != nil || id > math.MaxUint16 {
+		return ErrInvalidDelta
+	}
+	op, err := r.ReadBits(opBits)
+	if err != nil {
+		return ErrInvalidDelta
+	}
+	if op == opRemoved {
+		delete(state, uint16(id))
+		return nil
+	}
+	count, err := r.ReadUvarint()
+	if err != nil || count > uint64(MaxEntityFields) {
+		return ErrInvalidDelta
+	}
+	switch op {
+	case opAdded:
+		fields := make([]float32, count)
+		for i := range fields {
+			bits, err := r.ReadBits(32)
+			if err != nil {
+				return ErrInvalidDelta
+			}
+			fields[i] = math.Float32frombits(uint32(bits))
+		}
+		state[uint16(id)] = fields
+	case opChanged:
+		fields, exists := state[uint16(id)]
+		if !exists || len(fields) != int(count) {
+			return ErrInvalidDelta
+		}
+		mask, err := readMask(r, len(fields))
+		if err != nil {
+			return err
+		}
+		for i := range fields {
+			if !mask[i] {
+				continue
+			}
+			bits, err := r.ReadBits(32)
+			if err != nil {
+				return ErrInvalidDelta
+			}
+			// fields of the clone are not shared with the baseline
+			fields[i] = math.Float32frombits(uint32(bits))
+		}
+	default:
+		return ErrInvalidDelta
+	}
+	return nil
+}
+
+func readMask(r *utils.BitReader, n int) ([]bool, error) {
+	mask := make([]bool, n)
+	for i := range mask {
+		changed, err := r.ReadBool()
+		if err != nil {
+			return nil, ErrInvalidDelta
+		}
+		mask[i] = changed
+	}
+	return mask, nil
+}
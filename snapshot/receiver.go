@@ -0,0 +1,62 @@
+package snapshot
+
+import "sync"
+
+// Receiver reconstructs snapshots of the server and keeps them as baselines.
+// server may use any of the recent ones, older snapshots than the history are forgotten.
+// it is safe for concurrent use
+type Receiver struct {
+	mu          sync.Mutex
+	received    map[uint32]State
+	latest      uint32
+	historySize int
+}
+
+func NewReceiver(historySize int) *Receiver {
+	return &Receiver{
+		received:    make(map[uint32]State),
+		historySize: historySize,
+	}
+}
+
+// Apply reconstructs the full state of a delta and returns it with its tick.
+// the tick should be acked to the server so it becomes the next baseline.
+// snapshots older than the latest one are not applied
+func (r *Receiver) Apply(data []byte) (uint32, State, error) {
+	tick, baseTick, err := DeltaTicks(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tick <= r.latest {
+		return 0, nil, ErrStaleSnapshot
+	}
+	var base State
+	if baseTick != 0 {
+		var exists bool
+		base, exists = r.received[baseTick]
+		if !exists {
+			return 0, nil, ErrUnknownBaseline
+		}
+	}
+	state, err := ApplyDelta(data, base)
+	if err != nil {
+		return 0, nil, err
+	}
+	r.received[tick] = state
+	r.latest = tick
+	for received := range r.received {
+		if tick-received >= uint32(r.historySize) {
+			delete(r.received, received)
+		}
+	}
+	return tick, state, nil
+}
+
+// Latest returns the latest state and its tick, zero tick before the first snapshot
+func (r *Receiver) Latest() (uint32, State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latest, r.received[r.latest]
+}
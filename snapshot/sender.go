@@ -0,0 +1,68 @@
+package snapshot
+
+import "sync"
+
+// Sender keeps the snapshots sent to a single client until they are acked or outdated.
+// the latest acked snapshot is the baseline of the next delta,
+// snapshots are sent full until the client acks one.
+// it is safe for concurrent use
+type Sender struct {
+	mu sync.Mutex
+	// sent snapshots newer than the baseline by tick
+	sent     map[uint32]State
+	base     State
+	baseTick uint32
+	// sent snapshots are limited, the oldest ones are forgotten
+	historySize int
+}
+
+func NewSender(historySize int) *Sender {
+	return &Sender{
+		sent:        make(map[uint32]State),
+		historySize: historySize,
+	}
+}
+
+// Delta encodes state against the baseline and remembers it until it is acked.
+// the client forgets baselines older than the history, state is sent full
+// until a newer snapshot is acked when acks are lost for that long.
+// ticks must increase, state must not be changed afterwards
+func (s *Sender) Delta(tick uint32, state State) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[tick] = state
+	for sent := range s.sent {
+		if tick-sent >= uint32(s.historySize) {
+			delete(s.sent, sent)
+		}
+	}
+	if s.baseTick == 0 || tick-s.baseTick >= uint32(s.historySize) {
+		return AppendDelta(nil, tick, 0, nil, state)
+	}
+	return AppendDelta(nil, tick, s.baseTick, s.base, state)
+}
+
+// Ack moves the baseline to an acked snapshot.
+// acks of unknown or older snapshots than the baseline are ignored
+func (s *Sender) Ack(tick uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, exists := s.sent[tick]
+	if !exists || tick <= s.baseTick {
+		return
+	}
+	s.base = state
+	s.baseTick = tick
+	for sent := range s.sent {
+		if sent <= tick {
+			delete(s.sent, sent)
+		}
+	}
+}
+
+// Baseline returns the tick of the baseline, zero before the first ack
+func (s *Sender) Baseline() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.baseTick
+}
@@ -0,0 +1,91 @@
+package snapshot
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// State is the world state of a game, fields of every entity by entity ID.
+// states handed to Sender and returned by Receiver must not be changed, they are baselines
+type State map[uint16][]float32
+
+// Clone returns a deep copy of the state
+func (s State) Clone() State {
+	clone := make(State, len(s))
+	for id, fields := range s {
+		clone[id] = append([]float32(nil), fields...)
+	}
+	return clone
+}
+
+// Equal compares fields bit by bit, so NaN fields are equal to themselves
+func (s State) Equal(other State) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for id, fields := range s {
+		otherFields, exists := other[id]
+		if !exists || !equalFields(fields, otherFields) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalFields(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Float32bits(a[i]) != math.Float32bits(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ids returns entity IDs in ascending order, deltas are written in this order
+func (s State) ids() []uint16 {
+	ids := make([]uint16, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// World is the authoritative state of a game on the server.
+// game logic changes entities, the snapshot routine takes a copy every tick.
+// it is safe for concurrent use
+type World struct {
+	mu    sync.Mutex
+	state State
+	tick  uint32
+}
+
+func NewWorld() *World {
+	return &World{state: State{}}
+}
+
+// Set replaces the fields of an entity, the entity is added when it does not exist
+func (w *World) Set(id uint16, fields []float32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state[id] = append([]float32(nil), fields...)
+}
+
+func (w *World) Remove(id uint16) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.state, id)
+}
+
+// Snapshot advances the tick and returns it with a copy of the state.
+// first tick is 1, zero means no snapshot
+func (w *World) Snapshot() (uint32, State) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tick++
+	return w.tick, w.state.Clone()
+}
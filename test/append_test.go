@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bytes"
+	"gameserver/frame"
+	"testing"
+	"time"
+)
+
+func TestAppendMarshal(t *testing.T) {
+	legacy := frame.CreatePack(1, 2, frame.Events.Ack)
+	legacy.Version = frame.Version0
+	checked := gamePacket()
+	checked.Flags = frame.FlagChecksum | frame.FlagSequenced
+	for _, p := range []*frame.Packet{gamePacket(), legacy, checked, compactPacket(time.Now())} {
+		expected, err := frame.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix := []byte("prefix")
+		pack, err := frame.AppendMarshal(prefix, p)
+		if err != nil || !bytes.Equal(pack[:len(prefix)], prefix) || !bytes.Equal(pack[len(prefix):], expected) {
+			t.Log("ERROR: appended frame mismatch", err)
+			t.Fail()
+		}
+	}
+
+	// failed encoding leaves dst as it is
+	bad := gamePacket()
+	bad.Version = frame.Version0
+	pack, err := frame.AppendMarshal([]byte("prefix"), bad)
+	if err != frame.ErrTypedEventInLegacy || string(pack) != "prefix" {
+		t.Log("ERROR: failed encoding changed dst", err)
+		t.Fail()
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	typed, _ := frame.Encode(gamePacket())
+	ack := frame.CreatePack(1, 2, frame.Events.Ack)
+	ack.Flags = frame.FlagSequenced
+	ack.Seq = 7
+	legacy, _ := frame.Encode(ack)
+
+	p := &frame.Packet{}
+	err := frame.DecodeInto(typed, p)
+	if err != nil || len(p.Events) != 2 || !p.Events[0].IsTyped() {
+		t.Fatal("ERROR: typed frame decode failed", err)
+	}
+	first := p.Events[0]
+	err = frame.DecodeInto(legacy, p)
+	if err != nil || !p.IsEventPack(frame.Events.Ack) || p.Events[0].IsTyped() || p.Seq != 7 || p.Events[0].Data != 2 {
+		t.Fatal("ERROR: previous decode leaked into the packet", err)
+	}
+	if p.Events[0] != first {
+		t.Log("ERROR: event is not reused")
+		t.Fail()
+	}
+	err = frame.DecodeInto(typed, p)
+	if err != nil || p.Flags&frame.FlagSequenced != 0 || p.Seq != 0 || len(p.Events) != 2 {
+		t.Log("ERROR: flags and sections are not cleared", err)
+		t.Fail()
+	}
+	expected, _ := frame.Decode(typed)
+	if pack, _ := frame.Encode(p); !bytes.Equal(pack, typed) || p.TimeStamp != expected.TimeStamp {
+		t.Log("ERROR: reused packet differs from a fresh one")
+		t.Fail()
+	}
+}
+
+func TestZeroAllocation(t *testing.T) {
+	checked := gamePacket()
+	checked.Flags = frame.FlagChecksum | frame.FlagSequenced
+	compact := compactPacket(time.Now())
+	for _, p := range []*frame.Packet{gamePacket(), checked, compact, frame.CreatePack(1, 2, frame.Events.Ack)} {
+		buffer := make([]byte, 0, frame.MaxDatagramSize)
+		if allocs := testing.AllocsPerRun(100, func() {
+			buffer, _ = frame.AppendMarshal(buffer[:0], p)
+		}); allocs != 0 {
+			t.Log("ERROR: encoding allocates", allocs)
+			t.Fail()
+		}
+		decoded := &frame.Packet{}
+		frame.DecodeInto(buffer, decoded)
+		if allocs := testing.AllocsPerRun(100, func() {
+			frame.DecodeInto(buffer, decoded)
+		}); allocs != 0 {
+			t.Log("ERROR: decoding allocates", allocs)
+			t.Fail()
+		}
+	}
+}
+
+func benchmarkAppendMarshal(b *testing.B, p *frame.Packet) {
+	buffer := frame.GetBuffer()
+	defer frame.PutBuffer(buffer)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame.AppendMarshal((*buffer)[:0], p)
+	}
+}
+
+func benchmarkDecodeInto(b *testing.B, p *frame.Packet) {
+	pack, _ := frame.Encode(p)
+	decoded := &frame.Packet{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame.DecodeInto(pack, decoded)
+	}
+}
+
+func BenchmarkAppendMarshalTyped(b *testing.B) {
+	benchmarkAppendMarshal(b, gamePacket())
+}
+
+func BenchmarkAppendMarshalCompact(b *testing.B) {
+	benchmarkAppendMarshal(b, compactPacket(time.Now()))
+}
+
+func BenchmarkDecodeIntoTyped(b *testing.B) {
+	benchmarkDecodeInto(b, gamePacket())
+}
+
+func BenchmarkDecodeIntoCompact(b *testing.B) {
+	benchmarkDecodeInto(b, compactPacket(time.Now()))
+}
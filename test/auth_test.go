@@ -0,0 +1,135 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gameserver/auth"
+	"gameserver/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	keyring := utils.NewKeyring()
+	keyring.Add(1, []byte("token key of the auth test"))
+	keyring.Use(1)
+	token, _ := keyring.Issue(7, 1<<2, time.Hour)
+
+	var a auth.Authenticator = auth.NewTokenAuthenticator(keyring)
+	identity, err := a.Authenticate(token)
+	if err != nil || identity.PlayerID != 7 || !identity.Allows(2) || identity.Allows(0) {
+		t.Fatal("ERROR: token identity mismatch", identity, err)
+	}
+	token[5] ^= 1
+	if _, err := a.Authenticate(token); !errors.Is(err, utils.ErrTokenSignature) {
+		t.Log("ERROR: tampered token is accepted", err)
+		t.Fail()
+	}
+}
+
+func TestFileAuthenticator(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	other, _ := bcrypt.GenerateFromPassword([]byte("swordfish"), bcrypt.MinCost)
+	file := fmt.Sprintf("# players\n\n12 %s 0x3\n13 %s 0\n", hash, other)
+	a, err := auth.NewFileAuthenticator(strings.NewReader(file))
+	if err != nil {
+		t.Fatal("ERROR: credentials file", err)
+	}
+	identity, err := a.Authenticate([]byte("12:hunter2"))
+	if err != nil || identity.PlayerID != 12 || !identity.Allows(0) || !identity.Allows(1) || identity.Allows(2) {
+		t.Fatal("ERROR: file identity mismatch", identity, err)
+	}
+	tests := []struct {
+		credentials string
+		err         error
+	}{
+		{"12:hunter3", auth.ErrUnauthorized},
+		{"14:hunter2", auth.ErrUnauthorized},
+		{"13:", auth.ErrUnauthorized},
+		{"12hunter2", auth.ErrInvalidCredentials},
+		{"x:hunter2", auth.ErrInvalidCredentials},
+	}
+	for _, test := range tests {
+		if _, err := a.Authenticate([]byte(test.credentials)); !errors.Is(err, test.err) {
+			t.Log("ERROR: credentials are not rejected", test.credentials, err)
+			t.Fail()
+		}
+	}
+
+	// unsalted SHA-256 hashes of the former file format are not accepted
+	sha := sha256.Sum256([]byte("hunter2"))
+	for _, malformed := range []string{"12 abcd 1", "12 " + string(hash), "x " + string(hash) + " 1", "12 " + hex.EncodeToString(sha[:]) + " 1"} {
+		if _, err := auth.NewFileAuthenticator(strings.NewReader(malformed)); err == nil {
+			t.Log("ERROR: malformed credentials file is accepted", malformed)
+			t.Fail()
+		}
+	}
+}
+
+func TestHTTPAuthenticator(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.PostFormValue("token") {
+		case "good":
+			fmt.Fprintf(w, `{"active": true, "player_id": 21, "modes": 1, "exp": %v}`, time.Now().Add(time.Hour).Unix())
+		case "expired":
+			fmt.Fprintf(w, `{"active": true, "player_id": 21, "modes": 1, "exp": %v}`, time.Now().Add(-time.Hour).Unix())
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			fmt.Fprint(w, `{"active": false}`)
+		}
+	}))
+	defer endpoint.Close()
+
+	a := auth.NewHTTPAuthenticator(endpoint.URL, 100*time.Millisecond)
+	identity, err := a.Authenticate([]byte("good"))
+	if err != nil || identity.PlayerID != 21 || !identity.Allows(0) || identity.ExpiresAt.IsZero() {
+		t.Fatal("ERROR: introspection identity mismatch", identity, err)
+	}
+	tests := []struct {
+		credentials string
+		err         error
+	}{
+		{"unknown", auth.ErrUnauthorized},
+		{"expired", auth.ErrUnauthorized},
+		{"broken", auth.ErrIntrospection},
+		{"slow", auth.ErrIntrospection},
+	}
+	for _, test := range tests {
+		if _, err := a.Authenticate([]byte(test.credentials)); !errors.Is(err, test.err) {
+			t.Log("ERROR: credentials are not rejected", test.credentials, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestCredentialsFraming(t *testing.T) {
+	request := auth.AppendCredentials(nil, []byte("12:hunter2"))
+	request = append(request, 1, 2, 3)
+	reader := bufio.NewReader(bytes.NewReader(request))
+	credentials, err := auth.ReadCredentials(reader)
+	if err != nil || string(credentials) != "12:hunter2" {
+		t.Fatal("ERROR: credentials mismatch", credentials, err)
+	}
+	if rest, _ := reader.Peek(3); !bytes.Equal(rest, []byte{1, 2, 3}) {
+		t.Log("ERROR: request after the credentials mismatch", rest)
+		t.Fail()
+	}
+	for _, malformed := range [][]byte{{0, 0}, utils.AppendLE(nil, uint16(auth.MaxCredentialsSize+1))} {
+		if _, err := auth.ReadCredentials(bufio.NewReader(bytes.NewReader(malformed))); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Log("ERROR: malformed credentials length is accepted", malformed, err)
+			t.Fail()
+		}
+	}
+}
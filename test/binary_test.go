@@ -0,0 +1,92 @@
+package test
+
+import (
+	"bytes"
+	"gameserver/frame"
+	"gameserver/utils"
+	"math"
+	"testing"
+)
+
+func TestLittleEndian(t *testing.T) {
+	pack := utils.AppendLE(nil, uint16(0x0102))
+	pack = utils.AppendLE(pack, int32(-2))
+	pack = utils.AppendLE(pack, float32(1.5))
+	pack = utils.AppendLE(pack, uint64(math.MaxUint64))
+	pack = utils.AppendLE(pack, frame.PayloadVector)
+	expected := []byte{2, 1, 0xfe, 0xff, 0xff, 0xff, 0, 0, 0xc0, 0x3f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 8}
+	if !bytes.Equal(pack, expected) {
+		t.Fatal("ERROR: little endian encoding mismatch", pack)
+	}
+	if v, err := utils.ReadLE[uint16](pack); err != nil || v != 0x0102 {
+		t.Log("ERROR: uint16 mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := utils.ReadLE[int32](pack[2:]); err != nil || v != -2 {
+		t.Log("ERROR: int32 mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := utils.ReadLE[float32](pack[6:]); err != nil || v != 1.5 {
+		t.Log("ERROR: float32 mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := utils.ReadLE[frame.PayloadType](pack[18:]); err != nil || v != frame.PayloadVector {
+		t.Log("ERROR: defined type mismatch", v, err)
+		t.Fail()
+	}
+	if _, err := utils.ReadLE[uint64](pack[12:]); err != utils.ErrShortInput {
+		t.Log("ERROR: short input accepted", err)
+		t.Fail()
+	}
+	if err := utils.PutLE(make([]byte, 3), float32(1)); err != utils.ErrShortInput {
+		t.Log("ERROR: short output accepted", err)
+		t.Fail()
+	}
+	if _, err := utils.ReadBool([]byte{2}); err == nil {
+		t.Log("ERROR: invalid bool accepted")
+		t.Fail()
+	}
+}
+
+type section struct {
+	ID      uint16
+	Flags   [2]bool
+	Nested  struct{ Scale float64 }
+	Offset  int8
+	Skipped []byte `le:"-"`
+	private int64
+}
+
+func TestStructCodec(t *testing.T) {
+	s := section{ID: 7, Flags: [2]bool{false, true}, Offset: -3, Skipped: []byte("x")}
+	s.Nested.Scale = 0.25
+	if size, err := utils.SizeOfStruct(s); err != nil || size != 13 {
+		t.Fatal("ERROR: struct size mismatch", size, err)
+	}
+	pack, err := utils.AppendStruct(nil, &s)
+	if err != nil || len(pack) != 13 {
+		t.Fatal("ERROR: struct encoding failed", err)
+	}
+	decoded := section{Skipped: []byte("kept")}
+	n, err := utils.ReadStruct(pack, &decoded)
+	if err != nil || n != 13 || decoded.ID != 7 || !decoded.Flags[1] || decoded.Nested.Scale != 0.25 || decoded.Offset != -3 || string(decoded.Skipped) != "kept" {
+		t.Log("ERROR: struct decoding mismatch", decoded, err)
+		t.Fail()
+	}
+	if _, err = utils.ReadStruct(pack[:12], &decoded); err != utils.ErrShortInput {
+		t.Log("ERROR: short struct accepted", err)
+		t.Fail()
+	}
+	if _, err = utils.AppendStruct(nil, struct{ Name string }{"gg"}); err != utils.ErrUnsupportedType {
+		t.Log("ERROR: unsupported field accepted", err)
+		t.Fail()
+	}
+}
+
+func TestShortPayload(t *testing.T) {
+	p := &frame.Payload{Type: frame.PayloadInt64, Value: []byte{1, 2}}
+	if _, err := p.Int64(); err != utils.ErrShortInput {
+		t.Log("ERROR: short payload accepted", err)
+		t.Fail()
+	}
+}
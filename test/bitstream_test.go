@@ -0,0 +1,58 @@
+package test
+
+import (
+	"gameserver/utils"
+	"math"
+	"testing"
+)
+
+func TestBitStream(t *testing.T) {
+	w := utils.NewBitWriter(16)
+	w.WriteBits(5, 3)
+	w.WriteBool(true)
+	w.WriteUvarint(300)
+	w.WriteVarint(-2)
+	w.WriteVarint(math.MinInt64)
+	w.WriteBytes([]byte("gg"))
+	if w.Len() != 3+1+16+8+80+16 {
+		t.Fatal("ERROR: written bit count mismatch", w.Len())
+	}
+
+	r := utils.NewBitReader(w.Bytes())
+	if v, err := r.ReadBits(3); err != nil || v != 5 {
+		t.Log("ERROR: bits mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := r.ReadBool(); err != nil || !v {
+		t.Log("ERROR: bool mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := r.ReadUvarint(); err != nil || v != 300 {
+		t.Log("ERROR: uvarint mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := r.ReadVarint(); err != nil || v != -2 {
+		t.Log("ERROR: varint mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := r.ReadVarint(); err != nil || v != math.MinInt64 {
+		t.Log("ERROR: min varint mismatch", v, err)
+		t.Fail()
+	}
+	if v, err := r.ReadBytes(2); err != nil || string(v) != "gg" {
+		t.Log("ERROR: bytes mismatch", v, err)
+		t.Fail()
+	}
+	if _, err := r.ReadBits(8); err != utils.ErrShortBitStream {
+		t.Log("ERROR: read past the end", err)
+		t.Fail()
+	}
+}
+
+func TestVarintOverflow(t *testing.T) {
+	overflow := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}
+	if _, err := utils.NewBitReader(overflow).ReadUvarint(); err != utils.ErrVarintOverflow {
+		t.Log("ERROR: varint overflow accepted", err)
+		t.Fail()
+	}
+}
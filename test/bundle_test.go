@@ -0,0 +1,119 @@
+package test
+
+import (
+	"bytes"
+	"gameserver/frame"
+	"testing"
+)
+
+func bundleFrames(t *testing.T, n int) [][]byte {
+	frames := make([][]byte, n)
+	for i := range frames {
+		p := frame.CreatePack(1, uint16(i+1), frame.Events.Data)
+		p.Flags = frame.FlagChecksum
+		packet, err := frame.Encode(p)
+		if err != nil {
+			t.Fatal("ERROR: encode failed", err)
+		}
+		frames[i] = packet
+	}
+	return frames
+}
+
+func TestBundle(t *testing.T) {
+	frames := bundleFrames(t, 3)
+	bundler := frame.NewBundler(1200)
+	for _, f := range frames {
+		if ready := bundler.Add(f); len(ready) != 0 {
+			t.Fatal("ERROR: small frames are not coalesced", len(ready))
+		}
+	}
+	datagram := bundler.Flush()
+	if !frame.IsBundle(datagram) {
+		t.Fatal("ERROR: flushed datagram is not a bundle")
+	}
+	if bundler.Flush() != nil {
+		t.Log("ERROR: empty bundler flushed a datagram")
+		t.Fail()
+	}
+	unbundled, err := frame.Unbundle(datagram)
+	if err != nil || len(unbundled) != len(frames) {
+		t.Fatal("ERROR: unbundle failed", len(unbundled), err)
+	}
+	for i := range frames {
+		if !bytes.Equal(unbundled[i], frames[i]) {
+			t.Log("ERROR: bundled frame mismatch", i)
+			t.Fail()
+		}
+		if _, err := frame.Decode(unbundled[i]); err != nil {
+			t.Log("ERROR: bundled frame can not be decoded", i, err)
+			t.Fail()
+		}
+	}
+
+	// a single frame is sent as it is
+	bundler.Add(frames[0])
+	if single := bundler.Flush(); !bytes.Equal(single, frames[0]) {
+		t.Log("ERROR: single frame is bundled", single)
+		t.Fail()
+	}
+}
+
+func TestBundleMTU(t *testing.T) {
+	frames := bundleFrames(t, 3)
+	// room for two frames only
+	mtu := frame.BundleHeaderSize + 2*(2+len(frames[0]))
+	bundler := frame.NewBundler(mtu)
+	bundler.Add(frames[0])
+	bundler.Add(frames[1])
+	ready := bundler.Add(frames[2])
+	if len(ready) != 1 || len(ready[0]) != mtu {
+		t.Fatal("ERROR: full bundle is not flushed on size", len(ready))
+	}
+	if rest := bundler.Flush(); !bytes.Equal(rest, frames[2]) {
+		t.Log("ERROR: frame after a full bundle mismatch", rest)
+		t.Fail()
+	}
+
+	// frames that do not fit a bundle are sent right away, after the pending ones
+	large := make([]byte, mtu)
+	bundler.Add(frames[0])
+	ready = bundler.Add(large)
+	if len(ready) != 2 || !bytes.Equal(ready[0], frames[0]) || !bytes.Equal(ready[1], large) {
+		t.Log("ERROR: large frame is not sent in order", len(ready))
+		t.Fail()
+	}
+}
+
+func TestUnbundleMalformed(t *testing.T) {
+	frames := bundleFrames(t, 2)
+	bundler := frame.NewBundler(1200)
+	bundler.Add(frames[0])
+	bundler.Add(frames[1])
+	datagram := bundler.Flush()
+
+	for i := 0; i < len(datagram); i++ {
+		if _, err := frame.Unbundle(datagram[:i]); err != frame.ErrInvalidBundle {
+			t.Log("ERROR: truncated bundle accepted", i, err)
+			t.Fail()
+		}
+	}
+	if _, err := frame.Unbundle(append(datagram, 0)); err != frame.ErrInvalidBundle {
+		t.Log("ERROR: trailing bytes accepted", err)
+		t.Fail()
+	}
+	empty := []byte{frame.Magic[0], frame.Magic[1], frame.BundleVersion, 0}
+	if _, err := frame.Unbundle(empty); err != frame.ErrInvalidBundle {
+		t.Log("ERROR: empty bundle accepted", err)
+		t.Fail()
+	}
+	nested := []byte{frame.Magic[0], frame.Magic[1], frame.BundleVersion, 1, byte(len(datagram)), 0}
+	if _, err := frame.Unbundle(append(nested, datagram...)); err != frame.ErrNestedBundle {
+		t.Log("ERROR: nested bundle accepted", err)
+		t.Fail()
+	}
+	if _, err := frame.Decode(datagram); err == nil {
+		t.Log("ERROR: bundle decoded as a frame")
+		t.Fail()
+	}
+}
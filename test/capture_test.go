@@ -0,0 +1,94 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"gameserver/frame"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := frame.NewCaptureWriter(&buffer)
+	if err != nil {
+		t.Fatal("ERROR: capture header", err)
+	}
+	now := time.Now()
+	records := []*frame.CaptureRecord{
+		{Time: now, Direction: frame.ClientToServer, GameID: 1, ClientID: 7, Peer: "127.0.0.1:4000", Frame: []byte{1, 2, 3}},
+		{Time: now.Add(time.Millisecond), Direction: frame.ServerToClient, GameID: 1, ClientID: 8, Peer: "127.0.0.1:4001", Frame: []byte{4}},
+		{Time: now.Add(2 * time.Millisecond), Direction: frame.ServerToClient, GameID: 2, ClientID: 9, Peer: "127.0.0.1:4002", Frame: []byte{5, 6}},
+	}
+	for _, r := range records {
+		if err := writer.Write(r); err != nil {
+			t.Fatal("ERROR: capture write", err)
+		}
+	}
+
+	read, err := frame.ReadCapture(bytes.NewReader(buffer.Bytes()), frame.CaptureFilter{})
+	if err != nil || len(read) != len(records) {
+		t.Fatal("ERROR: capture read", len(read), err)
+	}
+	for i, r := range read {
+		want := records[i]
+		if !r.Time.Equal(want.Time) || r.Direction != want.Direction || r.GameID != want.GameID ||
+			r.ClientID != want.ClientID || r.Peer != want.Peer || !bytes.Equal(r.Frame, want.Frame) {
+			t.Log("ERROR: record mismatch", i, r)
+			t.Fail()
+		}
+	}
+
+	filters := []struct {
+		filter  frame.CaptureFilter
+		clients []uint16
+	}{
+		{frame.CaptureFilter{GameIDs: []uint16{1}}, []uint16{7, 8}},
+		{frame.CaptureFilter{ClientIDs: []uint16{9, 7}}, []uint16{7, 9}},
+		{frame.CaptureFilter{GameIDs: []uint16{1}, ClientIDs: []uint16{9}}, nil},
+	}
+	for _, test := range filters {
+		read, err := frame.ReadCapture(bytes.NewReader(buffer.Bytes()), test.filter)
+		if err != nil || len(read) != len(test.clients) {
+			t.Log("ERROR: filtered read", test.filter, len(read), err)
+			t.Fail()
+			continue
+		}
+		for i, r := range read {
+			if r.ClientID != test.clients[i] {
+				t.Log("ERROR: filter selected", test.filter, r.ClientID)
+				t.Fail()
+			}
+		}
+	}
+
+	_, err = frame.ReadCapture(bytes.NewReader([]byte("GSCQ\x01")), frame.CaptureFilter{})
+	if !errors.Is(err, frame.ErrCaptureHeader) {
+		t.Log("ERROR: bad header is read", err)
+		t.Fail()
+	}
+	_, err = frame.ReadCapture(bytes.NewReader(buffer.Bytes()[:buffer.Len()-1]), frame.CaptureFilter{})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Log("ERROR: truncated record is read", err)
+		t.Fail()
+	}
+}
+
+func TestPeekIDs(t *testing.T) {
+	p := frame.CreatePack(3, 7, frame.Events.Data)
+	p.Flags = frame.FlagSequenced
+	encoded, _ := frame.Encode(p)
+	gameID, clientID, err := frame.PeekIDs(encoded)
+	if err != nil || gameID != 3 || clientID != 7 {
+		t.Fatal("ERROR: peek IDs", gameID, clientID, err)
+	}
+
+	bundler := frame.NewBundler(1200)
+	bundler.Add(encoded)
+	bundler.Add(encoded)
+	gameID, clientID, err = frame.PeekIDs(bundler.Flush())
+	if err != nil || gameID != 3 || clientID != 7 {
+		t.Fatal("ERROR: peek IDs of bundle", gameID, clientID, err)
+	}
+}
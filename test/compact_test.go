@@ -0,0 +1,143 @@
+package test
+
+import (
+	"gameserver/events"
+	"gameserver/frame"
+	"testing"
+	"time"
+)
+
+func compactPacket(epoch time.Time) *frame.Packet {
+	p := gamePacket()
+	p.Flags = frame.FlagCompact
+	p.Epoch = epoch
+	p.TimeStamp = epoch.Add(1500 * time.Millisecond)
+	return p
+}
+
+func TestCompactFrame(t *testing.T) {
+	epoch := time.Now()
+	plain, _ := frame.Encode(gamePacket())
+	compact, err := frame.Encode(compactPacket(epoch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compact) >= len(plain) {
+		t.Fatal("ERROR: compact frame is not smaller", len(compact), len(plain))
+	}
+	newPacket, err := frame.Decode(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPacket.Rebase(epoch)
+	if newPacket.ClientID != 2 || newPacket.GameID != 1 || newPacket.Flags&frame.FlagCompact == 0 {
+		t.Log("ERROR: compact header mismatch", newPacket)
+		t.Fail()
+	}
+	if !newPacket.TimeStamp.Equal(epoch.Add(1500 * time.Millisecond)) {
+		t.Log("ERROR: time stamp is not relative to the epoch", newPacket.TimeStamp)
+		t.Fail()
+	}
+	hit := &events.Hit{}
+	if err = hit.Decode(newPacket); err != nil || hit.Target != 1 || hit.Damage != 4 {
+		t.Log("ERROR: compact event mismatch", hit, err)
+		t.Fail()
+	}
+
+	// legacy events keep their data
+	ack := frame.CreatePack(1, 2, frame.Events.Ack)
+	ack.Flags = frame.FlagCompact
+	ack.Epoch = ack.TimeStamp
+	pack, _ := frame.Encode(ack)
+	newPacket, err = frame.Decode(pack)
+	if err != nil || !newPacket.IsEventPack(frame.Events.Ack) || newPacket.Events[0].Data != 2 {
+		t.Log("ERROR: compact legacy event mismatch", err)
+		t.Fail()
+	}
+}
+
+func TestCompactQuantization(t *testing.T) {
+	p := compactPacket(time.Now())
+	p.Events = nil
+	position := []float32{12.3456, -0.001, 1e9}
+	move := &events.Move{Position: position}
+	move.Encode(p)
+	pack, _ := frame.Encode(p)
+	newPacket, err := frame.Decode(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	move = &events.Move{}
+	if err = move.Decode(newPacket); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range position[:2] {
+		if d := move.Position[i] - v; d > 1.0/512 || d < -1.0/512 {
+			t.Log("ERROR: quantization error is too large", move.Position[i], v)
+			t.Fail()
+		}
+	}
+	// out of range values are sent raw
+	if move.Position[2] != position[2] {
+		t.Log("ERROR: large value is not exact", move.Position[2])
+		t.Fail()
+	}
+}
+
+func TestMalformedCompactFrame(t *testing.T) {
+	pack, _ := frame.Encode(compactPacket(time.Now()))
+	for n := frame.VersionHeaderSize; n < len(pack)-1; n++ {
+		if _, err := frame.Decode(pack[:n]); err == nil {
+			t.Log("ERROR: truncated compact frame accepted", n)
+			t.Fail()
+		}
+	}
+	if _, err := frame.Decode(append(pack, 0, 0)); err != frame.ErrTrailingBytes {
+		t.Log("ERROR: trailing bytes accepted", err)
+		t.Fail()
+	}
+}
+
+func benchmarkEncode(b *testing.B, p *frame.Packet) {
+	pack, _ := frame.Encode(p)
+	b.ReportMetric(float64(len(pack)), "bytes/frame")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame.Encode(p)
+	}
+}
+
+func benchmarkDecode(b *testing.B, p *frame.Packet) {
+	pack, _ := frame.Encode(p)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame.Decode(pack)
+	}
+}
+
+func BenchmarkEncodeTyped(b *testing.B) {
+	benchmarkEncode(b, gamePacket())
+}
+
+func BenchmarkEncodeCompact(b *testing.B) {
+	benchmarkEncode(b, compactPacket(time.Now()))
+}
+
+func BenchmarkEncodeLegacy(b *testing.B) {
+	benchmarkEncode(b, frame.CreatePack(1, 2, frame.Events.Ack))
+}
+
+func BenchmarkEncodeLegacyCompact(b *testing.B) {
+	p := frame.CreatePack(1, 2, frame.Events.Ack)
+	p.Flags = frame.FlagCompact
+	p.Epoch = p.TimeStamp
+	benchmarkEncode(b, p)
+}
+
+func BenchmarkDecodeTyped(b *testing.B) {
+	benchmarkDecode(b, gamePacket())
+}
+
+func BenchmarkDecodeCompact(b *testing.B) {
+	benchmarkDecode(b, compactPacket(time.Now()))
+}
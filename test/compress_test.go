@@ -0,0 +1,92 @@
+package test
+
+import (
+	"gameserver/events"
+	"gameserver/frame"
+	"testing"
+	"time"
+)
+
+func gamePacket() *frame.Packet {
+	p := &frame.Packet{
+		Version:   frame.CurrentVersion,
+		ClientID:  2,
+		GameID:    1,
+		TimeStamp: time.Now(),
+	}
+	move := &events.Move{Position: []float32{12.5, 40, 0}}
+	move.Encode(p)
+	hit := &events.Hit{Target: 1, Damage: 4, Critical: false}
+	hit.Encode(p)
+	return p
+}
+
+func TestCompression(t *testing.T) {
+	events.RegisterCompression()
+	plain, _ := frame.Encode(gamePacket())
+
+	p := gamePacket()
+	p.Compression = frame.CompressionDictionary
+	p.Flags = frame.FlagChecksum
+	compressed, err := frame.Encode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(plain)+frame.ChecksumSize {
+		t.Fatal("ERROR: dictionary compression did not shrink the frame", len(compressed), len(plain))
+	}
+	newPacket, err := frame.Decode(compressed)
+	if err != nil || newPacket.Flags&frame.FlagCompressed == 0 || newPacket.Compression != frame.CompressionDictionary {
+		t.Fatal("ERROR: compressed frame decode failed", err)
+	}
+	move := &events.Move{}
+	if err = move.Decode(newPacket); err != nil || move.Position[0] != 12.5 {
+		t.Log("ERROR: compressed event mismatch", err)
+		t.Fail()
+	}
+
+	// frames that do not shrink are sent as they are
+	small := frame.CreatePack(1, 2, frame.Events.Ack)
+	small.Compression = frame.CompressionFlate
+	pack, _ := frame.Encode(small)
+	if pack[3]&frame.FlagCompressed != 0 || len(pack) != len(frame.Marshal(frame.CreatePack(1, 2, frame.Events.Ack))) {
+		t.Log("ERROR: frame compressed although it did not shrink")
+		t.Fail()
+	}
+
+	// a compressor the receiver does not have is rejected
+	p.Flags = 0
+	unknown, _ := frame.Encode(p)
+	unknown[frame.VersionHeaderSize] = 200
+	if _, err = frame.Decode(unknown); err != frame.ErrUnsupportedCompression {
+		t.Log("ERROR: unknown compressor accepted", err)
+		t.Fail()
+	}
+	corrupted, _ := frame.Encode(p)
+	corrupted[len(corrupted)-1] ^= 0xff
+	if _, err = frame.Decode(corrupted); err == nil {
+		t.Log("ERROR: corrupted compressed body accepted")
+		t.Fail()
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	if frame.NegotiateCompression([]uint8{200, frame.CompressionFlate}) != frame.CompressionFlate {
+		t.Log("ERROR: registered compressor is not picked")
+		t.Fail()
+	}
+	if frame.NegotiateCompression([]uint8{200}) != frame.CompressionNone {
+		t.Log("ERROR: unregistered compressor is picked")
+		t.Fail()
+	}
+}
+
+func BenchmarkCompressDictionary(b *testing.B) {
+	events.RegisterCompression()
+	p := gamePacket()
+	p.Compression = frame.CompressionDictionary
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame.Encode(p)
+	}
+}
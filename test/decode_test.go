@@ -0,0 +1,126 @@
+package test
+
+import (
+	"gameserver/frame"
+	"testing"
+	"time"
+)
+
+func TestDecodeMalformed(t *testing.T) {
+	pack := frame.Marshal(&frame.Packet{
+		ClientID: 3,
+		GameID:   7,
+		Events: []*frame.Event{
+			{ID: 10, Data: 42},
+			{ID: 11, Data: -42},
+		},
+		TimeStamp: time.Now(),
+	})
+
+	lying := append([]byte{}, pack...)
+	lying[4] = 200
+
+	cases := []struct {
+		name   string
+		packet []byte
+		err    error
+	}{
+		{"empty", []byte{}, frame.ErrShortHeader},
+		{"short header", pack[:3], frame.ErrShortHeader},
+		{"truncated", pack[:len(pack)-1], frame.ErrEventCountMismatch},
+		{"lying number of event", lying, frame.ErrEventCountMismatch},
+		{"trailing bytes", append(append([]byte{}, pack...), 0), frame.ErrTrailingBytes},
+		{"oversize", make([]byte, frame.MaxPacketSize+1), frame.ErrOversize},
+	}
+
+	for _, c := range cases {
+		p, err := frame.Decode(c.packet)
+		if err != c.err || p != nil {
+			t.Logf("ERROR: %v. expected: %v, got: %v", c.name, c.err, err)
+			t.Fail()
+		}
+		if p, err := frame.Unmarshal(c.packet); err != c.err || p != nil {
+			t.Logf("ERROR: %v. unmarshal expected: %v, got: %v", c.name, c.err, err)
+			t.Fail()
+		}
+	}
+
+	// header getters read zero IDs from short input
+	if frame.GetClientID(pack[:1]) != 0 || frame.GetGameID(pack[:1]) != 0 || frame.GetGameID(pack[:3]) != 0 {
+		t.Log("ERROR: IDs are read from short input")
+		t.Fail()
+	}
+
+	p, err := frame.Decode(pack)
+	if err != nil || len(p.Events) != 2 || p.Events[1].Data != -42 {
+		t.Log("ERROR: valid packet rejected", err)
+		t.Fail()
+	}
+}
+
+func TestDecodeVersioned(t *testing.T) {
+	packObject := frame.CreatePack(5, 9, frame.Events.Register)
+	pack := frame.Marshal(packObject)
+
+	version, err := frame.PeekVersion(pack)
+	if err != nil || version != frame.CurrentVersion {
+		t.Log("ERROR: version header is missing", version, err)
+		t.Fail()
+	}
+
+	newPacket, err := frame.Decode(pack)
+	if err != nil || newPacket.Version != frame.CurrentVersion || newPacket.ClientID != 9 || newPacket.GameID != 5 {
+		t.Log("ERROR: versioned packet decode failed", err)
+		t.Fail()
+	}
+
+	unknown := append([]byte{}, pack...)
+	unknown[2] = 200
+	_, err = frame.Decode(unknown)
+	if err != frame.ErrUnsupportedVersion {
+		t.Log("ERROR: unsupported version accepted", err)
+		t.Fail()
+	}
+
+	// every flag bit is used by version 1, legacy frames has no flags
+	flagged := frame.CreatePack(5, 9, frame.Events.Register)
+	flagged.Version = frame.Version0
+	flagged.Flags = frame.FlagCompact
+	_, err = frame.Encode(flagged)
+	if err != frame.ErrUnsupportedFlags {
+		t.Log("ERROR: unsupported flags accepted", err)
+		t.Fail()
+	}
+}
+
+func TestDecodeChecksum(t *testing.T) {
+	packObject := frame.CreatePack(5, 9, frame.Events.Register)
+	packObject.Flags = frame.FlagChecksum
+	pack, err := frame.Encode(packObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPacket, err := frame.Decode(pack)
+	if err != nil || newPacket.ClientID != 9 || newPacket.GameID != 5 || newPacket.Flags&frame.FlagChecksum == 0 {
+		t.Log("ERROR: packet with checksum decode failed", err)
+		t.Fail()
+	}
+
+	// every single bit flip after the version header must be detected
+	for i := frame.VersionHeaderSize; i < len(pack); i++ {
+		corrupted := append([]byte{}, pack...)
+		corrupted[i] ^= 0x10
+		_, err = frame.Decode(corrupted)
+		if err != frame.ErrChecksum {
+			t.Log("ERROR: corrupted packet accepted. offset:", i, err)
+			t.Fail()
+		}
+	}
+
+	_, err = frame.Decode(pack[:len(pack)-1])
+	if err != frame.ErrChecksum {
+		t.Log("ERROR: truncated packet accepted", err)
+		t.Fail()
+	}
+}
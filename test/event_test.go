@@ -35,7 +35,10 @@ func TestEventPackage(t *testing.T) {
 	pack := frame.Marshal(packObject)
 
 	// to packet object
-	newPacket := frame.Unmarshal(pack)
+	newPacket, err := frame.Decode(pack)
+	if err != nil {
+		t.Fatal("ERROR: decode failed", err)
+	}
 	packObject.TimeStamp = packObject.TimeStamp.Round(time.Nanosecond * 100)
 	newPacket.TimeStamp = newPacket.TimeStamp.Round(time.Nanosecond * 100)
 
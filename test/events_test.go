@@ -0,0 +1,65 @@
+package test
+
+import (
+	"gameserver/events"
+	"gameserver/frame"
+	"testing"
+)
+
+func TestGeneratedEvents(t *testing.T) {
+	registry := frame.NewRegistry(true)
+	err := events.Register(registry)
+	if err != nil {
+		t.Log("ERROR: event registration failed", err)
+		t.FailNow()
+	}
+
+	packObject := frame.CreatePack(1, 2, frame.Events.Data)
+	packObject.Events = nil
+	hit := &events.Hit{Target: 3, Damage: 7.5, Critical: true}
+	hit.Encode(packObject)
+	(&events.Move{Position: []float32{1, 2, 3}}).Encode(packObject)
+
+	newPacket, err := frame.Decode(frame.Marshal(packObject))
+	if err != nil {
+		t.Log("ERROR: generated events decode failed", err)
+		t.FailNow()
+	}
+	err = registry.CheckPacket(newPacket, frame.ClientToServer)
+	if err != nil {
+		t.Log("ERROR: valid events rejected", err)
+		t.Fail()
+	}
+
+	newHit := &events.Hit{}
+	err = newHit.Decode(newPacket)
+	if err != nil || *newHit != *hit {
+		t.Log("ERROR: hit event mismatch", newHit, err)
+		t.Fail()
+	}
+
+	cases := []struct {
+		name      string
+		event     *frame.Event
+		direction frame.Direction
+		err       error
+	}{
+		{"wrong direction", (&events.Score{Score: 10}).Event(), frame.ClientToServer, frame.ErrEventDirection},
+		{"reserved", &frame.Event{ID: 250}, frame.ClientToServer, frame.ErrReservedEvent},
+		{"unknown", &frame.Event{ID: 100}, frame.ClientToServer, frame.ErrUnknownEvent},
+		{"schema", &frame.Event{ID: events.MoveID, Data: 1}, frame.ClientToServer, frame.ErrEventSchema},
+	}
+	for _, c := range cases {
+		err := registry.Check(c.event, c.direction)
+		if err != c.err {
+			t.Logf("ERROR: %v. expected: %v, got: %v", c.name, c.err, err)
+			t.Fail()
+		}
+	}
+
+	err = registry.Register(frame.EventSpec{ID: frame.Events.GameOver, Name: "mine"})
+	if err != frame.ErrReservedEvent {
+		t.Log("ERROR: reserved event ID registered", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"gameserver/frame"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func bigPacket(size int) *frame.Packet {
+	return &frame.Packet{
+		Version:  frame.CurrentVersion,
+		ClientID: 1,
+		GameID:   2,
+		Events: []*frame.Event{
+			{ID: 16, Payload: frame.BytesPayload(bytes.Repeat([]byte{7}, size))},
+		},
+		TimeStamp: time.Now(),
+	}
+}
+
+func TestFragmentReassembly(t *testing.T) {
+	p := bigPacket(5000)
+	packet, err := frame.Encode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragments, err := frame.Split(packet, 1, 2, 9, 1200)
+	if err != nil || len(fragments) < 5 {
+		t.Fatal("ERROR: frame is not split", len(fragments), err)
+	}
+	for _, fragment := range fragments {
+		if len(fragment) > 1200 {
+			t.Fatal("ERROR: fragment exceeds MTU", len(fragment))
+		}
+	}
+
+	rand.Shuffle(len(fragments), func(i, j int) { fragments[i], fragments[j] = fragments[j], fragments[i] })
+	r := frame.NewReassembler(time.Second, 1<<20)
+	var newPacket *frame.Packet
+	for i, fragment := range fragments {
+		newPacket, err = r.Decode("peer", fragment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(fragments)-1 && newPacket != nil {
+			t.Fatal("ERROR: incomplete frame is decoded")
+		}
+	}
+	if newPacket == nil {
+		t.Fatal("ERROR: frame is not reassembled")
+	}
+	data, err := newPacket.Events[0].Payload.Bytes()
+	if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{7}, 5000)) {
+		t.Fatal("ERROR: reassembled frame mismatch", err)
+	}
+
+	// a frame that fits MTU is not fragmented
+	small, _ := frame.Split(frame.Marshal(frame.CreatePack(1, 2, frame.Events.Data)), 1, 2, 10, 1200)
+	if len(small) != 1 {
+		t.Fatal("ERROR: small frame is fragmented", len(small))
+	}
+}
+
+func TestReassemblyLimits(t *testing.T) {
+	packet := frame.Marshal(bigPacket(3000))
+	fragments, _ := frame.Split(packet, 1, 2, 1, 1200)
+
+	r := frame.NewReassembler(10*time.Millisecond, 1<<20)
+	r.Decode("peer", fragments[0])
+	time.Sleep(20 * time.Millisecond)
+	r.Decode("other", fragments[0])
+	if r.Stats().Expired != 1 {
+		t.Fatal("ERROR: incomplete frame is not expired", r.Stats())
+	}
+
+	r = frame.NewReassembler(time.Second, 1500)
+	r.Decode("peer", fragments[0])
+	_, err := r.Decode("peer", fragments[1])
+	if !errors.Is(err, frame.ErrReassemblyFull) || r.Stats().Dropped != 1 {
+		t.Fatal("ERROR: reassembly buffer limit is not applied", err)
+	}
+}
+
+func TestReassemblyJunkFragments(t *testing.T) {
+	r := frame.NewReassembler(time.Second, 4096)
+	junk := func(id uint16, index, count uint8) *frame.Packet {
+		return &frame.Packet{Fragment: &frame.Fragment{ID: id, Index: index, Count: count, Data: []byte{1}}}
+	}
+
+	// chunk bookkeeping of 255 fragments does not fit, nothing is kept for them
+	for id := uint16(0); id < 100; id++ {
+		_, err := r.Add("peer", junk(id, 0, 255))
+		if !errors.Is(err, frame.ErrReassemblyFull) {
+			t.Fatal("ERROR: chunk bookkeeping is not counted", err)
+		}
+	}
+	if stats := r.Stats(); stats.Buffered != 0 || stats.Dropped != 100 {
+		t.Fatal("ERROR: refused fragments are buffered", stats)
+	}
+
+	_, err := r.Add("peer", junk(1, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffered := r.Stats().Buffered
+	for _, f := range []*frame.Packet{junk(1, 0, 2), junk(1, 1, 3), junk(1, 5, 2)} {
+		if _, err = r.Add("peer", f); err == nil {
+			t.Fatal("ERROR: invalid fragment is accepted", f.Fragment)
+		}
+	}
+	if r.Stats().Buffered != buffered {
+		t.Log("ERROR: invalid fragments are buffered", r.Stats())
+		t.Fail()
+	}
+	packet, err := r.Add("peer", junk(1, 1, 2))
+	if err != nil || len(packet) != 2 || r.Stats().Buffered != 0 {
+		t.Log("ERROR: completed frame is kept", err, r.Stats())
+		t.Fail()
+	}
+}
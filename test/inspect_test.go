@@ -0,0 +1,69 @@
+package test
+
+import (
+	"errors"
+	"gameserver/frame"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	p := frame.CreatePack(1, 2, frame.Events.Data)
+	p.Events = append(p.Events, &frame.Event{ID: frame.Events.Data, Payload: frame.StringPayload("gg")})
+	p.Flags = frame.FlagSequenced
+	typed, err := frame.Encode(p)
+	if err != nil {
+		t.Fatal("ERROR: encode failed", err)
+	}
+	p.Flags |= frame.FlagChecksum
+	checked, _ := frame.Encode(p)
+	if err = frame.Inspect(checked); err != nil {
+		t.Fatal("ERROR: valid frame is reported", err)
+	}
+	legacy := frame.CreatePack(1, 2, frame.Events.Data)
+	legacy.Version = frame.Version0
+	encodedLegacy, _ := frame.Encode(legacy)
+
+	body := frame.VersionHeaderSize + frame.SequenceHeaderSize
+	event := body + frame.HeaderSize
+	tests := []struct {
+		name   string
+		packet []byte
+		field  string
+		offset int
+		err    error
+	}{
+		{"short legacy", encodedLegacy[:3], "game_id", 2, frame.ErrShortHeader},
+		{"legacy event count", withByte(encodedLegacy, 4, 2), "events[1]", 10, frame.ErrEventCountMismatch},
+		{"short version", typed[:3], "version", 2, frame.ErrShortHeader},
+		{"version", withByte(typed, 2, 9), "version", 2, frame.ErrUnsupportedVersion},
+		{"checksum", withByte(checked, body, 9), "checksum", len(checked) - frame.ChecksumSize, frame.ErrChecksum},
+		{"flags", withByte(typed, 3, frame.FlagEncrypted), "flags", 3, frame.ErrSealed},
+		{"payload type", withByte(typed, event+1, 99), "events[0].type", event + 1, frame.ErrInvalidPayload},
+		{"payload length", withByte(typed, event+2, 3), "events[0].length", event + 2, frame.ErrInvalidPayload},
+		{"event count", withByte(typed, body+4, 3), "events[2]", len(typed) - 8, frame.ErrEventCountMismatch},
+		{"trailing bytes", append(typed, 0), "time_stamp", len(typed) - 8, frame.ErrTrailingBytes},
+	}
+	for _, test := range tests {
+		err := frame.Inspect(test.packet)
+		var fieldErr *frame.FieldError
+		if !errors.As(err, &fieldErr) {
+			t.Log("ERROR: no field error", test.name, err)
+			t.Fail()
+			continue
+		}
+		if fieldErr.Field != test.field || fieldErr.Offset != test.offset || !errors.Is(err, test.err) {
+			t.Log("ERROR: field error mismatch", test.name, err)
+			t.Fail()
+		}
+		if _, decodeErr := frame.Decode(test.packet); decodeErr == nil {
+			t.Log("ERROR: inspected frame is decoded", test.name)
+			t.Fail()
+		}
+	}
+}
+
+func withByte(packet []byte, i int, b byte) []byte {
+	changed := append([]byte(nil), packet...)
+	changed[i] = b
+	return changed
+}
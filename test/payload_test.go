@@ -0,0 +1,100 @@
+package test
+
+import (
+	"gameserver/frame"
+	"gameserver/utils"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTypedEventPackage(t *testing.T) {
+	packObject := &frame.Packet{
+		Version:  frame.CurrentVersion,
+		ClientID: 4,
+		GameID:   12,
+		Events: []*frame.Event{
+			{ID: 20, Data: -7},
+			{ID: 21, Payload: frame.Int64Payload(-1 << 40)},
+			{ID: 22, Payload: frame.Float64Payload(3.25)},
+			{ID: 23, Payload: frame.BoolPayload(true)},
+			{ID: 24, Payload: frame.StringPayload("hello")},
+			{ID: 25, Payload: frame.BytesPayload([]byte{1, 2, 3})},
+			{ID: 26, Payload: frame.VectorPayload(1.5, -2, 8)},
+		},
+		TimeStamp: time.Now(),
+	}
+
+	pack, err := frame.Encode(packObject)
+	if err != nil {
+		t.Log("ERROR: typed packet encode failed", err)
+		t.FailNow()
+	}
+
+	newPacket, err := frame.Decode(pack)
+	if err != nil {
+		t.Log("ERROR: typed packet decode failed", err)
+		t.FailNow()
+	}
+	packObject.Flags = frame.FlagTypedEvents
+	packObject.TimeStamp = packObject.TimeStamp.Round(time.Nanosecond * 100)
+	newPacket.TimeStamp = newPacket.TimeStamp.Round(time.Nanosecond * 100)
+
+	if !reflect.DeepEqual(packObject, newPacket) {
+		t.Log("ERROR: typed event object -> event packet failed")
+		t.Log(utils.SprintStruct(packObject))
+		t.Log(utils.SprintStruct(newPacket))
+		t.Fail()
+	}
+
+	v, err := newPacket.Events[6].Payload.Vector()
+	if err != nil || !reflect.DeepEqual(v, []float32{1.5, -2, 8}) {
+		t.Log("ERROR: vector payload mismatch", v, err)
+		t.Fail()
+	}
+
+	legacy := *packObject
+	legacy.Version = frame.Version0
+	legacy.Flags = 0
+	_, err = frame.Encode(&legacy)
+	if err != frame.ErrTypedEventInLegacy {
+		t.Log("ERROR: typed events encoded into a legacy frame", err)
+		t.Fail()
+	}
+
+	// length of the int32 event does not suit its type
+	pack[frame.VersionHeaderSize+frame.HeaderSize+2] = 0xff
+	_, err = frame.Decode(pack)
+	if err != frame.ErrInvalidPayload {
+		t.Log("ERROR: lying payload length accepted", err)
+		t.Fail()
+	}
+}
+
+func TestEventCountLimit(t *testing.T) {
+	packObject := frame.CreatePack(1, 2, frame.Events.Data)
+	for len(packObject.Events) <= 255 {
+		packObject.Events = append(packObject.Events, &frame.Event{ID: frame.Events.Data})
+	}
+	for _, version := range []uint8{frame.Version0, frame.CurrentVersion} {
+		packObject.Version = version
+		if _, err := frame.Encode(packObject); err != frame.ErrEventCountMismatch {
+			t.Log("ERROR: event count wraps", version, err)
+			t.Fail()
+		}
+	}
+	packObject.Events[0].Payload = frame.BoolPayload(true)
+	if _, err := frame.Encode(packObject); err != frame.ErrEventCountMismatch {
+		t.Log("ERROR: typed event count wraps", err)
+		t.Fail()
+	}
+
+	// hand built bool payloads
+	for _, value := range [][]byte{nil, {1, 0}} {
+		p := frame.Payload{Type: frame.PayloadBool, Value: value}
+		if _, err := p.Bool(); err != frame.ErrInvalidPayload {
+			t.Log("ERROR: bool payload of wrong size", value, err)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"errors"
+	"gameserver/frame"
+	"gameserver/quantize"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantizeScalar(t *testing.T) {
+	ranges := []struct {
+		min, max, precision float32
+		bits                int
+	}{
+		{0, 1, 0.01, 7},
+		{-100, 100, 0.05, 12},
+		{0, 1000, 1, 10},
+		{-1e4, 1e4, 0.01, 22},
+	}
+	random := rand.New(rand.NewSource(1))
+	for _, test := range ranges {
+		s, err := quantize.NewScalar(test.min, test.max, test.precision)
+		if err != nil || s.Bits() != test.bits {
+			t.Log("ERROR: scalar bits mismatch", test, err)
+			t.Fail()
+			continue
+		}
+		if s.MaxError() > test.precision/2 {
+			t.Log("ERROR: max error is above precision", test, s.MaxError())
+			t.Fail()
+		}
+		values := []float32{test.min, test.max, (test.min + test.max) / 2}
+		for i := 0; i < 1000; i++ {
+			values = append(values, test.min+random.Float32()*(test.max-test.min))
+		}
+		for _, v := range values {
+			d := s.Dequantize(s.Quantize(v))
+			if math.Abs(float64(d-v)) > float64(s.MaxError()) {
+				t.Fatal("ERROR: round trip error is too large", test, v, d, s.MaxError())
+			}
+		}
+		if s.Dequantize(s.Quantize(test.max+10)) != test.max || s.Dequantize(s.Quantize(test.min-10)) != test.min {
+			t.Log("ERROR: values out of range are not clamped", test)
+			t.Fail()
+		}
+		if s.Quantize(float32(math.NaN())) != 0 {
+			t.Log("ERROR: NaN is not the minimum", test)
+			t.Fail()
+		}
+	}
+
+	invalid := []struct{ min, max, precision float32 }{
+		{1, 1, 0.1},
+		{1, 0, 0.1},
+		{0, 1, 0},
+		{0, 1, -1},
+		{float32(math.Inf(-1)), 1, 0.1},
+		{0, float32(math.NaN()), 0.1},
+	}
+	for _, test := range invalid {
+		if _, err := quantize.NewScalar(test.min, test.max, test.precision); !errors.Is(err, quantize.ErrInvalidRange) {
+			t.Log("ERROR: invalid range is accepted", test, err)
+			t.Fail()
+		}
+	}
+	// precision finer than 32 bits or float32 values
+	for _, precision := range []float32{1e-6, 0.1} {
+		if _, err := quantize.NewScalar(0, 1e6, precision); !errors.Is(err, quantize.ErrInvalidPrecision) {
+			t.Log("ERROR: unreachable precision is accepted", precision, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestQuantizeVector(t *testing.T) {
+	position, err := quantize.NewVector(3, -512, 512, 0.01)
+	if err != nil {
+		t.Fatal("ERROR: vector", err)
+	}
+	height, _ := quantize.NewScalar(0, 64, 0.1)
+	ground, _ := quantize.NewScalar(-512, 512, 0.5)
+	mixed := quantize.NewVectorOf(ground, ground, height)
+	if mixed.Bits() != 2*12+10 {
+		t.Log("ERROR: vector bits mismatch", mixed.Bits())
+		t.Fail()
+	}
+
+	random := rand.New(rand.NewSource(2))
+	values := make([][]float32, 100)
+	for i := range values {
+		values[i] = []float32{random.Float32()*1024 - 512, random.Float32()*1024 - 512, random.Float32() * 64}
+	}
+	for _, v := range []*quantize.Vector{position, mixed} {
+		p, err := v.Payload(values...)
+		if err != nil {
+			t.Fatal("ERROR: vector payload", err)
+		}
+		if len(p.Value) > 1+(len(values)*v.Bits()+7)/8 {
+			t.Log("ERROR: vector payload is not packed", len(p.Value))
+			t.Fail()
+		}
+		decoded, err := v.Values(p)
+		if err != nil || len(decoded) != len(values) {
+			t.Fatal("ERROR: vector values", len(decoded), err)
+		}
+		for i := range values {
+			for c := range values[i] {
+				if math.Abs(float64(decoded[i][c]-values[i][c])) > float64(v.MaxError()) {
+					t.Fatal("ERROR: vector error is too large", values[i], decoded[i])
+				}
+			}
+		}
+	}
+
+	if _, err := position.Payload([]float32{1, 2}); !errors.Is(err, quantize.ErrDimension) {
+		t.Log("ERROR: dimension mismatch is accepted", err)
+		t.Fail()
+	}
+	if _, err := position.Data(values[0]); !errors.Is(err, quantize.ErrTooManyBits) {
+		t.Log("ERROR: data over 32 bits is accepted", err)
+		t.Fail()
+	}
+	flat := quantize.NewVectorOf(ground, ground)
+	data, err := flat.Data(values[0][:2])
+	if err != nil {
+		t.Fatal("ERROR: vector data", err)
+	}
+	decoded, err := flat.FromData(data)
+	if err != nil || math.Abs(float64(decoded[0]-values[0][0])) > float64(ground.MaxError()) ||
+		math.Abs(float64(decoded[1]-values[0][1])) > float64(ground.MaxError()) {
+		t.Log("ERROR: vector data mismatch", values[0], decoded, err)
+		t.Fail()
+	}
+}
+
+func TestQuantizeRotation(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	for _, bits := range []int{7, 9, 12, 16} {
+		rotation, err := quantize.NewRotation(bits)
+		if err != nil || rotation.Bits() != 2+3*bits {
+			t.Fatal("ERROR: rotation", bits, err)
+		}
+		rotations := []quantize.Quaternion{{0, 0, 0, 1}, {0, 0, 0, -1}, {1, 0, 0, 0}, {0.5, 0.5, 0.5, 0.5}, {0, 0, 0, 0}}
+		for i := 0; i < 1000; i++ {
+			rotations = append(rotations, quantize.Quaternion{
+				float32(random.NormFloat64()), float32(random.NormFloat64()),
+				float32(random.NormFloat64()), float32(random.NormFloat64()),
+			})
+		}
+		p, err := rotation.Payload(rotations...)
+		if err != nil {
+			t.Fatal("ERROR: rotation payload", err)
+		}
+		decoded, err := rotation.Values(p)
+		if err != nil || len(decoded) != len(rotations) {
+			t.Fatal("ERROR: rotation values", err)
+		}
+		for i, q := range rotations {
+			q = quantize.Normalize(q)
+			// q and -q are the same rotation
+			dot := 0.0
+			for c := range q {
+				dot += float64(q[c]) * float64(decoded[i][c])
+			}
+			sign := float32(1)
+			if dot < 0 {
+				sign = -1
+			}
+			for c := range q {
+				if math.Abs(float64(sign*q[c]-decoded[i][c])) > float64(rotation.MaxError()) {
+					t.Fatal("ERROR: rotation error is too large", bits, q, decoded[i], rotation.MaxError())
+				}
+			}
+		}
+	}
+
+	rotation, _ := quantize.NewRotation(10)
+	data, err := rotation.Data(quantize.Quaternion{0, 0.7071068, 0, 0.7071068})
+	if err != nil {
+		t.Fatal("ERROR: rotation data", err)
+	}
+	q, err := rotation.FromData(data)
+	if err != nil || math.Abs(float64(q[1]-0.7071068)) > float64(rotation.MaxError()) {
+		t.Log("ERROR: rotation data mismatch", q, err)
+		t.Fail()
+	}
+	if _, err := quantize.NewRotation(0); !errors.Is(err, quantize.ErrInvalidBits) {
+		t.Log("ERROR: rotation without bits is accepted", err)
+		t.Fail()
+	}
+}
+
+func TestQuantizeMalformedPayload(t *testing.T) {
+	s, _ := quantize.NewScalar(0, 1, 0.01)
+	p, _ := s.Payload(0.1, 0.2, 0.3)
+	payloads := []*frame.Payload{
+		frame.BytesPayload(nil),
+		frame.BytesPayload(p.Value[:len(p.Value)-1]),
+		frame.BytesPayload(append(append([]byte(nil), p.Value...), 0)),
+		frame.BytesPayload([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}),
+		frame.StringPayload("abc"),
+	}
+	for i, payload := range payloads {
+		if _, err := s.Values(payload); err == nil {
+			t.Log("ERROR: malformed payload is accepted", i)
+			t.Fail()
+		}
+	}
+
+	// quantized payloads travel in typed events
+	packet := frame.CreatePack(1, 2, frame.Events.Data)
+	packet.Events = append(packet.Events, &frame.Event{ID: frame.Events.Data, Payload: p})
+	encoded, err := frame.Encode(packet)
+	if err != nil {
+		t.Fatal("ERROR: encode", err)
+	}
+	decoded, err := frame.Decode(encoded)
+	if err != nil {
+		t.Fatal("ERROR: decode", err)
+	}
+	values, err := s.Values(decoded.Events[1].Payload)
+	if err != nil || len(values) != 3 || math.Abs(float64(values[1]-0.2)) > float64(s.MaxError()) {
+		t.Log("ERROR: quantized event mismatch", values, err)
+		t.Fail()
+	}
+}
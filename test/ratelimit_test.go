@@ -0,0 +1,63 @@
+package test
+
+import (
+	"gameserver/utils"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := utils.NewRateLimiter[string](10, 5)
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow("a", now) {
+			t.Fatal("ERROR: burst is not allowed", i)
+		}
+	}
+	if limiter.Allow("a", now) {
+		t.Log("ERROR: request over the burst is allowed")
+		t.Fail()
+	}
+	if !limiter.Allow("b", now) {
+		t.Log("ERROR: buckets are shared between keys")
+		t.Fail()
+	}
+
+	// 10 tokens per second refill a token every 100ms
+	if limiter.Allow("a", now.Add(50*time.Millisecond)) {
+		t.Log("ERROR: bucket refilled too early")
+		t.Fail()
+	}
+	if !limiter.Allow("a", now.Add(100*time.Millisecond)) {
+		t.Log("ERROR: bucket is not refilled")
+		t.Fail()
+	}
+	if limiter.AllowN("a", 3, now.Add(200*time.Millisecond)) || !limiter.AllowN("a", 1, now.Add(200*time.Millisecond)) {
+		t.Log("ERROR: tokens are taken when there are not enough")
+		t.Fail()
+	}
+	if limiter.AllowN("a", 6, now.Add(time.Hour)) || !limiter.AllowN("a", 5, now.Add(time.Hour)) {
+		t.Log("ERROR: bucket is not limited to the burst")
+		t.Fail()
+	}
+
+	// refilled buckets are forgotten
+	limiter.Allow("b", now.Add(time.Hour))
+	limiter.Allow("c", now.Add(2*time.Hour))
+	if limiter.Len() != 1 {
+		t.Log("ERROR: idle buckets are kept", limiter.Len())
+		t.Fail()
+	}
+	limiter.Forget("c")
+	if limiter.Len() != 0 {
+		t.Log("ERROR: forgotten bucket is kept", limiter.Len())
+		t.Fail()
+	}
+
+	unlimited := utils.NewRateLimiter[uint16](0, 0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.Allow(1, now) {
+			t.Fatal("ERROR: zero rate is limited")
+		}
+	}
+}
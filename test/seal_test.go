@@ -0,0 +1,107 @@
+package test
+
+import (
+	"bytes"
+	"gameserver/frame"
+	"testing"
+)
+
+func sessionCiphers(t *testing.T) (*frame.Cipher, *frame.Cipher) {
+	clientKeys, err := frame.NewKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKeys, err := frame.NewKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := clientKeys.SessionKey(serverKeys.Public, 3, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKey, err := serverKeys.SessionKey(clientKeys.Public, 3, 7)
+	if err != nil || !bytes.Equal(clientKey, serverKey) {
+		t.Fatal("ERROR: key exchange mismatch", err)
+	}
+	client, _ := frame.NewCipher(clientKey, 3, 7, frame.ClientToServer)
+	server, _ := frame.NewCipher(serverKey, 3, 7, frame.ServerToClient)
+	return client, server
+}
+
+func TestSealOpen(t *testing.T) {
+	client, server := sessionCiphers(t)
+	pack := frame.Marshal(frame.CreatePack(3, 7, frame.Events.Register))
+
+	sealed := client.Seal(pack)
+	if !frame.IsSealed(sealed) || bytes.Contains(sealed, pack[frame.VersionHeaderSize:]) {
+		t.Fatal("ERROR: frame is not sealed")
+	}
+	if _, err := frame.Decode(sealed); err != frame.ErrSealed {
+		t.Log("ERROR: sealed frame decoded without key", err)
+		t.Fail()
+	}
+	gameID, clientID, err := frame.SealedIDs(sealed)
+	if err != nil || gameID != 3 || clientID != 7 {
+		t.Log("ERROR: sealed IDs mismatch", gameID, clientID, err)
+		t.Fail()
+	}
+
+	opened, err := server.Open(sealed)
+	if err != nil || !bytes.Equal(opened, pack) {
+		t.Fatal("ERROR: sealed frame can not be opened", err)
+	}
+	if _, err = server.Open(sealed); err != frame.ErrReplay {
+		t.Log("ERROR: replayed frame accepted", err)
+		t.Fail()
+	}
+
+	// a frame sealed by the server is not accepted back by the server
+	server.Seal(pack)
+	if _, err = server.Open(server.Seal(pack)); err != frame.ErrAuthFailed {
+		t.Log("ERROR: reflected frame accepted", err)
+		t.Fail()
+	}
+
+	tampered := client.Seal(pack)
+	tampered[len(tampered)-20] ^= 1
+	if _, err = server.Open(tampered); err != frame.ErrAuthFailed {
+		t.Log("ERROR: tampered frame accepted", err)
+		t.Fail()
+	}
+
+	// IDs are authenticated, another client can not be claimed
+	forged := client.Seal(pack)
+	forged[frame.VersionHeaderSize] = 8
+	if _, err = server.Open(forged); err != frame.ErrSealedSession {
+		t.Log("ERROR: forged client ID accepted", err)
+		t.Fail()
+	}
+}
+
+func TestSealReorder(t *testing.T) {
+	client, server := sessionCiphers(t)
+	pack := frame.Marshal(frame.CreatePack(3, 7, frame.Events.Data))
+
+	sealed := make([][]byte, 100)
+	for i := range sealed {
+		sealed[i] = client.Seal(pack)
+	}
+	// late frames are accepted once while they are in the replay window
+	order := []int{1, 0, 5, 3, 2, 4, 80, 70, 20}
+	for _, i := range order {
+		if _, err := server.Open(sealed[i]); err != nil {
+			t.Log("ERROR: reordered frame rejected", i, err)
+			t.Fail()
+		}
+	}
+	for _, i := range order {
+		if _, err := server.Open(sealed[i]); err != frame.ErrReplay {
+			t.Log("ERROR: replayed frame accepted", i, err)
+			t.Fail()
+		}
+	}
+	if _, err := server.Open(sealed[6]); err != frame.ErrReplay {
+		t.Log("ERROR: frame older than replay window accepted", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,186 @@
+package test
+
+import (
+	"errors"
+	"gameserver/config"
+	"gameserver/frame"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSequencer(t *testing.T) {
+	local := frame.NewSequencer()
+	remote := frame.NewSequencer()
+
+	// local sends 100 packets, every 10th one is lost on the way.
+	// remote answers every packet it receives
+	for i := 0; i < 100; i++ {
+		p := frame.CreatePack(1, 1, frame.Events.Data)
+		local.Stamp(p)
+		newPacket, err := frame.Decode(frame.Marshal(p))
+		if err != nil || newPacket.Seq != p.Seq || newPacket.AckBits != p.AckBits {
+			t.Log("ERROR: sequence section mismatch", err)
+			t.FailNow()
+		}
+		if i%10 == 0 {
+			continue
+		}
+		if !remote.Receive(newPacket) {
+			t.Log("ERROR: packet taken as duplicate", newPacket.Seq)
+			t.Fail()
+		}
+		if remote.Receive(newPacket) {
+			t.Log("ERROR: duplicate packet accepted", newPacket.Seq)
+			t.Fail()
+		}
+		answer := frame.CreatePack(1, 2, frame.Events.Data)
+		remote.Stamp(answer)
+		local.Receive(answer)
+	}
+
+	stats := local.Stats()
+	// lost packets inside the last ack window (71, 81, 91) are not resolved yet
+	if stats.Sent != 100 || stats.Acked != 90 || stats.Lost != 7 {
+		t.Logf("ERROR: unexpected stats %+v", stats)
+		t.Fail()
+	}
+	if remote.Stats().Duplicates != 90 {
+		t.Logf("ERROR: unexpected duplicate count %+v", remote.Stats())
+		t.Fail()
+	}
+}
+
+func TestConnectionReliableOrdered(t *testing.T) {
+	sender := frame.NewConnection()
+	receiver := frame.NewConnection()
+
+	// 5 ordered messages, first two are lost on the way
+	sent := make([][]byte, 0, 5)
+	for i := 0; i < 5; i++ {
+		p := frame.CreatePack(1, 1, frame.Events.Data)
+		p.Events[0].Data = int32(i)
+		p.Delivery = frame.ReliableOrdered
+		sender.Send(p)
+		sent = append(sent, frame.Marshal(p))
+	}
+	for _, packet := range sent[2:] {
+		p, _ := frame.Decode(packet)
+		delivered, err := receiver.Receive(p)
+		if err != nil || len(delivered) != 0 {
+			t.Log("ERROR: out of order message delivered early", err)
+			t.Fail()
+		}
+	}
+
+	// receiver acks, sender resends only the lost ones
+	ack := frame.CreatePack(1, 2, frame.Events.Ack)
+	receiver.Send(ack)
+	sender.Receive(ack)
+	resend, err := sender.Resend(time.Now().Add(time.Second))
+	if err != nil || len(resend) != 2 {
+		t.Log("ERROR: expected 2 retransmissions, got", len(resend))
+		t.FailNow()
+	}
+
+	order := make([]int32, 0, 5)
+	for _, p := range []*frame.Packet{resend[0], resend[1], resend[0]} {
+		p, _ = frame.Decode(frame.Marshal(p))
+		delivered, err := receiver.Receive(p)
+		if err != nil {
+			continue
+		}
+		for _, d := range delivered {
+			order = append(order, d.Events[0].Data)
+		}
+	}
+	if !reflect.DeepEqual(order, []int32{0, 1, 2, 3, 4}) {
+		t.Log("ERROR: ordered messages delivered out of order", order)
+		t.Fail()
+	}
+}
+
+func TestConnectionOrderedOverrun(t *testing.T) {
+	sender := frame.NewConnection()
+	receiver := frame.NewConnection()
+
+	// first message is lost and the rest fills the buffer of out of order messages
+	count := 258
+	sent := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		p := frame.CreatePack(1, 1, frame.Events.Data)
+		p.Events[0].Data = int32(i)
+		p.Delivery = frame.ReliableOrdered
+		sender.Send(p)
+		sent = append(sent, frame.Marshal(p))
+	}
+	var overrun error
+	for _, packet := range sent[1:] {
+		p, _ := frame.Decode(packet)
+		_, err := receiver.Receive(p)
+		if err != nil {
+			overrun = err
+		}
+		ack := frame.CreatePack(1, 2, frame.Events.Ack)
+		receiver.Send(ack)
+		sender.Receive(ack)
+	}
+	if !errors.Is(overrun, frame.ErrOrderedOverrun) {
+		t.Fatal("ERROR: ordered buffer is not limited", overrun)
+	}
+
+	// the overrun message is not acked, it is resent with the lost one
+	resend, err := sender.Resend(time.Now().Add(time.Second))
+	if err != nil || len(resend) != 2 {
+		t.Fatal("ERROR: expected 2 retransmissions, got", len(resend), err)
+	}
+	// the lost message arrives first and releases the buffer
+	sort.Slice(resend, func(i, j int) bool { return resend[i].MessageID < resend[j].MessageID })
+	delivered := 0
+	for _, p := range resend {
+		p, _ = frame.Decode(frame.Marshal(p))
+		packets, err := receiver.Receive(p)
+		if err != nil {
+			t.Fatal("ERROR: resent message is rejected", err)
+		}
+		for _, d := range packets {
+			if d.Events[0].Data != int32(delivered) {
+				t.Fatal("ERROR: ordered messages delivered out of order", d.Events[0].Data)
+			}
+			delivered++
+		}
+	}
+	if delivered != count {
+		t.Log("ERROR: ordered stream is stalled, delivered", delivered)
+		t.Fail()
+	}
+}
+
+func TestConnectionGiveUp(t *testing.T) {
+	c := frame.NewConnection()
+	p := frame.CreatePack(1, 1, frame.Events.Data)
+	p.Delivery = frame.ReliableOrdered
+	c.Send(p)
+
+	now := time.Now()
+	for i := 1; i < config.MaxResendAttempt; i++ {
+		now = now.Add(2 * time.Second)
+		resend, err := c.Resend(now)
+		if err != nil || len(resend) != 1 {
+			t.Fatal("ERROR: message is not resent", i, err)
+		}
+	}
+	// the peer would wait for the message forever, the connection is given up
+	for i := 0; i < 2; i++ {
+		now = now.Add(2 * time.Second)
+		resend, err := c.Resend(now)
+		if !errors.Is(err, frame.ErrDeliveryFailed) || len(resend) != 0 {
+			t.Fatal("ERROR: connection is not given up", err)
+		}
+	}
+	if c.Stats().Failed != 1 {
+		t.Log("ERROR: failed message is not counted", c.Stats().Failed)
+		t.Fail()
+	}
+}
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"gameserver/frame"
+	"gameserver/snapshot"
+	"testing"
+)
+
+func TestSnapshotDelta(t *testing.T) {
+	base := snapshot.State{
+		1: {1, 2, 3},
+		2: {4, 5, 6},
+		3: {7, 8, 9},
+	}
+	state := base.Clone()
+	state[1][1] = 20
+	delete(state, 3)
+	state[4] = []float32{10, 11}
+
+	full := snapshot.AppendDelta(nil, 1, 0, nil, state)
+	delta := snapshot.AppendDelta(nil, 2, 1, base, state)
+	if len(delta) >= len(full) {
+		t.Log("ERROR: delta is not smaller than full snapshot", len(delta), len(full))
+		t.Fail()
+	}
+
+	applied, err := snapshot.ApplyDelta(delta, base)
+	if err != nil || !applied.Equal(state) {
+		t.Fatal("ERROR: delta reconstruction mismatch", applied, err)
+	}
+	if base[1][1] != 2 || len(base) != 3 {
+		t.Log("ERROR: baseline changed", base)
+		t.Fail()
+	}
+	applied, err = snapshot.ApplyDelta(full, nil)
+	if err != nil || !applied.Equal(state) {
+		t.Log("ERROR: full snapshot mismatch", applied, err)
+		t.Fail()
+	}
+
+	// unchanged state writes no entities
+	unchanged := snapshot.AppendDelta(nil, 3, 2, state, state)
+	if len(unchanged) != snapshot.DeltaHeaderSize+1 {
+		t.Log("ERROR: unchanged state size mismatch", len(unchanged))
+		t.Fail()
+	}
+}
+
+func TestSnapshotMalformedDelta(t *testing.T) {
+	base := snapshot.State{1: {1, 2, 3}}
+	state := snapshot.State{1: {1, 5, 3}}
+	delta := snapshot.AppendDelta(nil, 2, 1, base, state)
+
+	for i := 0; i < len(delta); i++ {
+		if _, err := snapshot.ApplyDelta(delta[:i], base); err != snapshot.ErrInvalidDelta {
+			t.Log("ERROR: truncated delta accepted", i, err)
+			t.Fail()
+		}
+	}
+	if _, err := snapshot.ApplyDelta(append(delta, 0), base); err != snapshot.ErrInvalidDelta {
+		t.Log("ERROR: trailing bytes accepted", err)
+		t.Fail()
+	}
+	// changed entity needs a baseline with the same fields
+	if _, err := snapshot.ApplyDelta(delta, snapshot.State{1: {1, 2}}); err != snapshot.ErrInvalidDelta {
+		t.Log("ERROR: delta applied on wrong baseline", err)
+		t.Fail()
+	}
+}
+
+func TestSnapshotSenderReceiver(t *testing.T) {
+	sender := snapshot.NewSender(4)
+	receiver := snapshot.NewReceiver(4)
+	world := snapshot.NewWorld()
+
+	world.Set(1, []float32{1, 2, 3})
+	tick, state := world.Snapshot()
+	first := sender.Delta(tick, state)
+	if _, baseTick, _ := snapshot.DeltaTicks(first); baseTick != 0 {
+		t.Fatal("ERROR: first snapshot is not full", baseTick)
+	}
+	received, applied, err := receiver.Apply(first)
+	if err != nil || received != tick || !applied.Equal(state) {
+		t.Fatal("ERROR: full snapshot mismatch", received, applied, err)
+	}
+
+	// unknown and older acks do not move the baseline
+	sender.Ack(tick + 10)
+	if sender.Baseline() != 0 {
+		t.Fatal("ERROR: unknown ack moved baseline", sender.Baseline())
+	}
+	sender.Ack(tick)
+	if sender.Baseline() != tick {
+		t.Fatal("ERROR: ack did not move baseline", sender.Baseline())
+	}
+
+	world.Set(1, []float32{1, 5, 3})
+	world.Set(2, []float32{4})
+	tick, state = world.Snapshot()
+	second := sender.Delta(tick, state)
+	if _, baseTick, _ := snapshot.DeltaTicks(second); baseTick != 1 {
+		t.Fatal("ERROR: delta is not based on acked snapshot", baseTick)
+	}
+	if len(second) >= len(snapshot.AppendDelta(nil, tick, 0, nil, state)) {
+		t.Log("ERROR: delta is not smaller than full snapshot", len(second))
+		t.Fail()
+	}
+	received, applied, err = receiver.Apply(second)
+	if err != nil || received != tick || !applied.Equal(state) {
+		t.Fatal("ERROR: delta snapshot mismatch", received, applied, err)
+	}
+	sender.Ack(tick)
+	sender.Ack(1)
+	if sender.Baseline() != tick {
+		t.Log("ERROR: older ack moved baseline back", sender.Baseline())
+		t.Fail()
+	}
+
+	if _, _, err = receiver.Apply(second); err != snapshot.ErrStaleSnapshot {
+		t.Log("ERROR: stale snapshot applied", err)
+		t.Fail()
+	}
+	unknown := snapshot.AppendDelta(nil, 10, 9, state, state)
+	if _, _, err = receiver.Apply(unknown); err != snapshot.ErrUnknownBaseline {
+		t.Log("ERROR: delta on unknown baseline applied", err)
+		t.Fail()
+	}
+	if latest, _ := receiver.Latest(); latest != tick {
+		t.Log("ERROR: latest tick mismatch", latest)
+		t.Fail()
+	}
+}
+
+func TestSnapshotLostAcks(t *testing.T) {
+	historySize := 32
+	sender := snapshot.NewSender(historySize)
+	receiver := snapshot.NewReceiver(historySize)
+	world := snapshot.NewWorld()
+
+	world.Set(1, []float32{0})
+	tick, state := world.Snapshot()
+	receiver.Apply(sender.Delta(tick, state))
+	sender.Ack(tick)
+
+	// acks of the next ticks are lost, the client forgets the baseline
+	// and the sender falls back to full snapshots
+	for i := 1; i <= 2*historySize; i++ {
+		world.Set(1, []float32{float32(i)})
+		tick, state = world.Snapshot()
+		data := sender.Delta(tick, state)
+		_, applied, err := receiver.Apply(data)
+		if err != nil || !applied.Equal(state) {
+			t.Fatal("ERROR: snapshot is not applied after lost acks", tick, err)
+		}
+		_, baseTick, _ := snapshot.DeltaTicks(data)
+		if tick-sender.Baseline() >= uint32(historySize) && baseTick != 0 {
+			t.Fatal("ERROR: delta against a forgotten baseline", tick, baseTick)
+		}
+	}
+
+	// an ack gets through and deltas are based on it again
+	sender.Ack(tick)
+	world.Set(1, []float32{-1})
+	tick, state = world.Snapshot()
+	data := sender.Delta(tick, state)
+	if _, baseTick, _ := snapshot.DeltaTicks(data); baseTick != tick-1 {
+		t.Log("ERROR: delta is not based on the new ack", baseTick)
+		t.Fail()
+	}
+	if _, applied, err := receiver.Apply(data); err != nil || !applied.Equal(state) {
+		t.Log("ERROR: delta after recovery is not applied", err)
+		t.Fail()
+	}
+
+	// legacy events with the snapshot ID carry no snapshot
+	legacy := &frame.Event{ID: frame.Events.Snapshot}
+	if err := frame.DefaultRegistry.Check(legacy, frame.ServerToClient); err != frame.ErrEventSchema {
+		t.Log("ERROR: snapshot without payload is accepted", err)
+		t.Fail()
+	}
+}
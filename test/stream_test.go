@@ -0,0 +1,91 @@
+package test
+
+import (
+	"bytes"
+	"gameserver/frame"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	sent := []*frame.Packet{
+		frame.CreatePack(1, 2, frame.Events.Register),
+		frame.CreateEventPacket(1, frame.Events.Start, 0),
+	}
+	sent[1].Events = append(sent[1].Events, &frame.Event{ID: frame.Events.Data, Payload: frame.StringPayload("hello")})
+	sent[1].Flags = frame.FlagChecksum
+	go func() {
+		w := frame.NewStreamWriter(client)
+		for _, p := range sent {
+			if err := w.WritePacket(p); err != nil {
+				t.Error("ERROR: stream write failed", err)
+			}
+		}
+		client.Close()
+	}()
+
+	r := frame.NewStreamReader(server)
+	for i, expected := range sent {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatal("ERROR: stream read failed", i, err)
+		}
+		if p.ClientID != expected.ClientID || len(p.Events) != len(expected.Events) || p.Events[0].ID != expected.Events[0].ID {
+			t.Log("ERROR: stream packet mismatch", i, p)
+			t.Fail()
+		}
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Log("ERROR: end of stream mismatch", err)
+		t.Fail()
+	}
+}
+
+func TestStreamMalformed(t *testing.T) {
+	var stream bytes.Buffer
+	w := frame.NewStreamWriter(&stream)
+	if err := w.WritePacket(frame.CreatePack(1, 2, frame.Events.Data)); err != nil {
+		t.Fatal("ERROR: stream write failed", err)
+	}
+	if err := w.WriteFrame(nil); err != frame.ErrInvalidStream {
+		t.Log("ERROR: empty frame written", err)
+		t.Fail()
+	}
+	encoded := stream.Bytes()
+
+	truncated := frame.NewStreamReader(bytes.NewReader(encoded[:len(encoded)-1]))
+	if _, err := truncated.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Log("ERROR: truncated frame mismatch", err)
+		t.Fail()
+	}
+
+	oversize := frame.NewStreamReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0x7f}))
+	if _, err := oversize.ReadFrame(); err != frame.ErrInvalidStream {
+		t.Log("ERROR: oversize frame accepted", err)
+		t.Fail()
+	}
+	empty := frame.NewStreamReader(bytes.NewReader([]byte{0, 0, 0, 0}))
+	if _, err := empty.ReadFrame(); err != frame.ErrInvalidStream {
+		t.Log("ERROR: empty frame accepted", err)
+		t.Fail()
+	}
+
+	// a frame that can not be decoded does not break the stream
+	var mixed bytes.Buffer
+	w = frame.NewStreamWriter(&mixed)
+	w.WriteFrame([]byte{1, 2, 3})
+	w.WritePacket(frame.CreatePack(1, 3, frame.Events.Data))
+	r := frame.NewStreamReader(&mixed)
+	if _, err := r.ReadPacket(); err == nil {
+		t.Log("ERROR: malformed frame decoded")
+		t.Fail()
+	}
+	if p, err := r.ReadPacket(); err != nil || p.ClientID != 3 {
+		t.Log("ERROR: frame after a malformed one mismatch", p, err)
+		t.Fail()
+	}
+}
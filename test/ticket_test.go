@@ -0,0 +1,51 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"gameserver/frame"
+	"testing"
+)
+
+func TestSessionTicket(t *testing.T) {
+	ticket, err := frame.NewSessionTicket()
+	if err != nil || len(ticket) != frame.SessionTicketSize {
+		t.Fatal("ERROR: session ticket", ticket, err)
+	}
+	other, _ := frame.NewSessionTicket()
+	if bytes.Equal(ticket, other) {
+		t.Log("ERROR: session tickets repeat")
+		t.Fail()
+	}
+
+	registry := frame.NewRegistry(false)
+	register := frame.CreateRegisterPack(1, 2, ticket)
+	if err := registry.CheckPacket(register, frame.ClientToServer); err != nil {
+		t.Fatal("ERROR: register with ticket is rejected", err)
+	}
+	encoded, err := frame.Encode(register)
+	if err != nil {
+		t.Fatal("ERROR: encode", err)
+	}
+	decoded, err := frame.Decode(encoded)
+	if err != nil || !bytes.Equal(frame.SessionTicket(decoded), ticket) {
+		t.Fatal("ERROR: ticket mismatch", err)
+	}
+
+	// legacy register carries no ticket
+	legacy := frame.CreateRegisterPack(1, 2, nil)
+	legacy.Version = frame.Version0
+	if err := registry.CheckPacket(legacy, frame.ClientToServer); err != nil || frame.SessionTicket(legacy) != nil {
+		t.Log("ERROR: register without ticket mismatch", err)
+		t.Fail()
+	}
+
+	for _, malformed := range []*frame.Payload{frame.BytesPayload(ticket[:8]), frame.StringPayload(string(ticket))} {
+		p := frame.CreateRegisterPack(1, 2, nil)
+		p.Events[0].Payload = malformed
+		if err := registry.CheckPacket(p, frame.ClientToServer); !errors.Is(err, frame.ErrEventValidation) {
+			t.Log("ERROR: malformed ticket is accepted", malformed.Type, err)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"errors"
+	"gameserver/utils"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+	keyring := utils.NewKeyring()
+	if err := keyring.Add(1, []byte("short")); !errors.Is(err, utils.ErrShortKey) {
+		t.Log("ERROR: short key is accepted", err)
+		t.Fail()
+	}
+	keyring.Add(1, []byte("first token key of the test"))
+	if err := keyring.Use(2); !errors.Is(err, utils.ErrUnknownKey) {
+		t.Log("ERROR: unknown signing key is accepted", err)
+		t.Fail()
+	}
+	keyring.Use(1)
+
+	now := time.Unix(1700000000, 0)
+	claims := &utils.Claims{PlayerID: 42, IssuedAt: now, ExpiresAt: now.Add(time.Hour), Modes: 1<<0 | 1<<3}
+	token, err := keyring.Sign(claims)
+	if err != nil || len(token) != utils.TokenSize {
+		t.Fatal("ERROR: sign", len(token), err)
+	}
+	verified, err := keyring.Verify(token, now.Add(time.Minute))
+	if err != nil || verified.PlayerID != 42 || verified.KeyID != 1 || !verified.ExpiresAt.Equal(claims.ExpiresAt) {
+		t.Fatal("ERROR: verify", verified, err)
+	}
+	if !verified.Allows(0) || !verified.Allows(3) || verified.Allows(1) || verified.Allows(40) {
+		t.Log("ERROR: modes mismatch", verified.Modes)
+		t.Fail()
+	}
+
+	tampered := append([]byte(nil), token...)
+	tampered[1] ^= 1
+	tests := []struct {
+		name  string
+		token []byte
+		now   time.Time
+		err   error
+	}{
+		{"expired", token, now.Add(time.Hour), utils.ErrTokenExpired},
+		{"not yet valid", token, now.Add(-time.Hour), utils.ErrTokenNotYet},
+		{"tampered", tampered, now, utils.ErrTokenSignature},
+		{"short", token[:utils.TokenSize-1], now, utils.ErrInvalidToken},
+	}
+	for _, test := range tests {
+		if _, err := keyring.Verify(test.token, test.now); !errors.Is(err, test.err) {
+			t.Log("ERROR: token is not rejected", test.name, err)
+			t.Fail()
+		}
+	}
+
+	// rotation: new tokens are signed with the new key, old tokens verify until the old key is removed
+	keyring.Add(2, []byte("second token key of the test"))
+	keyring.Use(2)
+	rotated, _ := keyring.Sign(claims)
+	if rotated[0] != 2 {
+		t.Log("ERROR: token is not signed with the new key", rotated[0])
+		t.Fail()
+	}
+	for _, tok := range [][]byte{token, rotated} {
+		if _, err := keyring.Verify(tok, now); err != nil {
+			t.Log("ERROR: token of an active key is rejected", tok[0], err)
+			t.Fail()
+		}
+	}
+	keyring.Remove(1)
+	if _, err := keyring.Verify(token, now); !errors.Is(err, utils.ErrUnknownKey) {
+		t.Log("ERROR: token of a removed key is accepted", err)
+		t.Fail()
+	}
+
+	// a token signed by another issuer with the same key ID
+	other := utils.NewKeyring()
+	other.Add(2, []byte("key of another token issuer"))
+	other.Use(2)
+	forged, _ := other.Sign(claims)
+	if _, err := keyring.Verify(forged, now); !errors.Is(err, utils.ErrTokenSignature) {
+		t.Log("ERROR: forged token is accepted", err)
+		t.Fail()
+	}
+}
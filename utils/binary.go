@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"reflect"
+)
+
+// Little endian codec of fixed width values.
+// values have the same encoding on every host, whatever its byte order and word size is.
+// platform sized int, uint and uintptr are not fixed width and are not supported
+
+var (
+	ErrShortInput      error = errors.New("utils: input is shorter than the value")
+	ErrUnsupportedType error = errors.New("utils: unsupported type")
+)
+
+// Number is a fixed width number, types defined on them are included
+type Number interface {
+	~int8 | ~int16 | ~int32 | ~int64 |
+		~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// typeOf does not allocate unlike reflect.TypeOf of a value
+func typeOf[T Number]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// SizeOf is the encoded size of T in bytes
+func SizeOf[T Number]() int {
+	// built-in types are switched without reflection, it is the hot path
+	var zero T
+	switch any(zero).(type) {
+	case int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int64, uint64, float64:
+		return 8
+	}
+	return int(typeOf[T]().Size())
+}
+
+// isFloat reports whether T is float32 or float64 or a type defined on them
+func isFloat[T Number]() (is32, is64 bool) {
+	var zero T
+	switch any(zero).(type) {
+	case float32:
+		return true, false
+	case float64:
+		return false, true
+	case int8, uint8, int16, uint16, int32, uint32, int64, uint64:
+		return false, false
+	}
+	kind := typeOf[T]().Kind()
+	return kind == reflect.Float32, kind == reflect.Float64
+}
+
+// bitsOf returns the bits of v, floats by their IEEE 754 representation
+func bitsOf[T Number](v T) uint64 {
+	switch is32, is64 := isFloat[T](); {
+	case is32:
+		return uint64(math.Float32bits(float32(v)))
+	case is64:
+		return math.Float64bits(float64(v))
+	}
+	// signed values are sign extended, only the low bytes are written
+	return uint64(v)
+}
+
+// AppendLE appends v to dst in little endian order
+func AppendLE[T Number](dst []byte, v T) []byte {
+	bits := bitsOf(v)
+	size := SizeOf[T]()
+	for i := 0; i < size; i++ {
+		dst = append(dst, uint8(bits>>(8*i)))
+	}
+	return dst
+}
+
+// PutLE writes v to the beginning of dst in little endian order
+func PutLE[T Number](dst []byte, v T) error {
+	size := SizeOf[T]()
+	if len(dst) < size {
+		return ErrShortInput
+	}
+	bits := bitsOf(v)
+	for i := 0; i < size; i++ {
+		dst[i] = uint8(bits >> (8 * i))
+	}
+	return nil
+}
+
+// ReadLE reads a little endian value from the beginning of src
+func ReadLE[T Number](src []byte) (T, error) {
+	size := SizeOf[T]()
+	if len(src) < size {
+		return 0, ErrShortInput
+	}
+	bits := readBits(src, size)
+	switch is32, is64 := isFloat[T](); {
+	case is32:
+		return T(math.Float32frombits(uint32(bits))), nil
+	case is64:
+		return T(math.Float64frombits(bits)), nil
+	}
+	// conversion truncates to the size of T, signed values get their sign back
+	return T(bits), nil
+}
+
+// readBits reads size little endian bytes of src which is long enough
+func readBits(src []byte, size int) uint64 {
+	var bits uint64
+	for i := size - 1; i >= 0; i-- {
+		bits = bits<<8 | uint64(src[i])
+	}
+	return bits
+}
+
+// AppendBool appends v as a single byte, 1 for true
+func AppendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// ReadBool reads a byte written by AppendBool, other values than 0 and 1 are invalid
+func ReadBool(src []byte) (bool, error) {
+	if len(src) < 1 {
+		return false, ErrShortInput
+	}
+	if src[0] > 1 {
+		return false, ErrUnsupportedType
+	}
+	return src[0] == 1, nil
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"math"
+	"reflect"
+)
+
+// Structs are encoded field by field in declaration order with the little endian codec.
+// fields can be fixed width numbers, bools, arrays and structs of them.
+// unexported fields and fields tagged `le:"-"` are skipped
+//
+//	type Section struct {
+//		ID    uint16
+//		Count uint8
+//		Data  []byte `le:"-"`
+//	}
+
+const structTag string = "le"
+
+// SizeOfStruct is the encoded size of a struct or a pointer to struct
+func SizeOfStruct(v interface{}) (int, error) {
+	return sizeOfValue(reflect.Indirect(reflect.ValueOf(v)).Type())
+}
+
+func sizeOfValue(t reflect.Type) (int, error) {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1, nil
+	case reflect.Int16, reflect.Uint16:
+		return 2, nil
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4, nil
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		return 8, nil
+	case reflect.Array:
+		size, err := sizeOfValue(t.Elem())
+		return size * t.Len(), err
+	case reflect.Struct:
+		total := 0
+		for i := 0; i < t.NumField(); i++ {
+			if skipField(t.Field(i)) {
+				continue
+			}
+			size, err := sizeOfValue(t.Field(i).Type)
+			if err != nil {
+				return 0, err
+			}
+			total += size
+		}
+		return total, nil
+	}
+	return 0, ErrUnsupportedType
+}
+
+func skipField(f reflect.StructField) bool {
+	return f.PkgPath != "" || f.Tag.Get(structTag) == "-"
+}
+
+// AppendStruct appends the fields of a struct or a pointer to struct to dst
+func AppendStruct(dst []byte, v interface{}) ([]byte, error) {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return dst, ErrUnsupportedType
+	}
+	out, err := appendValue(dst, value)
+	if err != nil {
+		return dst, err
+	}
+	return out, nil
+}
+
+func appendValue(dst []byte, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return AppendBool(dst, v.Bool()), nil
+	case reflect.Int8:
+		return AppendLE(dst, int8(v.Int())), nil
+	case reflect.Int16:
+		return AppendLE(dst, int16(v.Int())), nil
+	case reflect.Int32:
+		return AppendLE(dst, int32(v.Int())), nil
+	case reflect.Int64:
+		return AppendLE(dst, v.Int()), nil
+	case reflect.Uint8:
+		return AppendLE(dst, uint8(v.Uint())), nil
+	case reflect.Uint16:
+		return AppendLE(dst, uint16(v.Uint())), nil
+	case reflect.Uint32:
+		return AppendLE(dst, uint32(v.Uint())), nil
+	case reflect.Uint64:
+		return AppendLE(dst, v.Uint()), nil
+	case reflect.Float32:
+		return AppendLE(dst, float32(v.Float())), nil
+	case reflect.Float64:
+		return AppendLE(dst, v.Float()), nil
+	case reflect.Array:
+		var err error
+		for i := 0; i < v.Len() && err == nil; i++ {
+			dst, err = appendValue(dst, v.Index(i))
+		}
+		return dst, err
+	case reflect.Struct:
+		var err error
+		for i := 0; i < v.NumField() && err == nil; i++ {
+			if !skipField(v.Type().Field(i)) {
+				dst, err = appendValue(dst, v.Field(i))
+			}
+		}
+		return dst, err
+	}
+	return dst, ErrUnsupportedType
+}
+
+// ReadStruct fills the fields of the struct v points to from src.
+// returns the number of bytes read, v is left as it is when src is short
+func ReadStruct(src []byte, v interface{}) (int, error) {
+	pointer := reflect.ValueOf(v)
+	if pointer.Kind() != reflect.Ptr || pointer.Elem().Kind() != reflect.Struct {
+		return 0, ErrUnsupportedType
+	}
+	size, err := sizeOfValue(pointer.Elem().Type())
+	if err != nil {
+		return 0, err
+	}
+	if len(src) < size {
+		return 0, ErrShortInput
+	}
+	// decoded into a copy so a failure does not leave v half written
+	value := reflect.New(pointer.Elem().Type()).Elem()
+	value.Set(pointer.Elem())
+	_, err = readValue(src, value)
+	if err != nil {
+		return 0, err
+	}
+	pointer.Elem().Set(value)
+	return size, nil
+}
+
+// readValue decodes v from src which is long enough, returns the rest of src
+func readValue(src []byte, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := ReadBool(src)
+		v.SetBool(b)
+		return src[1:], err
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size := int(v.Type().Size())
+		// sign of the value is in the top bit of its last byte
+		shift := 64 - 8*size
+		v.SetInt(int64(readBits(src, size)<<shift) >> shift)
+		return src[size:], nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size := int(v.Type().Size())
+		v.SetUint(readBits(src, size))
+		return src[size:], nil
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(readBits(src, 4)))))
+		return src[4:], nil
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(readBits(src, 8)))
+		return src[8:], nil
+	case reflect.Array:
+		var err error
+		for i := 0; i < v.Len() && err == nil; i++ {
+			src, err = readValue(src, v.Index(i))
+		}
+		return src, err
+	case reflect.Struct:
+		var err error
+		for i := 0; i < v.NumField() && err == nil; i++ {
+			if !skipField(v.Type().Field(i)) {
+				src, err = readValue(src, v.Field(i))
+			}
+		}
+		return src, err
+	}
+	return src, ErrUnsupportedType
+}
@@ -0,0 +1,191 @@
+package utils
+
+import "errors"
+
+var (
+	ErrShortBitStream error = errors.New("utils: bit stream is too short")
+	ErrVarintOverflow error = errors.New("utils: varint overflows 64 bits")
+)
+
+// maximum number of 7 bit groups of a 64 bit varint
+const maxVarintGroups int = 10
+
+// BitWriter packs values into bytes bit by bit, least significant bit first.
+// the last byte is padded with zero bits
+type BitWriter struct {
+	buffer []byte
+	bits   int
+}
+
+func NewBitWriter(capacity int) *BitWriter {
+	return &BitWriter{buffer: make([]byte, 0, capacity)}
+}
+
+// NewBitWriterTo returns a writer that appends to dst, bits of dst are counted by Len
+func NewBitWriterTo(dst []byte) *BitWriter {
+	return &BitWriter{buffer: dst, bits: 8 * len(dst)}
+}
+
+// WriteBits writes the lowest n bits of v, n is at most 64
+func (w *BitWriter) WriteBits(v uint64, n int) {
+	for n > 0 {
+		used := w.bits % 8
+		if used == 0 {
+			w.buffer = append(w.buffer, 0)
+		}
+		take := 8 - used
+		if take > n {
+			take = n
+		}
+		w.buffer[len(w.buffer)-1] |= uint8(v&(1<<uint(take)-1)) << uint(used)
+		v >>= uint(take)
+		n -= take
+		w.bits += take
+	}
+}
+
+func (w *BitWriter) WriteBool(v bool) {
+	if v {
+		w.WriteBits(1, 1)
+		return
+	}
+	w.WriteBits(0, 1)
+}
+
+// WriteUvarint writes v in 7 bit groups, each followed by a continuation bit
+func (w *BitWriter) WriteUvarint(v uint64) {
+	for v >= 1<<7 {
+		w.WriteBits(v|1<<7, 8)
+		v >>= 7
+	}
+	w.WriteBits(v, 8)
+}
+
+// WriteVarint writes v zig-zag encoded, small negative values stay small
+func (w *BitWriter) WriteVarint(v int64) {
+	w.WriteUvarint(ZigZag(v))
+}
+
+func (w *BitWriter) WriteBytes(b []byte) {
+	if w.bits%8 == 0 {
+		w.buffer = append(w.buffer, b...)
+		w.bits += 8 * len(b)
+		return
+	}
+	for _, c := range b {
+		w.WriteBits(uint64(c), 8)
+	}
+}
+
+// Bytes returns the written bytes, the writer keeps using the same buffer
+func (w *BitWriter) Bytes() []byte {
+	return w.buffer
+}
+
+// Len is the number of written bits
+func (w *BitWriter) Len() int {
+	return w.bits
+}
+
+func (w *BitWriter) Reset() {
+	w.buffer = w.buffer[:0]
+	w.bits = 0
+}
+
+// BitReader reads values written by BitWriter
+type BitReader struct {
+	buffer []byte
+	pos    int
+}
+
+func NewBitReader(b []byte) *BitReader {
+	return &BitReader{buffer: b}
+}
+
+// ReadBits reads n bits, n is at most 64
+func (r *BitReader) ReadBits(n int) (uint64, error) {
+	if n > r.Remaining() {
+		return 0, ErrShortBitStream
+	}
+	var v uint64
+	read := 0
+	for read < n {
+		used := r.pos % 8
+		take := 8 - used
+		if take > n-read {
+			take = n - read
+		}
+		chunk := uint64(r.buffer[r.pos/8]>>uint(used)) & (1<<uint(take) - 1)
+		v |= chunk << uint(read)
+		read += take
+		r.pos += take
+	}
+	return v, nil
+}
+
+func (r *BitReader) ReadBool() (bool, error) {
+	v, err := r.ReadBits(1)
+	return v == 1, err
+}
+
+func (r *BitReader) ReadUvarint() (uint64, error) {
+	var v uint64
+	for i := 0; i < maxVarintGroups; i++ {
+		group, err := r.ReadBits(8)
+		if err != nil {
+			return 0, err
+		}
+		if i == maxVarintGroups-1 && group > 1 {
+			return 0, ErrVarintOverflow
+		}
+		v |= (group & 0x7f) << uint(7*i)
+		if group < 1<<7 {
+			return v, nil
+		}
+	}
+	return 0, ErrVarintOverflow
+}
+
+func (r *BitReader) ReadVarint() (int64, error) {
+	u, err := r.ReadUvarint()
+	return UnZigZag(u), err
+}
+
+func (r *BitReader) ReadBytes(n int) ([]byte, error) {
+	if n < 0 || 8*n > r.Remaining() {
+		return nil, ErrShortBitStream
+	}
+	b := make([]byte, n)
+	return b, r.ReadBytesInto(b)
+}
+
+// ReadBytesInto fills b with the next len(b) bytes
+func (r *BitReader) ReadBytesInto(b []byte) error {
+	if 8*len(b) > r.Remaining() {
+		return ErrShortBitStream
+	}
+	if r.pos%8 == 0 {
+		copy(b, r.buffer[r.pos/8:])
+		r.pos += 8 * len(b)
+		return nil
+	}
+	for i := range b {
+		c, _ := r.ReadBits(8)
+		b[i] = uint8(c)
+	}
+	return nil
+}
+
+// Remaining is the number of unread bits, padding bits included
+func (r *BitReader) Remaining() int {
+	return 8*len(r.buffer) - r.pos
+}
+
+// ZigZag maps signed integers to unsigned ones, 0 -1 1 -2 ... to 0 1 2 3 ...
+func ZigZag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func UnZigZag(u uint64) int64 {
+	return int64(u>>1) ^ -int64(u&1)
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// idle buckets are forgotten once per prune interval, a refilled bucket is the same as a new one
+const rateLimiterPruneInterval time.Duration = time.Minute
+
+// RateLimiter is a token bucket per key. buckets start full with burst tokens
+// and refill rate tokens per second, a zero rate disables the limit.
+// it is safe for concurrent use
+type RateLimiter[K comparable] struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[K]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter[K comparable](rate float64, burst int) *RateLimiter[K] {
+	return &RateLimiter[K]{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[K]*bucket),
+	}
+}
+
+func (l *RateLimiter[K]) Allow(key K, now time.Time) bool {
+	return l.AllowN(key, 1, now)
+}
+
+// AllowN takes n tokens from the bucket of key, nothing is taken when there are not enough
+func (l *RateLimiter[K]) AllowN(key K, n int, now time.Time) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.pruned) > rateLimiterPruneInterval {
+		l.prune(now)
+	}
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	if now.After(b.last) {
+		b.last = now
+	}
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+func (l *RateLimiter[K]) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens
+	if now.After(b.last) {
+		tokens += now.Sub(b.last).Seconds() * l.rate
+	}
+	if tokens > l.burst {
+		return l.burst
+	}
+	return tokens
+}
+
+func (l *RateLimiter[K]) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruned = now
+}
+
+// Forget drops the bucket of key, the next request of key starts with a full bucket
+func (l *RateLimiter[K]) Forget(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, key)
+}
+
+// Len is the number of buckets that are kept
+func (l *RateLimiter[K]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
@@ -1,25 +1,165 @@
-/*
-	Pseude security
-	NOT a real communication authentication or authoraziton system implementation
-	just a dummy procedure for pointing out that there must be an authentication or user validation system
-*/
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"gameserver/config"
+	"sync"
+	"time"
+)
+
+// Players authenticate with a token signed by the keyring of the issuer
+// |------------------------------------------------------------------------|
+// | key ID | player ID | issued at | expires at | modes | signature         |
+// |------------------------------------------------------------------------|
+// | 1byte  |  8byte    |  8byte    |   8byte    | 4byte | 32byte            |
+// |------------------------------------------------------------------------|
+// times are unix seconds, modes is a bit set of the game modes the player may join.
+// signature is HMAC-SHA256 of the fields before it with the key of key ID,
+// keys are rotated by signing with a new key ID while the old one still verifies
 
 const (
-	HashLength int = 60
+	TokenSize     int = 61
+	tokenBodySize int = 29
+
+	// keys shorter than this are rejected
+	MinTokenKeySize int = 16
+	// tokens issued a bit in the future are accepted for clock differences
+	TokenClockSkew time.Duration = 30 * time.Second
 )
 
 var (
-	secret []byte = []byte("secret")
+	ErrInvalidToken   error = errors.New("utils: invalid token")
+	ErrTokenSignature error = errors.New("utils: token signature mismatch")
+	ErrTokenExpired   error = errors.New("utils: token expired")
+	ErrTokenNotYet    error = errors.New("utils: token is not valid yet")
+	ErrUnknownKey     error = errors.New("utils: unknown token key")
+	ErrShortKey       error = errors.New("utils: token key is too short")
 )
 
-func CreateHash() []byte {
-	hash, _ := bcrypt.GenerateFromPassword(secret, bcrypt.DefaultCost)
-	return hash
+// Claims are the fields of a token
+type Claims struct {
+	KeyID     uint8
+	PlayerID  uint64
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Modes     uint32
+}
+
+// Allows reports whether the player may join games of mode
+func (c *Claims) Allows(mode uint8) bool {
+	return mode < 32 && c.Modes&(1<<mode) != 0
+}
+
+// Keyring signs tokens with its signing key and verifies tokens of any of its keys.
+// it is safe for concurrent use
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[uint8][]byte
+	signing uint8
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[uint8][]byte)}
+}
+
+// ConfigKeyring returns the keyring of config.TokenKeys that signs with config.TokenSigningKeyID
+func ConfigKeyring() (*Keyring, error) {
+	k := NewKeyring()
+	for id, key := range config.TokenKeys {
+		err := k.Add(id, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, k.Use(config.TokenSigningKeyID)
+}
+
+// Add adds a key that verifies tokens, it replaces the key with the same ID
+func (k *Keyring) Add(id uint8, key []byte) error {
+	if len(key) < MinTokenKeySize {
+		return ErrShortKey
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// Remove retires a key, tokens signed with it are no longer valid
+func (k *Keyring) Remove(id uint8) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, id)
+}
+
+// Use makes a key the signing key of new tokens
+func (k *Keyring) Use(id uint8) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, exists := k.keys[id]; !exists {
+		return ErrUnknownKey
+	}
+	k.signing = id
+	return nil
+}
+
+// Sign issues a token of claims with the signing key, KeyID of claims is ignored
+func (k *Keyring) Sign(c *Claims) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, exists := k.keys[k.signing]
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+	token := make([]byte, 0, TokenSize)
+	token = append(token, k.signing)
+	token = AppendLE(token, c.PlayerID)
+	token = AppendLE(token, c.IssuedAt.Unix())
+	token = AppendLE(token, c.ExpiresAt.Unix())
+	token = AppendLE(token, c.Modes)
+	return append(token, sign(key, token)...), nil
+}
+
+// Issue signs a token for a player that is valid for lifetime from now
+func (k *Keyring) Issue(playerID uint64, modes uint32, lifetime time.Duration) ([]byte, error) {
+	now := time.Now()
+	return k.Sign(&Claims{PlayerID: playerID, IssuedAt: now, ExpiresAt: now.Add(lifetime), Modes: modes})
+}
+
+// Verify checks the signature and the lifetime of a token at now and returns its claims
+func (k *Keyring) Verify(token []byte, now time.Time) (*Claims, error) {
+	if len(token) != TokenSize {
+		return nil, ErrInvalidToken
+	}
+	k.mu.RLock()
+	key, exists := k.keys[token[0]]
+	k.mu.RUnlock()
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+	if !hmac.Equal(token[tokenBodySize:], sign(key, token[:tokenBodySize])) {
+		return nil, ErrTokenSignature
+	}
+	c := &Claims{KeyID: token[0]}
+	var issuedAt, expiresAt int64
+	c.PlayerID, _ = ReadLE[uint64](token[1:])
+	issuedAt, _ = ReadLE[int64](token[9:])
+	expiresAt, _ = ReadLE[int64](token[17:])
+	c.Modes, _ = ReadLE[uint32](token[25:])
+	c.IssuedAt, c.ExpiresAt = time.Unix(issuedAt, 0), time.Unix(expiresAt, 0)
+	if c.IssuedAt.After(now.Add(TokenClockSkew)) {
+		return nil, ErrTokenNotYet
+	}
+	if !c.ExpiresAt.After(now) {
+		return nil, ErrTokenExpired
+	}
+	return c, nil
 }
 
-func ValidateHash(hash []byte) bool {
-	return bcrypt.CompareHashAndPassword(hash, secret) == nil
+func sign(key, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return mac.Sum(nil)
 }